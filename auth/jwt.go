@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims are the registered JWT claims the API understands, plus the OAuth
+// style space separated scope.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+}
+
+// Audience is the aud claim, which may be a single string or an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Verifier checks bearer JWTs against a fixed set of keys. Issuer and
+// Audience are only enforced when set.
+type Verifier struct {
+	Keys      []Key
+	Issuer    string
+	Audience  string
+	ClockSkew time.Duration
+}
+
+// NewVerifier returns a verifier for keys.
+func NewVerifier(keys []Key, issuer, audience string, clockSkew time.Duration) (*Verifier, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no verification keys configured")
+	}
+	return &Verifier{Keys: keys, Issuer: issuer, Audience: audience, ClockSkew: clockSkew}, nil
+}
+
+// Verify checks the token's signature and claims and returns its principal.
+// Tokens must carry sub and exp.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token: malformed JWT")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("invalid token: header: %v", err)
+	}
+	if h.Alg != AlgHS256 && h.Alg != AlgRS256 {
+		return nil, fmt.Errorf("invalid token: unsupported algorithm %q", h.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: signature is not base64url")
+	}
+	if !v.verifySignature(h, parts[0]+"."+parts[1], signature) {
+		return nil, fmt.Errorf("invalid token: signature verification failed")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token: claims: %v", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0).UTC()
+	return &Principal{
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		Scopes:    parseScopes(claims.Scope),
+		Method:    MethodJWT,
+		ExpiresAt: &expiresAt,
+	}, nil
+}
+
+// verifySignature tries every key for the token's algorithm, narrowed to the
+// token's kid when it names one.
+func (v *Verifier) verifySignature(h header, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	for _, key := range v.Keys {
+		if key.Algorithm != h.Alg || (h.Kid != "" && key.ID != "" && key.ID != h.Kid) {
+			continue
+		}
+		switch key.Algorithm {
+		case AlgHS256:
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write([]byte(signed))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case AlgRS256:
+			if rsa.VerifyPKCS1v15(key.public, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *Verifier) checkClaims(claims Claims) error {
+	now := time.Now()
+	if claims.Subject == "" {
+		return fmt.Errorf("invalid token: missing sub claim")
+	}
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("invalid token: missing exp claim")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(v.ClockSkew)) {
+		return fmt.Errorf("invalid token: token has expired")
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-v.ClockSkew)) {
+		return fmt.Errorf("invalid token: token is not valid yet")
+	}
+	if claims.IssuedAt != 0 && now.Before(time.Unix(claims.IssuedAt, 0).Add(-v.ClockSkew)) {
+		return fmt.Errorf("invalid token: token was issued in the future")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return fmt.Errorf("invalid token: unexpected issuer %q", claims.Issuer)
+	}
+	if v.Audience != "" && !contains(claims.Audience, v.Audience) {
+		return fmt.Errorf("invalid token: token is not meant for audience %q", v.Audience)
+	}
+	return nil
+}
+
+// Mint signs claims. key is the HS256 secret ([]byte) or the RS256
+// *rsa.PrivateKey; kid is put in the header when set. It exists for tests
+// and the mint-token command, production tokens come from the identity
+// provider.
+func Mint(alg string, key interface{}, kid string, claims Claims) (string, error) {
+	headerSegment, err := encodeSegment(header{Alg: alg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	claimsSegment, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := headerSegment + "." + claimsSegment
+
+	var signature []byte
+	switch alg {
+	case AlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return "", fmt.Errorf("HS256 needs a []byte secret")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case AlgRS256:
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("RS256 needs an *rsa.PrivateKey")
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:]); err != nil {
+			return "", fmt.Errorf("failed to sign token: %v", err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("not base64url")
+	}
+	return json.Unmarshal(data, v)
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testHMACSecret = []byte("0123456789abcdef0123456789abcdef")
+
+var (
+	testRSAOnce sync.Once
+	testRSAKey  *rsa.PrivateKey
+)
+
+// testRSAPrivateKey generates one RSA key for the whole package.
+func testRSAPrivateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testRSAOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		testRSAKey = key
+	})
+	return testRSAKey
+}
+
+func testVerifier(t *testing.T, issuer, audience string, skew time.Duration) *Verifier {
+	t.Helper()
+	hmacKey, err := NewHMACKey("hs", testHMACSecret)
+	if err != nil {
+		t.Fatalf("NewHMACKey: %v", err)
+	}
+	rsaKey, err := NewRSAKey("rs", &testRSAPrivateKey(t).PublicKey)
+	if err != nil {
+		t.Fatalf("NewRSAKey: %v", err)
+	}
+	verifier, err := NewVerifier([]Key{hmacKey, rsaKey}, issuer, audience, skew)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	return verifier
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Issuer:    "https://issuer.example",
+		Subject:   "alice",
+		Audience:  Audience{"fitness-api"},
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		IssuedAt:  now.Unix(),
+		Scope:     "users:read api-keys:admin",
+	}
+}
+
+func mint(t *testing.T, alg string, key interface{}, kid string, claims Claims) string {
+	t.Helper()
+	token, err := Mint(alg, key, kid, claims)
+	if err != nil {
+		t.Fatalf("Mint: %v", err)
+	}
+	return token
+}
+
+// forge builds a token with an arbitrary header, signed with HMAC-SHA256
+// under secret as an attacker would, or unsigned when secret is nil.
+func forge(t *testing.T, headerJSON string, claims Claims, secret []byte) string {
+	t.Helper()
+	signed := base64.RawURLEncoding.EncodeToString([]byte(headerJSON)) + "." + mustSegment(t, claims)
+	if secret == nil {
+		return signed + "."
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyAcceptsValidTokens(t *testing.T) {
+	verifier := testVerifier(t, "https://issuer.example", "fitness-api", 0)
+	private := testRSAPrivateKey(t)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "HS256", token: mint(t, AlgHS256, testHMACSecret, "", validClaims())},
+		{name: "HS256 with its kid", token: mint(t, AlgHS256, testHMACSecret, "hs", validClaims())},
+		{name: "RS256", token: mint(t, AlgRS256, private, "", validClaims())},
+		{name: "RS256 with its kid", token: mint(t, AlgRS256, private, "rs", validClaims())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(tt.token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if principal.Subject != "alice" || principal.Issuer != "https://issuer.example" || principal.Method != "jwt" {
+				t.Errorf("principal = %+v", principal)
+			}
+			if !principal.HasScope("users:read") || !principal.HasScope("api-keys:admin") || principal.HasScope("admin") {
+				t.Errorf("scopes = %v, want users:read and api-keys:admin", principal.Scopes)
+			}
+			if principal.ExpiresAt == nil || principal.ExpiresAt.Unix() != validClaims().ExpiresAt {
+				t.Errorf("expires at = %v", principal.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	private := testRSAPrivateKey(t)
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	rsaKey, err := NewRSAKey("", &private.PublicKey)
+	if err != nil {
+		t.Fatalf("NewRSAKey: %v", err)
+	}
+	rsaOnly, err := NewVerifier([]Key{rsaKey}, "", "", 0)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	rsToken := mint(t, AlgRS256, private, "", validClaims())
+	rsParts := strings.Split(rsToken, ".")
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		err      string
+	}{
+		{
+			name:     "HS256 signed with the RSA public key",
+			verifier: rsaOnly,
+			token:    forge(t, `{"alg":"HS256","typ":"JWT"}`, validClaims(), publicPEM),
+			err:      "signature verification failed",
+		},
+		{
+			name:     "HS256 signed with the RSA modulus",
+			verifier: rsaOnly,
+			token:    forge(t, `{"alg":"HS256","typ":"JWT"}`, validClaims(), private.PublicKey.N.Bytes()),
+			err:      "signature verification failed",
+		},
+		{
+			name:     "alg none",
+			verifier: testVerifier(t, "", "", 0),
+			token:    forge(t, `{"alg":"none","typ":"JWT"}`, validClaims(), nil),
+			err:      `unsupported algorithm "none"`,
+		},
+		{
+			name:     "lowercase alg",
+			verifier: testVerifier(t, "", "", 0),
+			token:    forge(t, `{"alg":"hs256","typ":"JWT"}`, validClaims(), testHMACSecret),
+			err:      `unsupported algorithm "hs256"`,
+		},
+		{
+			name:     "RS256 signature relabelled HS256",
+			verifier: testVerifier(t, "", "", 0),
+			token:    base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." + rsParts[1] + "." + rsParts[2],
+			err:      "signature verification failed",
+		},
+		{
+			name:     "kid naming another key",
+			verifier: testVerifier(t, "", "", 0),
+			token:    mint(t, AlgHS256, testHMACSecret, "rs", validClaims()),
+			err:      "signature verification failed",
+		},
+		{
+			name:     "wrong HMAC secret",
+			verifier: testVerifier(t, "", "", 0),
+			token:    mint(t, AlgHS256, []byte("another-secret-another-secret-xx"), "", validClaims()),
+			err:      "signature verification failed",
+		},
+		{
+			name:     "tampered claims",
+			verifier: testVerifier(t, "", "", 0),
+			token:    rsParts[0] + "." + mustSegment(t, Claims{Subject: "mallory", ExpiresAt: validClaims().ExpiresAt}) + "." + rsParts[2],
+			err:      "signature verification failed",
+		},
+		{name: "two segments", verifier: rsaOnly, token: rsParts[0] + "." + rsParts[1], err: "malformed JWT"},
+		{name: "bad signature encoding", verifier: rsaOnly, token: rsParts[0] + "." + rsParts[1] + ".***", err: "signature is not base64url"},
+		{name: "bad header", verifier: rsaOnly, token: "e30x." + rsParts[1] + "." + rsParts[2], err: "header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.verifier.Verify(tt.token)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Verify error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksClaims(t *testing.T) {
+	now := time.Now()
+	const skew = 30 * time.Second
+
+	tests := []struct {
+		name   string
+		modify func(*Claims)
+		err    string
+	}{
+		{name: "valid", modify: func(c *Claims) {}},
+		{name: "missing sub", modify: func(c *Claims) { c.Subject = "" }, err: "missing sub claim"},
+		{name: "missing exp", modify: func(c *Claims) { c.ExpiresAt = 0 }, err: "missing exp claim"},
+		{name: "expired", modify: func(c *Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, err: "token has expired"},
+		{name: "expired within skew", modify: func(c *Claims) { c.ExpiresAt = now.Add(-10 * time.Second).Unix() }},
+		{name: "not valid yet", modify: func(c *Claims) { c.NotBefore = now.Add(time.Minute).Unix() }, err: "not valid yet"},
+		{name: "nbf within skew", modify: func(c *Claims) { c.NotBefore = now.Add(10 * time.Second).Unix() }},
+		{name: "nbf passed", modify: func(c *Claims) { c.NotBefore = now.Add(-time.Minute).Unix() }},
+		{name: "issued in the future", modify: func(c *Claims) { c.IssuedAt = now.Add(time.Minute).Unix() }, err: "issued in the future"},
+		{name: "wrong issuer", modify: func(c *Claims) { c.Issuer = "https://evil.example" }, err: `unexpected issuer "https://evil.example"`},
+		{name: "missing issuer", modify: func(c *Claims) { c.Issuer = "" }, err: "unexpected issuer"},
+		{name: "wrong audience", modify: func(c *Claims) { c.Audience = Audience{"other-api"} }, err: `not meant for audience "fitness-api"`},
+		{name: "missing audience", modify: func(c *Claims) { c.Audience = nil }, err: "not meant for audience"},
+		{name: "audience among several", modify: func(c *Claims) { c.Audience = Audience{"other-api", "fitness-api"} }},
+	}
+
+	verifier := testVerifier(t, "https://issuer.example", "fitness-api", skew)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(&claims)
+			_, err := verifier.Verify(mint(t, AlgHS256, testHMACSecret, "", claims))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Verify error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyOptionalIssuerAndAudience(t *testing.T) {
+	verifier := testVerifier(t, "", "", 0)
+	claims := validClaims()
+	claims.Issuer = "anyone"
+	claims.Audience = nil
+	if _, err := verifier.Verify(mint(t, AlgHS256, testHMACSecret, "", claims)); err != nil {
+		t.Fatalf("Verify without configured iss and aud: %v", err)
+	}
+}
+
+func TestAudienceUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want Audience
+		err  bool
+	}{
+		{json: `"a"`, want: Audience{"a"}},
+		{json: `["a","b"]`, want: Audience{"a", "b"}},
+		{json: `42`, err: true},
+	}
+	for _, tt := range tests {
+		var got Audience
+		err := got.UnmarshalJSON([]byte(tt.json))
+		if (err != nil) != tt.err {
+			t.Errorf("UnmarshalJSON(%s) error = %v", tt.json, err)
+			continue
+		}
+		if !tt.err && strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("UnmarshalJSON(%s) = %v, want %v", tt.json, got, tt.want)
+		}
+	}
+}
+
+func mustSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	segment, err := encodeSegment(v)
+	if err != nil {
+		t.Fatalf("encodeSegment: %v", err)
+	}
+	return segment
+}
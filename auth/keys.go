@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+
+	// minHMACSecretLength is the shortest HS256 secret accepted, the size of
+	// the SHA-256 output.
+	minHMACSecretLength = 32
+)
+
+// Key is one verification key. Each key accepts exactly one algorithm, so a
+// token cannot get an RSA public key used as an HMAC secret.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	public    *rsa.PublicKey
+}
+
+// NewHMACKey returns an HS256 key for secret.
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if len(secret) < minHMACSecretLength {
+		return Key{}, fmt.Errorf("HS256 secret must be at least %d bytes, got %d", minHMACSecretLength, len(secret))
+	}
+	return Key{ID: id, Algorithm: AlgHS256, secret: secret}, nil
+}
+
+// NewRSAKey returns an RS256 key for public.
+func NewRSAKey(id string, public *rsa.PublicKey) (Key, error) {
+	if public.N.BitLen() < 2048 {
+		return Key{}, fmt.Errorf("RS256 key must be at least 2048 bits, got %d", public.N.BitLen())
+	}
+	return Key{ID: id, Algorithm: AlgRS256, public: public}, nil
+}
+
+// LoadHMACSecretFile reads an HS256 secret. Surrounding whitespace, such as
+// the trailing newline most editors add, is not part of the secret.
+func LoadHMACSecretFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read HS256 secret: %v", err)
+	}
+	return NewHMACKey("", bytes.TrimSpace(data))
+}
+
+// LoadRSAPublicKeyFile reads a PEM encoded RSA public key: a PKIX "PUBLIC
+// KEY", a PKCS #1 "RSA PUBLIC KEY" or a "CERTIFICATE".
+func LoadRSAPublicKeyFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read RSA public key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("invalid RSA public key %s: no PEM block", path)
+	}
+
+	var public interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			public = cert.PublicKey
+		}
+	default:
+		return Key{}, fmt.Errorf("invalid RSA public key %s: unexpected PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid RSA public key %s: %v", path, err)
+	}
+	rsaPublic, ok := public.(*rsa.PublicKey)
+	if !ok {
+		return Key{}, fmt.Errorf("invalid RSA public key %s: not an RSA key", path)
+	}
+	return NewRSAKey("", rsaPublic)
+}
+
+// LoadRSAPrivateKeyFile reads a PEM encoded PKCS #1 or PKCS #8 RSA private
+// key, used to mint RS256 tokens.
+func LoadRSAPrivateKeyFile(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RSA private key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid RSA private key %s: no PEM block", path)
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RSA private key %s: %v", path, err)
+	}
+	private, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid RSA private key %s: not an RSA key", path)
+	}
+	return private, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// LoadJWKSFile reads a JSON Web Key Set. RSA keys become RS256 keys and
+// "oct" keys HS256 keys; keys meant for encryption or for other algorithms
+// are skipped.
+func LoadJWKSFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %v", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS %s: %v", path, err)
+	}
+
+	var keys []Key
+	for i, entry := range set.Keys {
+		if entry.Use != "" && entry.Use != "sig" {
+			continue
+		}
+		var key Key
+		switch {
+		case entry.Kty == "RSA" && (entry.Alg == "" || entry.Alg == AlgRS256):
+			key, err = rsaJWK(entry)
+		case entry.Kty == "oct" && (entry.Alg == "" || entry.Alg == AlgHS256):
+			var secret []byte
+			if secret, err = base64.RawURLEncoding.DecodeString(entry.K); err == nil {
+				key, err = NewHMACKey(entry.Kid, secret)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS %s: key %d: %v", path, i, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("invalid JWKS %s: no usable signing keys", path)
+	}
+	return keys, nil
+}
+
+func rsaJWK(entry jwk) (Key, error) {
+	n, err := base64.RawURLEncoding.DecodeString(entry.N)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid modulus: %v", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(entry.E)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid exponent: %v", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return Key{}, fmt.Errorf("invalid exponent")
+	}
+	return NewRSAKey(entry.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())})
+}
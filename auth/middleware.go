@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyHeader carries an API key.
+const APIKeyHeader = "X-API-Key"
+
+// ErrInvalidAPIKey is returned, possibly wrapped, for a key that is unknown,
+// revoked or expired. Any other error means the key could not be checked.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyAuthenticator resolves an API key to its principal.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (*Principal, error)
+}
+
+// Middleware rejects requests without valid credentials with 401 and
+// attaches the verified principal to the others. A request may send an
+// X-API-Key header or a bearer token; the API key wins when both are sent.
+// verifier is nil when no JWT keys are configured, then only API keys are
+// accepted.
+func Middleware(verifier *Verifier, apiKeys APIKeyAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if key := strings.TrimSpace(c.Request().Header.Get(APIKeyHeader)); key != "" {
+				principal, err := apiKeys.AuthenticateAPIKey(key)
+				if err != nil {
+					if !errors.Is(err, ErrInvalidAPIKey) {
+						log.Printf("Failed to check API key for %s %s: %v", c.Request().Method, c.Path(), err)
+						return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not check the API key"})
+					}
+					log.Printf("Rejected API key for %s %s: %v", c.Request().Method, c.Path(), err)
+					return unauthorized(c, "invalid_token", err)
+				}
+				SetPrincipal(c, principal)
+				return next(c)
+			}
+
+			token, err := bearerToken(c.Request())
+			if err != nil {
+				return unauthorized(c, "invalid_request", err)
+			}
+			if verifier == nil {
+				return unauthorized(c, "invalid_token", fmt.Errorf("bearer tokens are not accepted, send an %s header", APIKeyHeader))
+			}
+			principal, err := verifier.Verify(token)
+			if err != nil {
+				log.Printf("Rejected bearer token for %s %s: %v", c.Request().Method, c.Path(), err)
+				return unauthorized(c, "invalid_token", err)
+			}
+			SetPrincipal(c, principal)
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects callers without scope with 403. It runs after
+// Middleware; when authentication is turned off no principal is attached and
+// the route stays open like every other.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := PrincipalFrom(c)
+			if !ok {
+				return next(c)
+			}
+			if !principal.HasScope(scope) {
+				log.Printf("Denied %s %s to %s: missing scope %s", c.Request().Method, c.Path(), principal.Subject, scope)
+				err := fmt.Errorf("the %s scope is required", scope)
+				c.Response().Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q, error_description=%q, scope=%q", "insufficient_scope", err.Error(), scope))
+				return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+			}
+			return next(c)
+		}
+	}
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, error) {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return "", fmt.Errorf("missing credentials: send a bearer token or an %s header", APIKeyHeader)
+	}
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("authorization header must be \"Bearer <token>\"")
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func unauthorized(c echo.Context, code string, err error) error {
+	c.Response().Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q, error_description=%q", code, err.Error()))
+	return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+}
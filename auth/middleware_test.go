@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type fakeAuthenticator struct {
+	principal *Principal
+	err       error
+}
+
+func (f fakeAuthenticator) AuthenticateAPIKey(key string) (*Principal, error) {
+	return f.principal, f.err
+}
+
+func TestMiddlewareAPIKeyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   fakeAuthenticator
+		status int
+	}{
+		{name: "valid", auth: fakeAuthenticator{principal: &Principal{Subject: "api-key:1", Method: MethodAPIKey}}, status: http.StatusOK},
+		{name: "unknown key", auth: fakeAuthenticator{err: ErrInvalidAPIKey}, status: http.StatusUnauthorized},
+		{name: "revoked key", auth: fakeAuthenticator{err: fmt.Errorf("%w: the key has been revoked", ErrInvalidAPIKey)}, status: http.StatusUnauthorized},
+		{name: "storage outage", auth: fakeAuthenticator{err: errors.New("connection refused")}, status: http.StatusInternalServerError},
+		{name: "outage worded like a bad key", auth: fakeAuthenticator{err: errors.New("invalid API key lookup: connection refused")}, status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set(APIKeyHeader, "fit_key")
+			rec := httptest.NewRecorder()
+			handler := Middleware(nil, tt.auth)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		status    int
+	}{
+		{name: "authentication off", principal: nil, status: http.StatusOK},
+		{name: "has scope", principal: &Principal{Subject: "a", Scopes: []string{"users:read", ScopeAdmin}}, status: http.StatusOK},
+		{name: "missing scope", principal: &Principal{Subject: "a", Scopes: []string{"users:read"}}, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodPost, "/admin/users/purge", nil), rec)
+			if tt.principal != nil {
+				SetPrincipal(c, tt.principal)
+			}
+			handler := RequireScope(ScopeAdmin)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(c); err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fitness-api/auth"
+	"fitness-api/config"
+	manager "fitness-api/managers"
+	"fitness-api/request"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// loadVerificationKeys collects every key the config points at.
+func loadVerificationKeys(flagConfig *config.Flag) ([]auth.Key, error) {
+	var keys []auth.Key
+	if flagConfig.AuthHMACSecretFile != "" {
+		key, err := auth.LoadHMACSecretFile(flagConfig.AuthHMACSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if flagConfig.AuthRSAPublicKeyFile != "" {
+		key, err := auth.LoadRSAPublicKeyFile(flagConfig.AuthRSAPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if flagConfig.AuthJWKSFile != "" {
+		jwks, err := auth.LoadJWKSFile(flagConfig.AuthJWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+	return keys, nil
+}
+
+// newAuthMiddleware returns the authentication middleware, or nil when
+// authentication is turned off. API keys are always accepted; bearer tokens
+// only when a JWT key is configured.
+func newAuthMiddleware(flagConfig *config.Flag, apiKeys auth.APIKeyAuthenticator) echo.MiddlewareFunc {
+	if flagConfig.AuthEnabled == "FALSE" {
+		log.Printf("Authentication is disabled (AUTH_ENABLED=FALSE), every route is open")
+		return nil
+	}
+	keys, err := loadVerificationKeys(flagConfig)
+	if err != nil {
+		log.Fatalf("Failed to load authentication keys: %v", err)
+	}
+	if len(keys) == 0 {
+		log.Printf("No JWT keys configured, only API keys are accepted; create the first one with the create-api-key command")
+		return auth.Middleware(nil, apiKeys)
+	}
+	verifier, err := auth.NewVerifier(keys, flagConfig.AuthIssuer, flagConfig.AuthAudience, flagConfig.AuthClockSkew)
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	log.Printf("Authentication enabled with %d JWT key(s) and API keys", len(keys))
+	return auth.Middleware(verifier, apiKeys)
+}
+
+// runMintToken prints a signed token for local testing. HS256 tokens are
+// signed with AUTH_HMAC_SECRET_FILE unless -secret-file is given; RS256
+// tokens need the private key matching the configured public key.
+func runMintToken(flagConfig *config.Flag, args []string) error {
+	fs := flag.NewFlagSet("mint-token", flag.ContinueOnError)
+	subject := fs.String("sub", "", "subject (required)")
+	scope := fs.String("scope", "", "space separated scopes")
+	ttl := fs.Duration("ttl", time.Hour, "lifetime of the token")
+	alg := fs.String("alg", auth.AlgHS256, "signing algorithm: HS256 or RS256")
+	secretFile := fs.String("secret-file", flagConfig.AuthHMACSecretFile, "HS256 secret")
+	privateKeyFile := fs.String("private-key", "", "PEM RSA private key for RS256")
+	kid := fs.String("kid", "", "key id to put in the header")
+	issuer := fs.String("iss", flagConfig.AuthIssuer, "issuer")
+	audience := fs.String("aud", flagConfig.AuthAudience, "audience")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *subject == "" {
+		return fmt.Errorf("-sub is required")
+	}
+	if *ttl <= 0 {
+		return fmt.Errorf("-ttl must be positive")
+	}
+
+	var key interface{}
+	switch *alg {
+	case auth.AlgHS256:
+		if *secretFile == "" {
+			return fmt.Errorf("HS256 needs -secret-file or AUTH_HMAC_SECRET_FILE")
+		}
+		secret, err := os.ReadFile(*secretFile)
+		if err != nil {
+			return fmt.Errorf("failed to read HS256 secret: %v", err)
+		}
+		key = bytes.TrimSpace(secret)
+	case auth.AlgRS256:
+		if *privateKeyFile == "" {
+			return fmt.Errorf("RS256 needs -private-key")
+		}
+		private, err := auth.LoadRSAPrivateKeyFile(*privateKeyFile)
+		if err != nil {
+			return err
+		}
+		key = private
+	default:
+		return fmt.Errorf("-alg must be HS256 or RS256")
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		Issuer:    *issuer,
+		Subject:   *subject,
+		ExpiresAt: now.Add(*ttl).Unix(),
+		IssuedAt:  now.Unix(),
+		Scope:     *scope,
+	}
+	if *audience != "" {
+		claims.Audience = auth.Audience{*audience}
+	}
+	token, err := auth.Mint(*alg, key, *kid, claims)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// runCreateAPIKey issues an API key straight in the configured backend, which
+// is how the first key is made when no JWT issuer is set up.
+func runCreateAPIKey(flagConfig *config.Flag, args []string) error {
+	fs := flag.NewFlagSet("create-api-key", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the key (required)")
+	scope := fs.String("scope", "", "space separated scopes")
+	ttl := fs.Duration("ttl", 0, "lifetime of the key, 0 for no expiry")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if flagConfig.FlagValue == "MEMORY" {
+		return fmt.Errorf("the in-memory backend does not keep API keys between runs")
+	}
+	if *ttl < 0 {
+		return fmt.Errorf("-ttl cannot be negative")
+	}
+
+	req := request.APIKeyRequest{Name: *name, Scopes: strings.Fields(*scope)}
+	if *ttl > 0 {
+		expiresAt := time.Now().Add(*ttl)
+		req.ExpiresAt = &expiresAt
+	}
+	if err := validator.New().Struct(req); err != nil {
+		return err
+	}
+
+	_, migrator := connectBackend(flagConfig)
+	if flagConfig.AutoMigrate == "TRUE" {
+		autoMigrate(migrator)
+	}
+	created, err := manager.NewAPIKeyManager(connectStores(flagConfig).apiKeys).CreateAPIKey(req, nil, "cli")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created API key %s (%s). It is shown only once:\n%s\n", created.Id, created.Name, created.Key)
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fitness-api/config"
+	"fitness-api/db"
+	"fitness-api/migrations"
+	"fitness-api/service"
+	"fmt"
+	"log"
+)
+
+// transferStore is a backend that can act as either end of copy-users or of
+// the dual-write mode.
+type transferStore interface {
+	service.SecondaryUserRepository
+	service.UserBatchReader
+}
+
+// connectBackend opens the storage selected by FLAG_VALUE and returns the
+// user repository and migrator for it. The migrator is nil for backends
+// without a schema.
+func connectBackend(flagConfig *config.Flag) (service.UserRepository, migrations.Migrator) {
+	switch flagConfig.FlagValue {
+	case "TRUE":
+
+		fmt.Println("MongoDB URL:", flagConfig.FlagValue)
+		if err := db.InitMongoDB(); err != nil {
+			log.Fatalf("Failed to initialize MongoDB: %v", err)
+		}
+		fmt.Println("MongoDB Initialized")
+
+		mongoClient, err := db.GetMongoDB()
+		if err != nil {
+			log.Fatalf("Failed to get MongoDB client: %v", err)
+		}
+		return service.NewMongoUserRepository(mongoClient), migrations.NewMongoMigrator(mongoClient)
+	case "DUAL":
+
+		return connectDualWrite(flagConfig)
+	case "MEMORY":
+
+		fmt.Println("Using in-memory user store, data is lost on restart")
+		return service.NewMemoryUserRepository(), nil
+	case "SQLITE":
+
+		if err := db.InitSQLiteDB(); err != nil {
+			log.Fatalf("Failed to initialize SQLite: %v", err)
+		}
+		fmt.Println("SQLite Initialized")
+		return service.NewSQLiteUserRepository(db.GetSQLiteDB()), newSQLMigrator(db.GetSQLiteDB(), migrations.SQLite)
+	default:
+
+		if err := db.InitPostgresDB(); err != nil {
+			log.Fatalf("Failed to initialize PostgreSQL: %v", err)
+		}
+		fmt.Println("PostgreSQL Initialized")
+		return service.NewPostgresUserRepository(db.GetPostgresDB()), newSQLMigrator(db.GetPostgresDB(), migrations.Postgres)
+	}
+}
+
+// connectDualWrite opens both MongoDB and PostgreSQL for the DUAL migration
+// mode. The returned migrator belongs to the primary; the secondary schema is
+// brought up to date here when AUTO_MIGRATE is on.
+func connectDualWrite(flagConfig *config.Flag) (service.UserRepository, migrations.Migrator) {
+	if flagConfig.DualWritePrimary != "mongo" && flagConfig.DualWritePrimary != "postgres" {
+		log.Fatalf("DUAL_WRITE_PRIMARY must be mongo or postgres, got %q", flagConfig.DualWritePrimary)
+	}
+
+	mongoRepo, mongoMigrator := openTransferStore("mongo")
+	postgresRepo, postgresMigrator := openTransferStore("postgres")
+	fmt.Println("MongoDB and PostgreSQL Initialized for dual-write, primary:", flagConfig.DualWritePrimary)
+
+	primary, secondary := mongoRepo, postgresRepo
+	primaryMigrator, secondaryMigrator := mongoMigrator, postgresMigrator
+	if flagConfig.DualWritePrimary == "postgres" {
+		primary, secondary = postgresRepo, mongoRepo
+		primaryMigrator, secondaryMigrator = postgresMigrator, mongoMigrator
+	}
+
+	if flagConfig.AutoMigrate == "TRUE" {
+		autoMigrate(secondaryMigrator)
+	}
+
+	return service.NewDualWriteUserRepository(primary, secondary, flagConfig.ShadowReadConcurrency), primaryMigrator
+}
+
+func openTransferStore(name string) (transferStore, migrations.Migrator) {
+	if name == "mongo" {
+		if err := db.InitMongoDB(); err != nil {
+			log.Fatalf("Failed to initialize MongoDB: %v", err)
+		}
+		mongoClient, err := db.GetMongoDB()
+		if err != nil {
+			log.Fatalf("Failed to get MongoDB client: %v", err)
+		}
+		return service.NewMongoUserRepository(mongoClient), migrations.NewMongoMigrator(mongoClient)
+	}
+
+	if err := db.InitPostgresDB(); err != nil {
+		log.Fatalf("Failed to initialize PostgreSQL: %v", err)
+	}
+	return service.NewPostgresUserRepository(db.GetPostgresDB()), newSQLMigrator(db.GetPostgresDB(), migrations.Postgres)
+}
+
+// stores holds the repositories kept next to the users on the backend
+// connectBackend opened. In DUAL mode they live on the primary only and are
+// not written to the secondary; see the README.
+type stores struct {
+	webhooks service.WebhookRepository
+	subjects service.SubjectRepository
+	apiKeys  service.APIKeyRepository
+}
+
+// connectStores returns the webhook, subject catalog and API key stores for
+// the backend connectBackend opened.
+func connectStores(flagConfig *config.Flag) stores {
+	backend := flagConfig.FlagValue
+	if backend == "DUAL" && flagConfig.DualWritePrimary == "mongo" {
+		backend = "TRUE"
+	}
+
+	switch backend {
+	case "TRUE":
+		mongoClient, err := db.GetMongoDB()
+		if err != nil {
+			log.Fatalf("Failed to get MongoDB client: %v", err)
+		}
+		return stores{
+			webhooks: service.NewMongoWebhookRepository(mongoClient),
+			subjects: service.NewMongoSubjectRepository(mongoClient),
+			apiKeys:  service.NewMongoAPIKeyRepository(mongoClient),
+		}
+	case "MEMORY":
+		return stores{
+			webhooks: service.NewMemoryWebhookRepository(),
+			subjects: service.NewMemorySubjectRepository(),
+			apiKeys:  service.NewMemoryAPIKeyRepository(),
+		}
+	case "SQLITE":
+		return sqlStores(db.GetSQLiteDB())
+	default:
+		return sqlStores(db.GetPostgresDB())
+	}
+}
+
+func sqlStores(database *sql.DB) stores {
+	return stores{
+		webhooks: service.NewSQLWebhookRepository(database),
+		subjects: service.NewSQLSubjectRepository(database),
+		apiKeys:  service.NewSQLAPIKeyRepository(database),
+	}
+}
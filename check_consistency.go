@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fitness-api/service"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runCheckConsistency compares the MongoDB and PostgreSQL user stores and
+// prints a report. It fails when the stores disagree so it can gate a
+// decommissioning step in scripts.
+func runCheckConsistency(args []string) error {
+	fs := flag.NewFlagSet("check-consistency", flag.ContinueOnError)
+	format := fs.String("format", "text", "report format: text or json")
+	batchSize := fs.Int("batch-size", 500, "users read per batch from each store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("-format must be text or json")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("-batch-size must be positive")
+	}
+
+	mongoRepo, _ := openTransferStore("mongo")
+	postgresRepo, _ := openTransferStore("postgres")
+
+	report, err := service.CompareUserStores(context.Background(), "mongo", mongoRepo, "postgres", postgresRepo, *batchSize)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printConsistencyReport(os.Stdout, report)
+	}
+
+	if !report.Consistent() {
+		return fmt.Errorf("user stores are not consistent")
+	}
+	return nil
+}
+
+func printConsistencyReport(w io.Writer, report service.ConsistencyReport) {
+	fmt.Fprintf(w, "Compared %d %s user(s) with %d %s user(s)\n\n", report.LeftCount, report.Left, report.RightCount, report.Right)
+
+	fmt.Fprintf(w, "Missing in %s: %d\n", report.Right, len(report.MissingInRight))
+	for _, id := range report.MissingInRight {
+		fmt.Fprintf(w, "  %s\n", id)
+	}
+	fmt.Fprintf(w, "Missing in %s: %d\n", report.Left, len(report.MissingInLeft))
+	for _, id := range report.MissingInLeft {
+		fmt.Fprintf(w, "  %s\n", id)
+	}
+
+	fmt.Fprintf(w, "Mismatched users: %d\n", len(report.Mismatches))
+	for _, mismatch := range report.Mismatches {
+		for _, field := range mismatch.Fields {
+			fmt.Fprintf(w, "  %s %s: %s=%q %s=%q\n", mismatch.Id, field.Field, report.Left, field.Left, report.Right, field.Right)
+		}
+	}
+
+	fmt.Fprintf(w, "Users with timestamp drift: %d (max %s)\n", len(report.TimestampDrift), report.MaxDrift)
+	for _, mismatch := range report.TimestampDrift {
+		for _, field := range mismatch.Fields {
+			fmt.Fprintf(w, "  %s %s: %s=%s %s=%s drift=%s\n", mismatch.Id, field.Field, report.Left, field.Left, report.Right, field.Right, field.Drift)
+		}
+	}
+
+	if report.Consistent() {
+		fmt.Fprintln(w, "\nStores are consistent")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fitness-api/config"
+	"fitness-api/migrations"
+	"fmt"
+	"log"
+)
+
+const usage = `usage:
+  fitness-api                      start the HTTP server
+  fitness-api migrate up           apply all pending migrations
+  fitness-api migrate down         revert the last applied migration
+  fitness-api migrate status       list migrations and whether they are applied
+  fitness-api copy-users -from mongo -to postgres [-batch-size N] [-checkpoint FILE] [-resume] [-dry-run]
+                                   copy every user between the MongoDB and PostgreSQL stores
+  fitness-api check-consistency [-format text|json] [-batch-size N]
+                                   diff the MongoDB and PostgreSQL stores, exits 1 when they differ
+  fitness-api mint-token -sub SUBJECT [-scope S] [-ttl 1h] [-alg HS256|RS256] [-secret-file F] [-private-key F] [-kid K]
+                                   print a signed bearer token for testing
+  fitness-api create-api-key -name NAME [-scope S] [-ttl D]
+                                   issue an API key in the configured backend and print it once`
+
+// runCommand executes a CLI subcommand instead of starting the server.
+func runCommand(flagConfig *config.Flag, args []string) error {
+	switch args[0] {
+	case "migrate":
+		_, migrator := connectBackend(flagConfig)
+		return runMigrate(args[1:], migrator)
+	case "copy-users":
+		return runCopyUsers(args[1:])
+	case "check-consistency":
+		return runCheckConsistency(args[1:])
+	case "mint-token":
+		return runMintToken(flagConfig, args[1:])
+	case "create-api-key":
+		return runCreateAPIKey(flagConfig, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(args []string, migrator migrations.Migrator) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%s", usage)
+	}
+	if migrator == nil {
+		fmt.Println("Selected backend has no schema, nothing to migrate")
+		return nil
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			fmt.Println("No applied migrations to revert")
+			return nil
+		}
+		fmt.Printf("Reverted %d_%s\n", reverted.Version, reverted.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%s", args[0], usage)
+	}
+	return nil
+}
+
+func newSQLMigrator(db *sql.DB, dialect string) migrations.Migrator {
+	migrator, err := migrations.NewSQLMigrator(db, dialect)
+	if err != nil {
+		log.Fatalf("Failed to load %s migrations: %v", dialect, err)
+	}
+	return migrator
+}
+
+func autoMigrate(migrator migrations.Migrator) {
+	if migrator == nil {
+		return
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		log.Fatalf("Failed to apply migrations: %v", err)
+	}
+}
@@ -1,12 +1,53 @@
 package config
 
 import (
-	"log"
 	"github.com/caarlos0/env"
+	"log"
+	"time"
 )
 
 type Flag struct {
-	FlagValue string `env:"FLAG_VALUE" envDefault:"TRUE"`
+	FlagValue   string `env:"FLAG_VALUE" envDefault:"TRUE"`
+	AutoMigrate string `env:"AUTO_MIGRATE" envDefault:"TRUE"`
+
+	// Used when FLAG_VALUE is DUAL: writes go to both MongoDB and PostgreSQL,
+	// reads are served by the primary ("mongo" or "postgres") and compared
+	// against the other store in the background.
+	DualWritePrimary      string `env:"DUAL_WRITE_PRIMARY" envDefault:"mongo"`
+	ShadowReadConcurrency int    `env:"SHADOW_READ_CONCURRENCY" envDefault:"16"`
+
+	// Relay for user change events. Events always go to the registered
+	// webhooks; OUTBOX_PUBLISHER adds "file" (NDJSON lines appended to
+	// OUTBOX_FILE), "channel" (handed to an in-process consumer that logs
+	// them) or "none".
+	OutboxPublisher     string        `env:"OUTBOX_PUBLISHER" envDefault:"file"`
+	OutboxFile          string        `env:"OUTBOX_FILE" envDefault:"user-events.ndjson"`
+	OutboxRelayInterval time.Duration `env:"OUTBOX_RELAY_INTERVAL" envDefault:"1s"`
+	OutboxBatchSize     int           `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+
+	// Webhook delivery. A failed delivery is retried after WEBHOOK_RETRY_BASE,
+	// doubling up to WEBHOOK_RETRY_MAX, and dead-lettered after
+	// WEBHOOK_MAX_ATTEMPTS attempts.
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookRetryBase    time.Duration `env:"WEBHOOK_RETRY_BASE" envDefault:"5s"`
+	WebhookRetryMax     time.Duration `env:"WEBHOOK_RETRY_MAX" envDefault:"1h"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookPollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" envDefault:"1s"`
+	WebhookConcurrency  int           `env:"WEBHOOK_CONCURRENCY" envDefault:"4"`
+
+	// Authentication. Every route requires an API key in X-API-Key or a
+	// bearer JWT signed with one of the configured keys: an HS256 secret, a
+	// PEM RSA public key for RS256 and/or a JWKS file. AUTH_ISSUER and
+	// AUTH_AUDIENCE are checked against iss and aud when set. Without JWT
+	// keys only API keys are accepted. AUTH_ENABLED=FALSE turns it off for
+	// local development.
+	AuthEnabled          string        `env:"AUTH_ENABLED" envDefault:"TRUE"`
+	AuthHMACSecretFile   string        `env:"AUTH_HMAC_SECRET_FILE"`
+	AuthRSAPublicKeyFile string        `env:"AUTH_RSA_PUBLIC_KEY_FILE"`
+	AuthJWKSFile         string        `env:"AUTH_JWKS_FILE"`
+	AuthIssuer           string        `env:"AUTH_ISSUER"`
+	AuthAudience         string        `env:"AUTH_AUDIENCE"`
+	AuthClockSkew        time.Duration `env:"AUTH_CLOCK_SKEW" envDefault:"30s"`
 }
 
 func InitConfig() (*Flag, error) {
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fitness-api/auth"
+	manager "fitness-api/managers"
+	"fitness-api/request"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type APIKeyController struct {
+	manager *manager.APIKeyManager
+}
+
+func NewAPIKeyController(mn *manager.APIKeyManager) *APIKeyController {
+	return &APIKeyController{manager: mn}
+}
+
+// CreateAPIKey issues a key. The response is the only time the key itself
+// is shown.
+func (kc *APIKeyController) CreateAPIKey(c echo.Context) error {
+	var req request.APIKeyRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	creator, _ := auth.PrincipalFrom(c)
+	created, err := kc.manager.CreateAPIKey(req, creator, requestActor(c))
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusCreated, created)
+}
+
+func (kc *APIKeyController) ListAPIKeys(c echo.Context) error {
+	keys, err := kc.manager.ListAPIKeys()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"api_keys": keys})
+}
+
+func (kc *APIKeyController) GetAPIKey(c echo.Context) error {
+	key, err := kc.manager.GetAPIKey(c.Param("id"))
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+// RevokeAPIKey revokes the key and returns it with revoked_at set.
+func (kc *APIKeyController) RevokeAPIKey(c echo.Context) error {
+	key, err := kc.manager.RevokeAPIKey(c.Param("id"), requestActor(c))
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+func apiKeyError(c echo.Context, err error) error {
+	switch {
+	case strings.HasPrefix(err.Error(), "no API key found"):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case strings.HasPrefix(err.Error(), "cannot grant"):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case strings.HasPrefix(err.Error(), "failed to"):
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
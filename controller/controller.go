@@ -1,15 +1,21 @@
 package controller
 
 import (
+	"fitness-api/auth"
+	"fitness-api/filter"
 	manager "fitness-api/managers"
+	"fitness-api/model"
+	"fitness-api/patch"
 	"fitness-api/request"
 	"fitness-api/response"
+	"fitness-api/service"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
@@ -24,6 +30,10 @@ func NewUserController(mn *manager.UserManager) *UserController {
 }
 
 func (uc *UserController) CreateUser(c echo.Context) error {
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
 	var req request.UserRequest
 
@@ -37,7 +47,7 @@ func (uc *UserController) CreateUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	createdUser, err := uc.manager.CreateUser(req)
+	createdUser, err := uc.manager.CreateUser(req, requestActor(c))
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
 			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
@@ -45,11 +55,15 @@ func (uc *UserController) CreateUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusCreated, createdUser)
+	return uc.renderUser(c, http.StatusCreated, view, createdUser)
 }
 
 func (uc *UserController) UpdateUser(c echo.Context) error {
 	id := c.Param("id")
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
 	var req request.UserRequest
 	if err := c.Bind(&req); err != nil {
@@ -58,28 +72,161 @@ func (uc *UserController) UpdateUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
-	updatedUser, err := uc.manager.UpdateUser(id, req)
+	expectedVersion, ok := uc.ifMatchVersion(c, id)
+	if !ok {
+		return c.JSON(http.StatusPreconditionFailed, map[string]string{"error": "If-Match does not name a version of this user"})
+	}
+
+	updatedUser, err := uc.manager.UpdateUser(id, req, expectedVersion, requestActor(c))
 	if err != nil {
 		log.Printf("Error updating user with ID %s: %v", id, err)
 
+		if strings.Contains(err.Error(), "version mismatch") {
+			return c.JSON(http.StatusPreconditionFailed, map[string]string{
+				"error": "The user was modified by someone else. Fetch it again and retry with the new ETag.",
+			})
+		}
+
 		if strings.Contains(err.Error(), "no user found with the given ID") {
 			return c.JSON(http.StatusNotFound, map[string]string{
 				"error": fmt.Sprintf("No user found with the given ID: %s. Please check the ID and try again.", id),
 			})
 		}
 
+		if strings.Contains(err.Error(), "already exists") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+
+		if strings.Contains(err.Error(), "invalid subjects") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "An unexpected error occurred while updating the user. Please try again later.",
 		})
 	}
-	return c.JSON(http.StatusOK, updatedUser)
+	setETag(c, updatedUser.Version)
+	return uc.renderUser(c, http.StatusOK, view, updatedUser)
+}
+
+func (uc *UserController) PatchUser(c echo.Context) error {
+	id := c.Param("id")
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	contentType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || (contentType != patch.MergePatchContentType && contentType != patch.JSONPatchContentType) {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+			"error": fmt.Sprintf("Content-Type must be %s or %s", patch.MergePatchContentType, patch.JSONPatchContentType),
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	expectedVersion, ok := uc.ifMatchVersion(c, id)
+	if !ok {
+		return c.JSON(http.StatusPreconditionFailed, map[string]string{"error": "If-Match does not name a version of this user"})
+	}
+
+	patchedUser, err := uc.manager.PatchUser(id, contentType, body, expectedVersion, requestActor(c))
+	if err != nil {
+		log.Printf("Error patching user with ID %s: %v", id, err)
+
+		switch {
+		case strings.Contains(err.Error(), "version mismatch"):
+			return c.JSON(http.StatusPreconditionFailed, map[string]string{
+				"error": "The user was modified by someone else. Fetch it again and retry with the new ETag.",
+			})
+		case strings.Contains(err.Error(), "no user found with the given ID"):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		case strings.Contains(err.Error(), "already exists"):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case strings.Contains(err.Error(), "invalid patch"), strings.Contains(err.Error(), "invalid subjects"):
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	setETag(c, patchedUser.Version)
+	return uc.renderUser(c, http.StatusOK, view, patchedUser)
+}
+
+// maxImportBodyBytes bounds an import upload.
+const maxImportBodyBytes = 10 << 20
+
+// ImportUsers creates users from a CSV (text/csv) or NDJSON
+// (application/x-ndjson) body, or from the "file" part of a multipart form.
+// mode=all_or_nothing rejects the whole import if any row fails; the default
+// best_effort creates every row it can.
+func (uc *UserController) ImportUsers(c echo.Context) error {
+	var atomic bool
+	switch c.QueryParam("mode") {
+	case "", "best_effort":
+	case "all_or_nothing":
+		atomic = true
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "mode must be best_effort or all_or_nothing"})
+	}
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxImportBodyBytes)
+
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	var body io.Reader = c.Request().Body
+	if contentType == echo.MIMEMultipartForm {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Multipart imports need a file part"})
+		}
+		upload, err := file.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid upload"})
+		}
+		defer upload.Close()
+		body = upload
+
+		contentType, _, _ = mime.ParseMediaType(file.Header.Get(echo.HeaderContentType))
+		if strings.HasSuffix(strings.ToLower(file.Filename), ".csv") {
+			contentType = "text/csv"
+		} else if strings.HasSuffix(strings.ToLower(file.Filename), ".ndjson") {
+			contentType = "application/x-ndjson"
+		}
+	}
+
+	var format string
+	switch contentType {
+	case "text/csv":
+		format = manager.ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson":
+		format = manager.ImportFormatNDJSON
+	default:
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+			"error": "Content-Type must be text/csv, application/x-ndjson or multipart/form-data",
+		})
+	}
+
+	report, err := uc.manager.ImportUsers(format, body, atomic, requestActor(c))
+	if err != nil {
+		log.Printf("Error importing users: %v", err)
+		if strings.Contains(err.Error(), "invalid import") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if report.Rejected {
+		return c.JSON(http.StatusUnprocessableEntity, report)
+	}
+	return c.JSON(http.StatusOK, report)
 }
 
 func (uc *UserController) DeleteUser(c echo.Context) error {
 
 	id := c.Param("id")
 
-	err := uc.manager.DeleteUser(id)
+	err := uc.manager.DeleteUser(id, requestActor(c))
 	if err != nil {
 		if err.Error() == fmt.Sprintf("no user found with id %s", id) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
@@ -90,6 +237,68 @@ func (uc *UserController) DeleteUser(c echo.Context) error {
 	return c.JSON(http.StatusNoContent, map[string]string{"message": "User deleted successfully"})
 }
 
+func (uc *UserController) RestoreUser(c echo.Context) error {
+	id := c.Param("id")
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user, err := uc.manager.RestoreUser(id, requestActor(c))
+	if err != nil {
+		if err.Error() == fmt.Sprintf("no deleted user found with id %s", id) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Deleted user not found"})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	setETag(c, user.Version)
+	return uc.renderUser(c, http.StatusOK, view, user)
+}
+
+func (uc *UserController) PurgeDeletedUsers(c echo.Context) error {
+	days, err := strconv.Atoi(c.QueryParam("older_than_days"))
+	if err != nil || days < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "older_than_days must be a non-negative integer"})
+	}
+
+	purged, err := uc.manager.PurgeDeletedUsers(days, requestActor(c))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"purged": purged})
+}
+
+func (uc *UserController) GetUserHistory(c echo.Context) error {
+	id := c.Param("id")
+
+	pageSizeInt, err := strconv.Atoi(c.QueryParam("per_page"))
+	if err != nil || pageSizeInt <= 0 {
+		pageSizeInt = 10
+	}
+	pageNoInt, err := strconv.Atoi(c.QueryParam("page_no"))
+	if err != nil || pageNoInt <= 0 {
+		pageNoInt = 1
+	}
+
+	entries, lastPage, totalDocuments, err := uc.manager.GetUserHistory(id, pageSizeInt, pageNoInt)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if totalDocuments == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No history found for this user"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"page_no":         pageNoInt,
+		"per_page":        pageSizeInt,
+		"last_page":       lastPage,
+		"total_documents": totalDocuments,
+		"history":         response.NewUserAuditEntryResponses(entries),
+	})
+}
+
 func (uc *UserController) GetAllUsers(c echo.Context) error {
 
 	pageSize := c.QueryParam("per_page")
@@ -110,42 +319,300 @@ func (uc *UserController) GetAllUsers(c echo.Context) error {
 	orderby := c.QueryParam("orderby")
 	subject := c.QueryParam("subject")
 
-	users, lastPage, totalDocuments, err := uc.manager.GetAllUsers(pageSizeInt, pageNoInt, subject, order, orderby)
+	userFilter, err := filter.Parse(c.QueryParam("filter"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Sending cursor, even empty, switches to keyset pagination; page_no
+	// keeps working for existing clients.
+	if c.QueryParams().Has("cursor") {
+		if pageSizeInt == -1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "per_page must be positive with cursor pagination"})
+		}
+		page, err := uc.manager.GetUsersPage(service.UserQuery{
+			PageSize:       pageSizeInt,
+			Subject:        subject,
+			Order:          order,
+			OrderBy:        orderby,
+			IncludeDeleted: c.QueryParam("include_deleted") == "true",
+			Filter:         userFilter,
+		}, c.QueryParam("cursor"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		rendered, err := uc.renderUsers(view, page.Users)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"per_page":    pageSizeInt,
+			"next_cursor": page.NextCursor,
+			"prev_cursor": page.PrevCursor,
+			"users":       rendered,
+		})
+	}
+
+	users, lastPage, totalDocuments, err := uc.manager.GetAllUsers(service.UserQuery{
+		PageSize:       pageSizeInt,
+		PageNo:         pageNoInt,
+		Subject:        subject,
+		Order:          order,
+		OrderBy:        orderby,
+		IncludeDeleted: c.QueryParam("include_deleted") == "true",
+		Filter:         userFilter,
+	})
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
+	rendered, err := uc.renderUsers(view, users)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"page_no":         pageNoInt,
 		"per_page":        pageSizeInt,
 		"last_page":       lastPage,
 		"total_documents": totalDocuments,
-		"users":           users,
+		"users":           rendered,
 	})
 }
-func formatTime(t *time.Time) string {
-	if t == nil {
-		return ""
+
+// ExportUsers streams every matching user as CSV, NDJSON or a JSON array.
+// It takes the same subject, filter, order, orderby, include_deleted and
+// fields parameters as the listing. Once the first bytes are sent the status
+// can no longer change, so a failure part way through is only logged and the
+// response is cut short.
+func (uc *UserController) ExportUsers(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = manager.ExportFormatNDJSON
+	}
+	contentType, ok := manager.ExportContentTypes[format]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be csv, ndjson or json"})
+	}
+
+	userFilter, err := filter.Parse(c.QueryParam("filter"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// Exports are streamed straight from the store, so they cannot expand.
+	view, err := response.ParseUserView(c.QueryParam("fields"), "", nil)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := service.UserQuery{
+		PageSize:       -1,
+		Subject:        c.QueryParam("subject"),
+		Order:          c.QueryParam("order"),
+		OrderBy:        c.QueryParam("orderby"),
+		IncludeDeleted: c.QueryParam("include_deleted") == "true",
+		Filter:         userFilter,
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users.%s"`, format))
+	c.Response().WriteHeader(http.StatusOK)
+
+	if err := uc.manager.ExportUsers(c.Request().Context(), query, format, view.Fields, c.Response()); err != nil {
+		log.Printf("Error exporting users: %v", err)
+	}
+	return nil
+}
+
+// SearchUsers ranks users against q. mode=autocomplete matches word
+// prefixes and tolerates typos, for type-ahead pickers; the default
+// fulltext mode matches whole words.
+func (uc *UserController) SearchUsers(c echo.Context) error {
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = service.SearchModeFullText
+	}
+
+	results, err := uc.manager.SearchUsers(service.UserSearch{
+		Query:          c.QueryParam("q"),
+		Mode:           mode,
+		Limit:          limit,
+		IncludeDeleted: c.QueryParam("include_deleted") == "true",
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid search") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Error searching users: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	return t.Format(time.RFC3339)
+	rendered := make([]map[string]interface{}, len(results))
+	for i, result := range results {
+		user, err := uc.expandUser(view, result.User)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		rendered[i] = map[string]interface{}{"score": result.Score, "user": user}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"query":   c.QueryParam("q"),
+		"mode":    mode,
+		"results": rendered,
+	})
 }
+
 func (uc *UserController) GetUserByID(c echo.Context) error {
 	id := c.Param("id")
+	view, err := userView(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-	user, err := uc.manager.GetUserByID(id)
+	user, err := uc.manager.GetUserByID(id, c.QueryParam("include_deleted") == "true")
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
 	}
 	//return c.JSON(http.StatusInternalServerError, map[string]string{"error":"Internal server error"})
 
-	return c.JSON(http.StatusOK, response.UserResponse{
-		ID:        user.Id,
-		Name:      user.Name,
-		Email:     user.Email,
-		Subjects:  user.Subjects,
-		CreatedAt: formatTime(user.CreatedAt),
-		UpdatedAt: formatTime(user.UpdatedAt),
-		DeletedAt: formatTime(user.DeletedAt),
-	})
+	setETag(c, user.Version)
+	return uc.renderUser(c, http.StatusOK, view, user)
+}
+
+// userExpanders load the related resources expand= can name. Each returns
+// the value rendered under its own key next to the user's fields.
+var userExpanders = map[string]func(uc *UserController, user model.User) (interface{}, error){
+	"enrollments": expandEnrollments,
+}
+
+// userView reads the fields= and expand= parameters every endpoint returning
+// users accepts.
+func userView(c echo.Context) (response.UserView, error) {
+	expandable := make([]string, 0, len(userExpanders))
+	for name := range userExpanders {
+		expandable = append(expandable, name)
+	}
+	return response.ParseUserView(c.QueryParam("fields"), c.QueryParam("expand"), expandable)
+}
+
+// expandUser maps user through the response mapper, loading whatever the
+// view expands.
+func (uc *UserController) expandUser(view response.UserView, user model.User) (interface{}, error) {
+	expanded := map[string]interface{}{}
+	for _, name := range view.Expand {
+		value, err := userExpanders[name](uc, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand %s: %v", name, err)
+		}
+		expanded[name] = value
+	}
+	return view.Render(user, expanded), nil
+}
+
+func (uc *UserController) renderUser(c echo.Context, status int, view response.UserView, user model.User) error {
+	rendered, err := uc.expandUser(view, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(status, rendered)
+}
 
+func (uc *UserController) renderUsers(view response.UserView, users []model.User) ([]interface{}, error) {
+	rendered := make([]interface{}, len(users))
+	for i, user := range users {
+		value, err := uc.expandUser(view, user)
+		if err != nil {
+			return nil, err
+		}
+		rendered[i] = value
+	}
+	return rendered, nil
+}
+
+// requestActor names who is making the request for the audit history: the
+// authenticated principal, or the X-Actor header when authentication is off.
+func requestActor(c echo.Context) string {
+	if principal, ok := auth.PrincipalFrom(c); ok {
+		return principal.Subject
+	}
+	if actor := strings.TrimSpace(c.Request().Header.Get("X-Actor")); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// setETag exposes the user's version as a strong entity tag.
+func setETag(c echo.Context, version int) {
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// parseIfMatch returns the versions named by an If-Match header, a comma
+// separated list of entity tags. any is true when the header is absent or
+// "*", so the update is unconditional. If-Match uses the strong comparison
+// (RFC 9110, section 13.1.1): weak tags never match and are left out, as are
+// tags that are not a version, so versions may be empty.
+func parseIfMatch(header string) (versions []int, any bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(unquoted); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	return versions, false
+}
+
+// ifMatchVersion resolves the If-Match header of a write to the version the
+// update must find, 0 for an unconditional one. ok is false when no tag in
+// the header can match, which fails the precondition. With several tags the
+// one naming the current version is used; the conditional update still
+// guards against a change in between.
+func (uc *UserController) ifMatchVersion(c echo.Context, id string) (version int, ok bool) {
+	versions, any := parseIfMatch(c.Request().Header.Get("If-Match"))
+	switch {
+	case any:
+		return 0, true
+	case len(versions) == 0:
+		return 0, false
+	case len(versions) == 1:
+		return versions[0], true
+	}
+
+	current, err := uc.manager.GetUserByID(id, false)
+	if err != nil {
+		// Let the update report the missing user.
+		return versions[0], true
+	}
+	for _, version := range versions {
+		if version == current.Version {
+			return version, true
+		}
+	}
+	return 0, false
 }
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"fitness-api/service"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type DualWriteController struct {
+	repo *service.DualWriteUserRepository
+}
+
+func NewDualWriteController(repo *service.DualWriteUserRepository) *DualWriteController {
+	return &DualWriteController{repo: repo}
+}
+
+func (dc *DualWriteController) GetStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, dc.repo.Stats())
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	manager "fitness-api/managers"
+	"fitness-api/request"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type SubjectController struct {
+	manager *manager.SubjectManager
+}
+
+func NewSubjectController(mn *manager.SubjectManager) *SubjectController {
+	return &SubjectController{manager: mn}
+}
+
+func (sc *SubjectController) CreateSubject(c echo.Context) error {
+	var req request.SubjectRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	subject, err := sc.manager.CreateSubject(req)
+	if err != nil {
+		return subjectError(c, err)
+	}
+	return c.JSON(http.StatusCreated, subject)
+}
+
+func (sc *SubjectController) UpdateSubject(c echo.Context) error {
+	var req request.SubjectRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	subject, err := sc.manager.UpdateSubject(c.Param("id"), req)
+	if err != nil {
+		return subjectError(c, err)
+	}
+	return c.JSON(http.StatusOK, subject)
+}
+
+func (sc *SubjectController) DeleteSubject(c echo.Context) error {
+	if err := sc.manager.DeleteSubject(c.Param("id")); err != nil {
+		return subjectError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (sc *SubjectController) GetSubject(c echo.Context) error {
+	subject, err := sc.manager.GetSubject(c.Param("id"))
+	if err != nil {
+		return subjectError(c, err)
+	}
+	return c.JSON(http.StatusOK, subject)
+}
+
+func (sc *SubjectController) ListSubjects(c echo.Context) error {
+	subjects, err := sc.manager.ListSubjects()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"subjects": subjects})
+}
+
+// RenameSubject renames or merges a subject across every user.
+func (sc *SubjectController) RenameSubject(c echo.Context) error {
+	var req request.SubjectRenameRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	rename, err := sc.manager.RenameSubject(req)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "failed to") {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return subjectError(c, err)
+	}
+	return c.JSON(http.StatusOK, rename)
+}
+
+func bindAndValidate(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	return validator.New().Struct(req)
+}
+
+func subjectError(c echo.Context, err error) error {
+	switch {
+	case strings.HasPrefix(err.Error(), "no subject found"):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case strings.Contains(err.Error(), "already exists"), strings.Contains(err.Error(), "still assigned"):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fitness-api/service"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetUserStats reports active and soft-deleted totals and the average number
+// of subjects per active user.
+func (uc *UserController) GetUserStats(c echo.Context) error {
+	query, err := statsQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	totals, err := uc.manager.CountUsers(query)
+	if err != nil {
+		return statsError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":  c.QueryParam("from"),
+		"to":    c.QueryParam("to"),
+		"users": totals,
+	})
+}
+
+// GetSubjectStats reports how many users have each subject. Soft-deleted
+// users are counted with include_deleted=true.
+func (uc *UserController) GetSubjectStats(c echo.Context) error {
+	query, err := statsQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	query.IncludeDeleted = c.QueryParam("include_deleted") == "true"
+
+	counts, err := uc.manager.CountUsersBySubject(query)
+	if err != nil {
+		return statsError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":     c.QueryParam("from"),
+		"to":       c.QueryParam("to"),
+		"subjects": counts,
+	})
+}
+
+// GetSignupStats reports new users per interval=day|week|month (default
+// day), bucketed in UTC.
+func (uc *UserController) GetSignupStats(c echo.Context) error {
+	query, err := statsQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = service.StatsIntervalDay
+	}
+
+	buckets, err := uc.manager.CountSignups(interval, query)
+	if err != nil {
+		return statsError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":     c.QueryParam("from"),
+		"to":       c.QueryParam("to"),
+		"interval": interval,
+		"signups":  buckets,
+	})
+}
+
+// statsQuery reads the from and to parameters bounding created_at. Each is
+// a date or an RFC 3339 timestamp; a date given as to includes that day.
+func statsQuery(c echo.Context) (service.UserStatsQuery, error) {
+	var query service.UserStatsQuery
+	var err error
+	if query.From, err = statsTime(c.QueryParam("from"), false); err != nil {
+		return query, fmt.Errorf("invalid from: %v", err)
+	}
+	if query.To, err = statsTime(c.QueryParam("to"), true); err != nil {
+		return query, fmt.Errorf("invalid to: %v", err)
+	}
+	return query, nil
+}
+
+func statsTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &t, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a date (2006-01-02) nor an RFC 3339 timestamp", value)
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return &day, nil
+}
+
+func statsError(c echo.Context, err error) error {
+	if strings.Contains(err.Error(), "invalid stats query") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
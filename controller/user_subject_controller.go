@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fitness-api/model"
+	"fitness-api/request"
+	"fitness-api/response"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetUserSubjects lists the user's subjects with their catalog details.
+func (uc *UserController) GetUserSubjects(c echo.Context) error {
+	user, err := uc.manager.GetUserByID(c.Param("id"), false)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	return uc.renderUserSubjects(c, http.StatusOK, user)
+}
+
+// EnrollUser adds the subject named in the body. It answers 201 when the
+// subject was added and 200 when the user already had it.
+func (uc *UserController) EnrollUser(c echo.Context) error {
+	var req request.EnrollmentRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user, changed, err := uc.manager.EnrollUser(c.Param("id"), req.Subject, requestActor(c))
+	if err != nil {
+		return enrollmentError(c, err)
+	}
+	status := http.StatusOK
+	if changed {
+		status = http.StatusCreated
+	}
+	return uc.renderUserSubjects(c, status, user)
+}
+
+func (uc *UserController) UnenrollUser(c echo.Context) error {
+	subject, err := url.PathUnescape(c.Param("subject"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject"})
+	}
+
+	user, err := uc.manager.UnenrollUser(c.Param("id"), subject, requestActor(c))
+	if err != nil {
+		return enrollmentError(c, err)
+	}
+	setETag(c, user.Version)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (uc *UserController) renderUserSubjects(c echo.Context, status int, user model.User) error {
+	catalog, err := uc.manager.EnrolledSubjects(user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	setETag(c, user.Version)
+	return c.JSON(status, response.NewUserSubjectsResponse(user, catalog))
+}
+
+// expandEnrollments renders expand=enrollments: the user's subjects with
+// their catalog details.
+func expandEnrollments(uc *UserController, user model.User) (interface{}, error) {
+	catalog, err := uc.manager.EnrolledSubjects(user)
+	if err != nil {
+		return nil, err
+	}
+	return response.NewEnrollmentResponses(user.Subjects, catalog), nil
+}
+
+func enrollmentError(c echo.Context, err error) error {
+	switch {
+	case strings.Contains(err.Error(), "no user found"), strings.Contains(err.Error(), "is not enrolled"):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case strings.Contains(err.Error(), "invalid subjects"):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	log.Printf("Error changing user subjects: %v", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	manager "fitness-api/managers"
+	"fitness-api/request"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type WebhookController struct {
+	manager *manager.WebhookManager
+}
+
+func NewWebhookController(mn *manager.WebhookManager) *WebhookController {
+	return &WebhookController{manager: mn}
+}
+
+func (wc *WebhookController) CreateWebhook(c echo.Context) error {
+	req, err := bindWebhookRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	webhook, err := wc.manager.CreateWebhook(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, webhook)
+}
+
+func (wc *WebhookController) UpdateWebhook(c echo.Context) error {
+	req, err := bindWebhookRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	webhook, err := wc.manager.UpdateWebhook(c.Param("id"), req)
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+func (wc *WebhookController) DeleteWebhook(c echo.Context) error {
+	if err := wc.manager.DeleteWebhook(c.Param("id")); err != nil {
+		return webhookError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (wc *WebhookController) GetWebhook(c echo.Context) error {
+	webhook, err := wc.manager.GetWebhook(c.Param("id"))
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+func (wc *WebhookController) ListWebhooks(c echo.Context) error {
+	webhooks, err := wc.manager.ListWebhooks()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"webhooks": webhooks})
+}
+
+func (wc *WebhookController) ListDeliveries(c echo.Context) error {
+	pageSizeInt, err := strconv.Atoi(c.QueryParam("per_page"))
+	if err != nil || pageSizeInt <= 0 {
+		pageSizeInt = 10
+	}
+	pageNoInt, err := strconv.Atoi(c.QueryParam("page_no"))
+	if err != nil || pageNoInt <= 0 {
+		pageNoInt = 1
+	}
+
+	deliveries, lastPage, totalDocuments, err := wc.manager.ListDeliveries(c.Param("id"), c.QueryParam("status"), pageSizeInt, pageNoInt)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"page_no":         pageNoInt,
+		"per_page":        pageSizeInt,
+		"last_page":       lastPage,
+		"total_documents": totalDocuments,
+		"deliveries":      deliveries,
+	})
+}
+
+func (wc *WebhookController) RetryDelivery(c echo.Context) error {
+	delivery, err := wc.manager.RetryDelivery(c.Request().Context(), c.Param("id"), c.Param("delivery_id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "only dead deliveries") || strings.Contains(err.Error(), "already being retried") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, delivery)
+}
+
+func bindWebhookRequest(c echo.Context) (request.WebhookRequest, error) {
+	var req request.WebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return req, err
+	}
+	return req, validator.New().Struct(req)
+}
+
+func webhookError(c echo.Context, err error) error {
+	if strings.HasPrefix(err.Error(), "no webhook found") || strings.HasPrefix(err.Error(), "no delivery found") {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
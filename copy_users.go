@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fitness-api/service"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// copyCheckpoint is persisted after every batch so an interrupted copy can
+// continue with -resume from the last id it handled.
+type copyCheckpoint struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	LastID    string    `json:"last_id"`
+	Copied    int       `json:"copied"`
+	Existing  int       `json:"existing"`
+	Conflicts int       `json:"conflicts"`
+	Invalid   int       `json:"invalid"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func runCopyUsers(args []string) error {
+	fs := flag.NewFlagSet("copy-users", flag.ContinueOnError)
+	from := fs.String("from", "", "source store: mongo or postgres")
+	to := fs.String("to", "", "destination store: mongo or postgres")
+	batchSize := fs.Int("batch-size", 500, "users read and written per batch (max 1000)")
+	checkpointPath := fs.String("checkpoint", "copy-users.checkpoint.json", "file that records progress")
+	resume := fs.Bool("resume", false, "continue from the checkpoint file")
+	dryRun := fs.Bool("dry-run", false, "report what would be copied without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == *to || !isTransferStore(*from) || !isTransferStore(*to) {
+		return fmt.Errorf("-from and -to must be different stores out of mongo, postgres")
+	}
+	if *batchSize <= 0 || *batchSize > 1000 {
+		return fmt.Errorf("-batch-size must be between 1 and 1000")
+	}
+
+	checkpoint := copyCheckpoint{From: *from, To: *to}
+	if *resume {
+		saved, err := loadCheckpoint(*checkpointPath)
+		if err != nil {
+			return err
+		}
+		if saved.From != *from || saved.To != *to {
+			return fmt.Errorf("checkpoint %s is for %s -> %s", *checkpointPath, saved.From, saved.To)
+		}
+		checkpoint = saved
+		fmt.Printf("Resuming after id %s\n", checkpoint.LastID)
+	}
+
+	source, _ := openTransferStore(*from)
+	destination, migrator := openTransferStore(*to)
+	ctx := context.Background()
+
+	if !*dryRun {
+		if _, err := migrator.Up(ctx); err != nil {
+			return fmt.Errorf("failed to prepare %s schema: %v", *to, err)
+		}
+	}
+
+	for {
+		users, err := source.UsersAfter(ctx, checkpoint.LastID, *batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read from %s: %v", *from, err)
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		results, err := destination.InsertUsers(ctx, users, *dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to write to %s after id %s: %v", *to, checkpoint.LastID, err)
+		}
+
+		for _, result := range results {
+			switch result.Status {
+			case service.InsertCreated:
+				checkpoint.Copied++
+			case service.InsertExists:
+				checkpoint.Existing++
+			case service.InsertDuplicateEmail:
+				checkpoint.Conflicts++
+				fmt.Printf("conflict: user %s email %s is already used by %s in %s\n", result.Id, result.Email, result.ConflictId, *to)
+			case service.InsertInvalid:
+				checkpoint.Invalid++
+				fmt.Printf("invalid: user %q email %q cannot be stored in %s\n", result.Id, result.Email, *to)
+			}
+		}
+		checkpoint.LastID = users[len(users)-1].Id
+
+		if !*dryRun {
+			if err := saveCheckpoint(*checkpointPath, checkpoint); err != nil {
+				return err
+			}
+		}
+		log.Printf("Processed batch of %d users up to id %s", len(users), checkpoint.LastID)
+	}
+
+	verb := "Copied"
+	if *dryRun {
+		verb = "Would copy"
+	}
+	fmt.Printf("%s %d user(s) from %s to %s; %d already present, %d email conflict(s), %d invalid\n",
+		verb, checkpoint.Copied, *from, *to, checkpoint.Existing, checkpoint.Conflicts, checkpoint.Invalid)
+	return nil
+}
+
+func isTransferStore(name string) bool {
+	return name == "mongo" || name == "postgres"
+}
+
+func loadCheckpoint(path string) (copyCheckpoint, error) {
+	var checkpoint copyCheckpoint
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, fmt.Errorf("no checkpoint found at %s", path)
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("failed to parse checkpoint %s: %v", path, err)
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint writes through a temporary file so a crash mid-write never
+// leaves a truncated checkpoint behind.
+func saveCheckpoint(path string, checkpoint copyCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	return nil
+}
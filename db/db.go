@@ -11,15 +11,17 @@ import (
 	_ "github.com/lib/pq"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	_ "modernc.org/sqlite"
 )
 
 var (
 	postgresDB *sql.DB
 	mongoDB    *mongo.Client
+	sqliteDB   *sql.DB
 )
 
 func InitPostgresDB() error {
-	
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
@@ -46,18 +48,12 @@ func InitPostgresDB() error {
 	if err != nil {
 		return err
 	}
-	err = ExistsTable(postgresDB)
-	if err != nil {
-		return fmt.Errorf("failed to ensure table exists: %v", err)
-	}
-
 	fmt.Println("Successfully connected to PostgreSQL")
 	return nil
 }
 
-
 func InitMongoDB() error {
-	
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
@@ -91,29 +87,40 @@ func GetMongoDB() (*mongo.Client, error) {
 	return mongoDB, nil
 }
 
-
 func GetPostgresDB() *sql.DB {
 	return postgresDB
 }
 
-func ExistsTable(db *sql.DB) error {
-
-	createTableSQL := `
-	 CREATE TABLE IF NOT EXISTS users (
-        id SERIAL PRIMARY KEY,
-        name VARCHAR(100),
-        email VARCHAR(100) UNIQUE NOT NULL,
-        subjects TEXT[],
-        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-        deleted_at TIMESTAMP
-    );
-    `
-	_, err := db.Exec(createTableSQL)
+func InitSQLiteDB() error {
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment")
+	}
+
+	dbPath := os.Getenv("SQLITE_PATH")
+	if dbPath == "" {
+		dbPath = "fitness.db"
+	}
+
+	// _time_format=sqlite stores timestamps as "2006-01-02 15:04:05-07:00";
+	// the driver's default, time.Time.String, cannot be read back when the
+	// zone has no name, as with imported timestamps carrying an offset.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite")
 	if err != nil {
-		log.Printf("Error user table%v\n", err)
-		return fmt.Errorf("failed to create table:%v", err)
+		return err
+	}
+	// SQLite allows a single writer, so serialise access through one connection.
+	db.SetMaxOpenConns(1)
 
+	if err := db.Ping(); err != nil {
+		return err
 	}
+
+	sqliteDB = db
+	log.Printf("Connected to SQLite at %s", dbPath)
 	return nil
 }
+
+func GetSQLiteDB() *sql.DB {
+	return sqliteDB
+}
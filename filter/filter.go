@@ -0,0 +1,413 @@
+// Package filter parses the query language accepted by the filter parameter
+// of the users listing, for example
+//
+//	subjects:any(yoga,pilates) AND created_at>=2025-01-01
+//	(name:prefix(ann) OR email:icontains(@example.com)) AND NOT deleted:true
+//
+// Conditions are combined with AND, OR and NOT (AND binds tighter than OR)
+// and grouped with parentheses. The supported conditions are:
+//
+//	name, email        :value or :eq(v)  exact match
+//	                   :prefix(v), :contains(v)
+//	                   :ieq(v), :iprefix(v), :icontains(v)  case-insensitive
+//	subjects           :value or :any(a,b,...)  has at least one of them
+//	                   :all(a,b,...)  has every one of them
+//	created_at,        =, >, >=, <, <= followed by a date (2025-01-01) or an
+//	updated_at         RFC 3339 timestamp; a date stands for the whole day
+//	deleted            :true or :false
+//
+// Values that contain spaces, commas, parentheses or quotes must be double
+// quoted, with \" and \\ as escapes.
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed filter: an And, Or, Not or Condition.
+type Expr interface {
+	isExpr()
+}
+
+type And struct{ Terms []Expr }
+type Or struct{ Terms []Expr }
+type Not struct{ Term Expr }
+
+// Condition tests one field. Values holds the strings to match for text and
+// subject conditions; Time holds the instant for timestamp comparisons and
+// Deleted the wanted state for the deleted field.
+type Condition struct {
+	Field   string
+	Op      Op
+	Values  []string
+	Time    time.Time
+	Deleted bool
+}
+
+func (And) isExpr()       {}
+func (Or) isExpr()        {}
+func (Not) isExpr()       {}
+func (Condition) isExpr() {}
+
+type Op string
+
+const (
+	OpEq         Op = "eq"
+	OpPrefix     Op = "prefix"
+	OpContains   Op = "contains"
+	OpIEq        Op = "ieq"
+	OpIPrefix    Op = "iprefix"
+	OpIContains  Op = "icontains"
+	OpAny        Op = "any"
+	OpAll        Op = "all"
+	OpBefore     Op = "<"
+	OpAtOrBefore Op = "<="
+	OpAfter      Op = ">"
+	OpAtOrAfter  Op = ">="
+	OpAt         Op = "="
+	OpIs         Op = "is"
+)
+
+const (
+	FieldName      = "name"
+	FieldEmail     = "email"
+	FieldSubjects  = "subjects"
+	FieldCreatedAt = "created_at"
+	FieldUpdatedAt = "updated_at"
+	FieldDeleted   = "deleted"
+)
+
+// maxDepth bounds nesting so a hostile filter cannot exhaust the stack.
+const maxDepth = 32
+
+// References reports whether expr tests field anywhere.
+func References(expr Expr, field string) bool {
+	switch e := expr.(type) {
+	case And:
+		for _, term := range e.Terms {
+			if References(term, field) {
+				return true
+			}
+		}
+	case Or:
+		for _, term := range e.Terms {
+			if References(term, field) {
+				return true
+			}
+		}
+	case Not:
+		return References(e.Term, field)
+	case Condition:
+		return e.Field == field
+	}
+	return false
+}
+
+// Parse parses a filter expression. An empty string yields a nil Expr,
+// which matches everything.
+func Parse(input string) (Expr, error) {
+	p := &parser{input: input}
+	p.skipSpace()
+	if p.done() {
+		return nil, nil
+	}
+	expr, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.rest())
+	}
+	return expr, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid filter at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.input) }
+
+func (p *parser) rest() string {
+	rest := p.input[p.pos:]
+	if len(rest) > 20 {
+		rest = rest[:20] + "..."
+	}
+	return rest
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t' || p.input[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// keyword consumes word if it comes next as a whole word, in any case.
+func (p *parser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.input) && isWordByte(p.input[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *parser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr(depth int) (Expr, error) {
+	var terms []Expr
+	for {
+		term, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.keyword("OR") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return Or{Terms: terms}, nil
+}
+
+func (p *parser) parseAnd(depth int) (Expr, error) {
+	var terms []Expr
+	for {
+		term, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.keyword("AND") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return And{Terms: terms}, nil
+}
+
+func (p *parser) parseUnary(depth int) (Expr, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("nested too deeply")
+	}
+	if p.keyword("NOT") {
+		term, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Term: term}, nil
+	}
+	if p.consume("(") {
+		expr, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("missing )")
+		}
+		return expr, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *parser) parseCondition() (Expr, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.done() && isWordByte(p.input[p.pos]) {
+		p.pos++
+	}
+	field := strings.ToLower(p.input[start:p.pos])
+	if field == "" {
+		if p.done() {
+			return nil, p.errorf("expected a condition")
+		}
+		return nil, p.errorf("expected a field name, got %q", p.rest())
+	}
+
+	switch field {
+	case FieldName, FieldEmail, FieldSubjects, FieldDeleted:
+		if !p.consume(":") {
+			return nil, p.errorf("expected : after %s", field)
+		}
+		op, values, err := p.parseMatch()
+		if err != nil {
+			return nil, err
+		}
+		return newMatchCondition(p, field, op, values)
+	case FieldCreatedAt, FieldUpdatedAt:
+		return p.parseTimeCondition(field)
+	default:
+		p.pos = start
+		return nil, p.errorf("unknown field %q", field)
+	}
+}
+
+// parseMatch reads what follows the colon: either a bare or quoted value,
+// or an operator applied to a parenthesised list of values.
+func (p *parser) parseMatch() (Op, []string, error) {
+	start := p.pos
+	for !p.done() && isWordByte(p.input[p.pos]) {
+		p.pos++
+	}
+	if name := strings.ToLower(p.input[start:p.pos]); name != "" && !p.done() && p.input[p.pos] == '(' {
+		p.pos++
+		var values []string
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return "", nil, err
+			}
+			values = append(values, value)
+			if p.consume(")") {
+				return Op(name), values, nil
+			}
+			if !p.consume(",") {
+				return "", nil, p.errorf("expected , or ) in %s(...)", name)
+			}
+		}
+	}
+
+	p.pos = start
+	value, err := p.parseValue()
+	if err != nil {
+		return "", nil, err
+	}
+	return "", []string{value}, nil
+}
+
+func newMatchCondition(p *parser, field string, op Op, values []string) (Expr, error) {
+	switch field {
+	case FieldName, FieldEmail:
+		switch op {
+		case "":
+			op = OpEq
+		case OpEq, OpPrefix, OpContains, OpIEq, OpIPrefix, OpIContains:
+		default:
+			return nil, p.errorf("%s does not support %s()", field, op)
+		}
+		if len(values) != 1 {
+			return nil, p.errorf("%s:%s() takes one value", field, op)
+		}
+	case FieldSubjects:
+		switch op {
+		case "":
+			op = OpAny
+		case OpAny, OpAll:
+		default:
+			return nil, p.errorf("subjects supports any() and all(), not %s()", op)
+		}
+	case FieldDeleted:
+		if op != "" || len(values) != 1 || (values[0] != "true" && values[0] != "false") {
+			return nil, p.errorf("deleted must be true or false")
+		}
+		return Condition{Field: field, Op: OpIs, Deleted: values[0] == "true"}, nil
+	}
+	return Condition{Field: field, Op: op, Values: values}, nil
+}
+
+func (p *parser) parseTimeCondition(field string) (Expr, error) {
+	var op Op
+	for _, candidate := range []Op{OpAtOrAfter, OpAtOrBefore, OpAfter, OpBefore, OpAt} {
+		if p.consume(string(candidate)) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf("%s must be followed by =, >, >=, < or <=", field)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return Condition{Field: field, Op: op, Time: at}, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, p.errorf("%s needs a date (2006-01-02) or an RFC 3339 timestamp, got %q", field, value)
+	}
+
+	// A date covers the whole day, midnight UTC to midnight UTC.
+	nextDay := day.AddDate(0, 0, 1)
+	switch op {
+	case OpAt:
+		return And{Terms: []Expr{
+			Condition{Field: field, Op: OpAtOrAfter, Time: day},
+			Condition{Field: field, Op: OpBefore, Time: nextDay},
+		}}, nil
+	case OpAfter:
+		return Condition{Field: field, Op: OpAtOrAfter, Time: nextDay}, nil
+	case OpAtOrBefore:
+		return Condition{Field: field, Op: OpBefore, Time: nextDay}, nil
+	default:
+		return Condition{Field: field, Op: op, Time: day}, nil
+	}
+}
+
+// parseValue reads a double-quoted string or a bare value running up to
+// the next space, comma or parenthesis.
+func (p *parser) parseValue() (string, error) {
+	p.skipSpace()
+	if p.done() {
+		return "", p.errorf("expected a value")
+	}
+
+	if p.input[p.pos] != '"' {
+		start := p.pos
+		for !p.done() && !strings.ContainsRune(" \t\n,()\"", rune(p.input[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			return "", p.errorf("expected a value, got %q", p.rest())
+		}
+		return p.input[start:p.pos], nil
+	}
+
+	p.pos++
+	var value strings.Builder
+	for !p.done() {
+		c := p.input[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return value.String(), nil
+		case '\\':
+			if p.done() {
+				return "", p.errorf("unterminated string")
+			}
+			value.WriteByte(p.input[p.pos])
+			p.pos++
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,137 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+	instant := time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  Expr
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "blank", input: "  \t", want: nil},
+		{name: "bare value is eq", input: "name:ann", want: Condition{Field: FieldName, Op: OpEq, Values: []string{"ann"}}},
+		{name: "field and keyword case", input: "EMAIL:icontains(@Example.com)", want: Condition{Field: FieldEmail, Op: OpIContains, Values: []string{"@Example.com"}}},
+		{name: "quoted value", input: `name:"Ann \"A\" Lee, Jr\\"`, want: Condition{Field: FieldName, Op: OpEq, Values: []string{`Ann "A" Lee, Jr\`}}},
+		{name: "bare subject is any", input: "subjects:yoga", want: Condition{Field: FieldSubjects, Op: OpAny, Values: []string{"yoga"}}},
+		{name: "subjects all", input: "subjects:all(yoga, pilates)", want: Condition{Field: FieldSubjects, Op: OpAll, Values: []string{"yoga", "pilates"}}},
+		{name: "deleted", input: "deleted:true", want: Condition{Field: FieldDeleted, Op: OpIs, Deleted: true}},
+		{name: "timestamp", input: "updated_at<2025-01-01T10:30:00Z", want: Condition{Field: FieldUpdatedAt, Op: OpBefore, Time: instant}},
+		{name: "date at or after", input: "created_at>=2025-01-01", want: Condition{Field: FieldCreatedAt, Op: OpAtOrAfter, Time: day}},
+		{name: "date after skips the day", input: "created_at>2025-01-01", want: Condition{Field: FieldCreatedAt, Op: OpAtOrAfter, Time: nextDay}},
+		{name: "date at or before includes the day", input: "created_at<=2025-01-01", want: Condition{Field: FieldCreatedAt, Op: OpBefore, Time: nextDay}},
+		{
+			name:  "date equals covers the day",
+			input: "created_at=2025-01-01",
+			want: And{Terms: []Expr{
+				Condition{Field: FieldCreatedAt, Op: OpAtOrAfter, Time: day},
+				Condition{Field: FieldCreatedAt, Op: OpBefore, Time: nextDay},
+			}},
+		},
+		{
+			name:  "and binds tighter than or",
+			input: "name:a OR name:b AND deleted:false",
+			want: Or{Terms: []Expr{
+				Condition{Field: FieldName, Op: OpEq, Values: []string{"a"}},
+				And{Terms: []Expr{
+					Condition{Field: FieldName, Op: OpEq, Values: []string{"b"}},
+					Condition{Field: FieldDeleted, Op: OpIs},
+				}},
+			}},
+		},
+		{
+			name:  "parentheses and not",
+			input: "(name:prefix(ann) or email:eq(x@y.z)) and not deleted:true",
+			want: And{Terms: []Expr{
+				Or{Terms: []Expr{
+					Condition{Field: FieldName, Op: OpPrefix, Values: []string{"ann"}},
+					Condition{Field: FieldEmail, Op: OpEq, Values: []string{"x@y.z"}},
+				}},
+				Not{Term: Condition{Field: FieldDeleted, Op: OpIs, Deleted: true}},
+			}},
+		},
+		{
+			name:  "keyword prefix is a value",
+			input: "name:ORACLE",
+			want:  Condition{Field: FieldName, Op: OpEq, Values: []string{"ORACLE"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "unknown field", input: "age:3", err: `unknown field "age"`},
+		{name: "missing colon", input: "name ann", err: "expected : after name"},
+		{name: "unsupported text op", input: "name:any(a)", err: "name does not support any()"},
+		{name: "text op takes one value", input: "email:prefix(a,b)", err: "takes one value"},
+		{name: "unsupported subjects op", input: "subjects:prefix(yo)", err: "subjects supports any() and all()"},
+		{name: "bad deleted", input: "deleted:maybe", err: "deleted must be true or false"},
+		{name: "time needs operator", input: "created_at:2025-01-01", err: "must be followed by"},
+		{name: "bad date", input: "created_at>=yesterday", err: "needs a date"},
+		{name: "missing paren", input: "(name:a", err: "missing )"},
+		{name: "unclosed list", input: "subjects:any(a b)", err: "expected , or )"},
+		{name: "unterminated string", input: `name:"ann`, err: "unterminated string"},
+		{name: "dangling and", input: "name:a AND", err: "expected a condition"},
+		{name: "trailing input", input: "name:a name:b", err: "unexpected"},
+		{name: "too deep", input: strings.Repeat("NOT ", maxDepth+2) + "deleted:true", err: "nested too deeply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Parse(%q) error = %v, want one containing %q", tt.input, err, tt.err)
+			}
+			if !strings.HasPrefix(err.Error(), "invalid filter at position ") {
+				t.Errorf("Parse(%q) error = %q, want it to give a position", tt.input, err)
+			}
+		})
+	}
+}
+
+func TestReferences(t *testing.T) {
+	expr, err := Parse("name:a OR (NOT deleted:true AND subjects:yoga)")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{FieldName, true},
+		{FieldDeleted, true},
+		{FieldSubjects, true},
+		{FieldEmail, false},
+		{FieldCreatedAt, false},
+	}
+	for _, tt := range tests {
+		if got := References(expr, tt.field); got != tt.want {
+			t.Errorf("References(%s) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"fitness-api/auth"
 	"fitness-api/config"
 	controller "fitness-api/controller"
-	"fitness-api/db"
 	manager "fitness-api/managers"
-	"fmt"
+	"fitness-api/service"
 	"log"
+	"os"
 
 	"github.com/labstack/echo/v4"
 )
@@ -18,31 +19,82 @@ func main() {
 		log.Fatalf("Error loading flag config: %v", err)
 	}
 
-	if flagConfig.FlagValue == "TRUE" {
-
-		fmt.Println("MongoDB URL:", flagConfig.FlagValue)
-		if err := db.InitMongoDB(); err != nil {
-			log.Fatalf("Failed to initialize MongoDB: %v", err)
+	if len(os.Args) > 1 {
+		if err := runCommand(flagConfig, os.Args[1:]); err != nil {
+			log.Fatal(err)
 		}
-		fmt.Println("MongoDB Initialized")
-	} else {
+		return
+	}
 
-		if err := db.InitPostgresDB(); err != nil {
-			log.Fatalf("Failed to initialize PostgreSQL: %v", err)
-		}
-		fmt.Println("PostgreSQL Initialized")
+	userRepo, migrator := connectBackend(flagConfig)
+
+	if flagConfig.AutoMigrate == "TRUE" {
+		autoMigrate(migrator)
 	}
 
-	userManager := manager.NewUserManager()
+	stores := connectStores(flagConfig)
+	webhookDispatcher := newWebhookDispatcher(flagConfig, stores.webhooks)
+	startOutboxRelay(flagConfig, userRepo, webhookDispatcher)
+
+	userManager := manager.NewUserManager(userRepo, stores.subjects)
 	userController := controller.NewUserController(userManager)
+	subjectController := controller.NewSubjectController(manager.NewSubjectManager(stores.subjects, userRepo))
+	webhookController := controller.NewWebhookController(manager.NewWebhookManager(stores.webhooks, webhookDispatcher))
+
+	apiKeyManager := manager.NewAPIKeyManager(stores.apiKeys)
+	apiKeyController := controller.NewAPIKeyController(apiKeyManager)
 
 	e := echo.New()
+	if authMiddleware := newAuthMiddleware(flagConfig, apiKeyManager); authMiddleware != nil {
+		e.Use(authMiddleware)
+	}
+	requireAdmin := auth.RequireScope(auth.ScopeAdmin)
+	requireAPIKeysAdmin := auth.RequireScope(auth.ScopeAPIKeysAdmin)
 
 	e.POST("/users", userController.CreateUser)
 	e.GET("/users", userController.GetAllUsers)
+	e.POST("/users/import", userController.ImportUsers)
+	e.GET("/users/export", userController.ExportUsers)
+	e.GET("/users/search", userController.SearchUsers)
 	e.PUT("/users/:id", userController.UpdateUser)
+	e.PATCH("/users/:id", userController.PatchUser)
 	e.GET("/users/:id", userController.GetUserByID)
 	e.DELETE("/users/:id", userController.DeleteUser)
+	e.POST("/users/:id/restore", userController.RestoreUser)
+	e.GET("/users/:id/history", userController.GetUserHistory)
+	e.GET("/users/:id/subjects", userController.GetUserSubjects)
+	e.POST("/users/:id/subjects", userController.EnrollUser)
+	e.DELETE("/users/:id/subjects/:subject", userController.UnenrollUser)
+	e.POST("/admin/users/purge", userController.PurgeDeletedUsers, requireAdmin)
+
+	e.POST("/webhooks", webhookController.CreateWebhook, requireAdmin)
+	e.GET("/webhooks", webhookController.ListWebhooks, requireAdmin)
+	e.GET("/webhooks/:id", webhookController.GetWebhook, requireAdmin)
+	e.PUT("/webhooks/:id", webhookController.UpdateWebhook, requireAdmin)
+	e.DELETE("/webhooks/:id", webhookController.DeleteWebhook, requireAdmin)
+	e.GET("/webhooks/:id/deliveries", webhookController.ListDeliveries, requireAdmin)
+	e.POST("/webhooks/:id/deliveries/:delivery_id/retry", webhookController.RetryDelivery, requireAdmin)
+
+	e.GET("/stats/users", userController.GetUserStats)
+	e.GET("/stats/subjects", userController.GetSubjectStats)
+	e.GET("/stats/signups", userController.GetSignupStats)
+
+	e.POST("/subjects", subjectController.CreateSubject, requireAdmin)
+	e.GET("/subjects", subjectController.ListSubjects)
+	e.GET("/subjects/:id", subjectController.GetSubject)
+	e.PUT("/subjects/:id", subjectController.UpdateSubject, requireAdmin)
+	e.DELETE("/subjects/:id", subjectController.DeleteSubject, requireAdmin)
+	e.POST("/admin/subjects/rename", subjectController.RenameSubject, requireAdmin)
+
+	e.POST("/api-keys", apiKeyController.CreateAPIKey, requireAPIKeysAdmin)
+	e.GET("/api-keys", apiKeyController.ListAPIKeys, requireAPIKeysAdmin)
+	e.GET("/api-keys/:id", apiKeyController.GetAPIKey, requireAPIKeysAdmin)
+	e.DELETE("/api-keys/:id", apiKeyController.RevokeAPIKey, requireAPIKeysAdmin)
+
+	if dualWriteRepo, ok := userRepo.(*service.DualWriteUserRepository); ok {
+		dualWriteController := controller.NewDualWriteController(dualWriteRepo)
+		e.GET("/admin/dual-write/stats", dualWriteController.GetStats, requireAdmin)
+	}
 
 	e.Logger.Fatal(e.Start(":8081"))
 }
@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fitness-api/auth"
+	"fitness-api/model"
+	"fitness-api/request"
+	"fitness-api/service"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyPrefix starts every key so leaked keys are easy to scan for.
+	apiKeyPrefix = "fit_"
+	// apiKeyShownLength is how much of a key is kept in clear as its prefix.
+	apiKeyShownLength = 12
+	// apiKeyTouchInterval limits last-used writes to one per key per
+	// interval, so last_used_at is accurate to about a minute.
+	apiKeyTouchInterval = time.Minute
+)
+
+type APIKeyManager struct {
+	repo service.APIKeyRepository
+}
+
+func NewAPIKeyManager(repo service.APIKeyRepository) *APIKeyManager {
+	return &APIKeyManager{repo: repo}
+}
+
+// CreatedAPIKey is a new key together with its secret, which is only ever
+// returned here.
+type CreatedAPIKey struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey issues a key. An authenticated caller, whether it holds a
+// token or an API key, can only grant scopes it holds itself; creator is nil
+// only for the create-api-key command, which may grant any scope.
+func (km *APIKeyManager) CreateAPIKey(req request.APIKeyRequest, creator *auth.Principal, createdBy string) (CreatedAPIKey, error) {
+	now := time.Now().UTC()
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if contains(scopes, scope) {
+			continue
+		}
+		scopes = append(scopes, scope)
+		if strings.ContainsAny(scope, " \t\r\n") {
+			return CreatedAPIKey{}, fmt.Errorf("invalid scope %q: scopes cannot contain whitespace", scope)
+		}
+		if creator != nil && !creator.HasScope(scope) {
+			return CreatedAPIKey{}, fmt.Errorf("cannot grant scope %q: the caller does not have it", scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return CreatedAPIKey{}, fmt.Errorf("expires_at must be in the future")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return CreatedAPIKey{}, fmt.Errorf("failed to generate API key: %v", err)
+	}
+	plain := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := model.APIKey{
+		Name:      req.Name,
+		Prefix:    plain[:apiKeyShownLength],
+		KeyHash:   hashAPIKey(plain),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	created, err := km.repo.CreateAPIKey(key)
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+	log.Printf("API key %s (%s) created by %s", created.Id, created.Name, createdBy)
+	return CreatedAPIKey{APIKey: created, Key: plain}, nil
+}
+
+func (km *APIKeyManager) GetAPIKey(id string) (model.APIKey, error) {
+	return km.repo.GetAPIKey(id)
+}
+
+func (km *APIKeyManager) ListAPIKeys() ([]model.APIKey, error) {
+	return km.repo.ListAPIKeys()
+}
+
+// RevokeAPIKey stops the key from authenticating. The key stays listed.
+func (km *APIKeyManager) RevokeAPIKey(id string, revokedBy string) (model.APIKey, error) {
+	key, err := km.repo.RevokeAPIKey(id, time.Now().UTC())
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	log.Printf("API key %s (%s) revoked by %s", key.Id, key.Name, revokedBy)
+	return key, nil
+}
+
+// AuthenticateAPIKey implements auth.APIKeyAuthenticator. The principal's
+// subject is "api-key:<id>", which is what the audit history records.
+func (km *APIKeyManager) AuthenticateAPIKey(plain string) (*auth.Principal, error) {
+	if !strings.HasPrefix(plain, apiKeyPrefix) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	key, err := km.repo.GetAPIKeyByHash(hashAPIKey(plain))
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "no API key found") {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: the key has been revoked", auth.ErrInvalidAPIKey)
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: the key has expired", auth.ErrInvalidAPIKey)
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := km.repo.TouchAPIKey(key.Id, now); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", key.Id, err)
+		}
+	}
+
+	return &auth.Principal{
+		Subject:   "api-key:" + key.Id,
+		Scopes:    key.Scopes,
+		Method:    auth.MethodAPIKey,
+		ExpiresAt: key.ExpiresAt,
+	}, nil
+}
+
+// hashAPIKey returns the stored form of a key. Keys carry 256 random bits,
+// so a plain SHA-256 is enough; there is nothing to brute force.
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"context"
+	"fitness-api/model"
+	"fitness-api/request"
+	"fitness-api/service"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// slugPattern is the shape of a new slug: lower-case words of letters and
+// digits joined by hyphens. Slugs seeded from existing users may predate it.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type SubjectManager struct {
+	repo  service.SubjectRepository
+	users service.UserRepository
+}
+
+func NewSubjectManager(repo service.SubjectRepository, users service.UserRepository) *SubjectManager {
+	return &SubjectManager{repo: repo, users: users}
+}
+
+func (sm *SubjectManager) CreateSubject(req request.SubjectRequest) (model.Subject, error) {
+	if !slugPattern.MatchString(req.Slug) {
+		return model.Subject{}, fmt.Errorf("invalid slug %q: use lower-case letters, digits and hyphens", req.Slug)
+	}
+
+	now := time.Now().UTC()
+	subject := model.Subject{
+		Slug:        req.Slug,
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	return sm.repo.CreateSubject(subject)
+}
+
+// UpdateSubject replaces the subject's display name, description and, when
+// given, active flag. The slug is what users store, so changing it goes
+// through RenameSubject instead.
+func (sm *SubjectManager) UpdateSubject(id string, req request.SubjectRequest) (model.Subject, error) {
+	subject, err := sm.repo.GetSubject(id)
+	if err != nil {
+		return model.Subject{}, err
+	}
+	if req.Slug != subject.Slug {
+		return model.Subject{}, fmt.Errorf("slug cannot be changed here, rename the subject instead")
+	}
+
+	subject.DisplayName = req.DisplayName
+	subject.Description = req.Description
+	if req.Active != nil {
+		subject.Active = *req.Active
+	}
+	subject.UpdatedAt = time.Now().UTC()
+	return sm.repo.UpdateSubject(subject)
+}
+
+// DeleteSubject removes a subject no user has, deleted users included.
+// Subjects still in use can be deactivated or merged into another.
+func (sm *SubjectManager) DeleteSubject(id string) error {
+	subject, err := sm.repo.GetSubject(id)
+	if err != nil {
+		return err
+	}
+	assigned, err := sm.countUsers(subject.Slug)
+	if err != nil {
+		return err
+	}
+	if assigned > 0 {
+		return fmt.Errorf("subject %s is still assigned to %d user(s)", subject.Slug, assigned)
+	}
+	return sm.repo.DeleteSubject(id)
+}
+
+func (sm *SubjectManager) GetSubject(id string) (model.Subject, error) {
+	return sm.repo.GetSubject(id)
+}
+
+func (sm *SubjectManager) ListSubjects() ([]model.Subject, error) {
+	return sm.repo.ListSubjects()
+}
+
+// SubjectRename reports the outcome of RenameSubject. Merged is set when To
+// was already in the catalog and From was folded into it.
+type SubjectRename struct {
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	Merged       bool          `json:"merged"`
+	UsersUpdated int           `json:"users_updated"`
+	Subject      model.Subject `json:"subject"`
+}
+
+// RenameSubject replaces the subject From with To on every user, then
+// brings the catalog in line: From's entry takes the new slug, or is
+// dropped when To already exists. From need not be in the catalog, so stray
+// values left on users can be cleaned up too.
+//
+// Users are rewritten before the catalog changes. If the catalog update
+// fails the rename can simply be repeated, as no user has From any more.
+func (sm *SubjectManager) RenameSubject(req request.SubjectRenameRequest) (SubjectRename, error) {
+	from, to := req.From, strings.TrimSpace(req.To)
+	if from == to {
+		return SubjectRename{}, fmt.Errorf("invalid rename: from and to are the same")
+	}
+
+	catalog, err := sm.repo.ListSubjects()
+	if err != nil {
+		return SubjectRename{}, err
+	}
+	source, hasSource := findSubject(catalog, from)
+	target, hasTarget := findSubject(catalog, to)
+	if !hasTarget && !slugPattern.MatchString(to) {
+		return SubjectRename{}, fmt.Errorf("invalid rename: slug %q must use lower-case letters, digits and hyphens", to)
+	}
+	if !hasSource {
+		assigned, err := sm.countUsers(from)
+		if err != nil {
+			return SubjectRename{}, err
+		}
+		if assigned == 0 {
+			return SubjectRename{}, fmt.Errorf("no subject found with slug %s", from)
+		}
+	}
+
+	now := time.Now().UTC()
+	replaced, err := sm.users.ReplaceSubject(context.Background(), from, to, now)
+	if err != nil {
+		return SubjectRename{}, err
+	}
+
+	rename := SubjectRename{From: from, To: to, Merged: hasTarget, UsersUpdated: replaced}
+	switch {
+	case hasTarget:
+		if hasSource {
+			if err := sm.repo.DeleteSubject(source.Id); err != nil {
+				return SubjectRename{}, err
+			}
+		}
+		rename.Subject = target
+	case hasSource:
+		source.Slug = to
+		source.UpdatedAt = now
+		if rename.Subject, err = sm.repo.UpdateSubject(source); err != nil {
+			return SubjectRename{}, err
+		}
+	default:
+		created, err := sm.repo.CreateSubject(model.Subject{Slug: to, DisplayName: to, Active: true, CreatedAt: now, UpdatedAt: now})
+		if err != nil {
+			return SubjectRename{}, err
+		}
+		rename.Subject = created
+	}
+
+	log.Printf("Renamed subject %s to %s on %d user(s), merged: %t", from, to, replaced, hasTarget)
+	return rename, nil
+}
+
+func (sm *SubjectManager) countUsers(slug string) (int, error) {
+	_, _, assigned, err := sm.users.GetAllUsers(service.UserQuery{PageSize: 1, PageNo: 1, Subject: slug, IncludeDeleted: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users with subject %s: %v", slug, err)
+	}
+	return assigned, nil
+}
+
+func findSubject(catalog []model.Subject, slug string) (model.Subject, bool) {
+	for _, subject := range catalog {
+		if subject.Slug == slug {
+			return subject, true
+		}
+	}
+	return model.Subject{}, false
+}
+
+// subjectCatalog checks the subjects given for a user against the catalog.
+type subjectCatalog []model.Subject
+
+// resolve maps each subject to its catalog slug, matching case-insensitively
+// when the spelling is unambiguous, and drops repeats. Inactive subjects are
+// only accepted when the user already has them.
+func (c subjectCatalog) resolve(subjects []string, current []string) ([]string, error) {
+	if subjects == nil {
+		return nil, nil
+	}
+
+	resolved := make([]string, 0, len(subjects))
+	for _, given := range subjects {
+		subject, ok := c.lookup(strings.TrimSpace(given))
+		if !ok {
+			return nil, fmt.Errorf("invalid subjects: unknown subject %q", given)
+		}
+		if !subject.Active && !contains(current, subject.Slug) {
+			return nil, fmt.Errorf("invalid subjects: subject %q is inactive", subject.Slug)
+		}
+		if !contains(resolved, subject.Slug) {
+			resolved = append(resolved, subject.Slug)
+		}
+	}
+	return resolved, nil
+}
+
+func (c subjectCatalog) lookup(given string) (model.Subject, bool) {
+	if subject, ok := findSubject(c, given); ok {
+		return subject, true
+	}
+	var match model.Subject
+	matches := 0
+	for _, subject := range c {
+		if strings.EqualFold(subject.Slug, given) {
+			match = subject
+			matches++
+		}
+	}
+	return match, matches == 1
+}
+
+func contains(list []string, item string) bool {
+	for _, candidate := range list {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fitness-api/model"
+	"fitness-api/service"
+	"fmt"
+)
+
+// userCursorToken is the JSON inside an opaque listing cursor. It records
+// the sort it was issued for so it cannot be replayed against another one.
+type userCursorToken struct {
+	OrderBy  string `json:"o"`
+	Order    string `json:"d"`
+	Key      string `json:"k"`
+	Id       string `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// UserPage is one page of a cursor-paginated listing. NextCursor and
+// PrevCursor are empty when there is nothing further in that direction.
+type UserPage struct {
+	Users      []model.User
+	NextCursor string
+	PrevCursor string
+}
+
+// GetUsersPage returns the page after (or, for a prev cursor, before) the
+// given opaque cursor. An empty cursor starts at the beginning.
+func (um *UserManager) GetUsersPage(query service.UserQuery, cursor string) (UserPage, error) {
+	query.OrderBy, query.Order = normalizeUserOrder(query.OrderBy, query.Order)
+
+	var position *service.UserCursor
+	if cursor != "" {
+		token, err := decodeUserCursor(cursor)
+		if err != nil || token.OrderBy != query.OrderBy || token.Order != query.Order {
+			return UserPage{}, fmt.Errorf("invalid cursor")
+		}
+		position = &service.UserCursor{Key: token.Key, Id: token.Id, Backward: token.Backward}
+	}
+
+	users, hasMore, err := um.repo.GetUsersPage(query, position)
+	if err != nil {
+		return UserPage{}, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	page := UserPage{Users: users}
+	if len(users) == 0 {
+		return page, nil
+	}
+	// Whatever lies beyond the page in the direction of travel depends on
+	// hasMore; the other side exists whenever the page started from a
+	// cursor.
+	backward := position != nil && position.Backward
+	hasNext, hasPrev := hasMore, position != nil
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		page.NextCursor = encodeUserCursor(query, users[len(users)-1], false)
+	}
+	if hasPrev {
+		page.PrevCursor = encodeUserCursor(query, users[0], true)
+	}
+	return page, nil
+}
+
+// normalizeUserOrder applies the listing's defaults, id DESC, so tokens
+// compare equal however the client spelled the defaults.
+func normalizeUserOrder(orderby string, order string) (string, string) {
+	if orderby != "name" && orderby != "email" {
+		orderby = "id"
+	}
+	if order != "ASC" {
+		order = "DESC"
+	}
+	return orderby, order
+}
+
+func encodeUserCursor(query service.UserQuery, user model.User, backward bool) string {
+	encoded, _ := json.Marshal(userCursorToken{
+		OrderBy:  query.OrderBy,
+		Order:    query.Order,
+		Key:      service.UserSortKey(user, query.OrderBy),
+		Id:       user.Id,
+		Backward: backward,
+	})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeUserCursor(cursor string) (userCursorToken, error) {
+	var token userCursorToken
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return token, err
+	}
+	if err := json.Unmarshal(decoded, &token); err != nil {
+		return token, err
+	}
+	if token.Id == "" {
+		return token, fmt.Errorf("cursor has no id")
+	}
+	return token, nil
+}
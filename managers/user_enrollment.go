@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"fitness-api/model"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EnrollUser adds one subject to the user without touching the rest, so it
+// cannot lose a concurrent enrollment the way a full update can. The subject
+// is checked against the catalog like any other. Enrolling twice is not an
+// error; changed is false the second time.
+func (um *UserManager) EnrollUser(id string, subject string, actor string) (model.User, bool, error) {
+	current, err := um.repo.GetUserByID(id, false)
+	if err != nil {
+		return model.User{}, false, fmt.Errorf("no user found with the given ID: %s", id)
+	}
+	resolved, err := um.resolveSubjects([]string{subject}, current.Subjects)
+	if err != nil {
+		return model.User{}, false, err
+	}
+
+	user, changed, err := um.repo.AddUserSubject(id, resolved[0], time.Now(), actor)
+	if err != nil {
+		return model.User{}, false, err
+	}
+	return user, changed, nil
+}
+
+// UnenrollUser removes one subject from the user, leaving the rest alone.
+// The subject is matched against the catalog the same way EnrollUser does;
+// a subject the catalog does not know is removed as given, so stray subjects
+// can still be cleaned up.
+func (um *UserManager) UnenrollUser(id string, subject string, actor string) (model.User, error) {
+	catalog, err := um.subjectCatalog()
+	if err != nil {
+		return model.User{}, err
+	}
+	if known, ok := catalog.lookup(strings.TrimSpace(subject)); ok {
+		subject = known.Slug
+	}
+
+	user, changed, err := um.repo.RemoveUserSubject(id, subject, time.Now(), actor)
+	if err != nil {
+		return model.User{}, err
+	}
+	if !changed {
+		return model.User{}, fmt.Errorf("user %s is not enrolled in %s", id, subject)
+	}
+	return user, nil
+}
+
+// EnrolledSubjects returns the catalog entries for the user's subjects.
+func (um *UserManager) EnrolledSubjects(user model.User) ([]model.Subject, error) {
+	catalog, err := um.subjectCatalog()
+	if err != nil {
+		return nil, err
+	}
+	var enrolled []model.Subject
+	for _, subject := range catalog {
+		if contains(user.Subjects, subject.Slug) {
+			enrolled = append(enrolled, subject)
+		}
+	}
+	return enrolled, nil
+}
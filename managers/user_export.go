@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fitness-api/model"
+	"fitness-api/response"
+	"fitness-api/service"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatJSON   = "json"
+)
+
+// ExportContentTypes maps each export format to its Content-Type.
+var ExportContentTypes = map[string]string{
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatNDJSON: "application/x-ndjson",
+	ExportFormatJSON:   "application/json",
+}
+
+// ExportUsers writes every user matching query to w in the given format,
+// streaming them from the store one at a time. Users go through the same
+// response mapper as the API, trimmed to fields when any are given. The JSON
+// format is a single array; NDJSON has one user per line; CSV has a header
+// row and joins subjects with ";" the way imports expect them.
+func (um *UserManager) ExportUsers(ctx context.Context, query service.UserQuery, format string, fields []string, w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	view := response.UserView{Fields: fields}
+	if len(fields) == 0 {
+		fields = response.UserFields
+	}
+
+	var write func(model.User) error
+	var finish func() error
+	switch format {
+	case ExportFormatCSV:
+		writer := csv.NewWriter(buffered)
+		if err := writer.Write(fields); err != nil {
+			return err
+		}
+		write = func(user model.User) error {
+			dto := response.NewUserResponse(user)
+			record := make([]string, len(fields))
+			for i, field := range fields {
+				record[i] = exportCSVValue(dto.Field(field))
+			}
+			return writer.Write(record)
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case ExportFormatNDJSON:
+		encoder := json.NewEncoder(buffered)
+		write = func(user model.User) error { return encoder.Encode(view.Render(user, nil)) }
+		finish = func() error { return nil }
+	case ExportFormatJSON:
+		if _, err := buffered.WriteString("["); err != nil {
+			return err
+		}
+		first := true
+		write = func(user model.User) error {
+			encoded, err := json.Marshal(view.Render(user, nil))
+			if err != nil {
+				return err
+			}
+			if !first {
+				buffered.WriteString(",")
+			}
+			first = false
+			_, err = buffered.Write(encoded)
+			return err
+		}
+		finish = func() error {
+			_, err := buffered.WriteString("]\n")
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	if err := um.repo.StreamUsers(ctx, query, write); err != nil {
+		return fmt.Errorf("failed to export users: %v", err)
+	}
+	if err := finish(); err != nil {
+		return fmt.Errorf("failed to export users: %v", err)
+	}
+	return buffered.Flush()
+}
+
+func exportCSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ";")
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
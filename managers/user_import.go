@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fitness-api/model"
+	"fitness-api/request"
+	"fitness-api/service"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	// MaxImportRows caps the number of rows one import may carry.
+	MaxImportRows = 10000
+)
+
+// ImportRowResult reports what happened to one row of an import. Row is the
+// 1-based data row (the CSV header is not counted).
+type ImportRowResult struct {
+	Row        int                  `json:"row"`
+	Email      string               `json:"email,omitempty"`
+	Status     service.InsertStatus `json:"status"`
+	Id         string               `json:"id,omitempty"`
+	ConflictId string               `json:"conflict_id,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Mode     string            `json:"mode"`
+	Rejected bool              `json:"rejected"`
+	Total    int               `json:"total"`
+	Counts   map[string]int    `json:"counts"`
+	Results  []ImportRowResult `json:"results"`
+}
+
+// importRow is one parsed row: the request it describes, or why it could
+// not be read.
+type importRow struct {
+	req request.UserRequest
+	err error
+}
+
+// ImportUsers creates users from a CSV or NDJSON upload. Every row is
+// validated with the same rules as a create request and gets its own
+// result. With atomic set the import is all-or-nothing: a single invalid or
+// conflicting row means no user is created.
+func (um *UserManager) ImportUsers(format string, body io.Reader, atomic bool, actor string) (ImportReport, error) {
+	var rows []importRow
+	var err error
+	switch format {
+	case ImportFormatCSV:
+		rows, err = parseCSVImport(body)
+	case ImportFormatNDJSON:
+		rows, err = parseNDJSONImport(body)
+	default:
+		return ImportReport{}, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if len(rows) == 0 {
+		return ImportReport{}, fmt.Errorf("invalid import: no rows")
+	}
+
+	report := ImportReport{Mode: "best_effort", Total: len(rows), Counts: map[string]int{}}
+	if atomic {
+		report.Mode = "all_or_nothing"
+	}
+
+	catalog, err := um.subjectCatalog()
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	validate := validator.New()
+	now := time.Now()
+	results := make([]ImportRowResult, len(rows))
+	var users []model.User
+	var positions []int
+	for i, row := range rows {
+		results[i] = ImportRowResult{Row: i + 1, Email: row.req.Email}
+		if row.err == nil {
+			row.err = validate.Struct(row.req)
+		}
+		if row.err == nil {
+			row.req.Subjects, row.err = catalog.resolve(row.req.Subjects, nil)
+		}
+		if row.err != nil {
+			results[i].Status = service.InsertInvalid
+			results[i].Error = row.err.Error()
+			continue
+		}
+
+		if row.req.CreatedAt == nil {
+			row.req.CreatedAt = &now
+		}
+		if row.req.UpdatedAt == nil {
+			row.req.UpdatedAt = row.req.CreatedAt
+		}
+		users = append(users, model.User{
+			Name:      row.req.Name,
+			Email:     row.req.Email,
+			Subjects:  row.req.Subjects,
+			CreatedAt: row.req.CreatedAt,
+			UpdatedAt: row.req.UpdatedAt,
+		})
+		positions = append(positions, i)
+	}
+
+	rejected := atomic && len(users) < len(rows)
+	switch {
+	case rejected:
+		for _, position := range positions {
+			results[position].Status = service.InsertSkipped
+		}
+	case len(users) > 0:
+		inserted, err := um.repo.ImportUsers(context.Background(), users, atomic, actor)
+		if err != nil {
+			return ImportReport{}, fmt.Errorf("failed to import users: %v", err)
+		}
+		for j, result := range inserted {
+			position := positions[j]
+			results[position].Status = result.Status
+			results[position].ConflictId = result.ConflictId
+			if result.Status != service.InsertCreated {
+				if result.Status != service.InsertSkipped {
+					rejected = atomic
+				}
+				continue
+			}
+			results[position].Id = result.Id
+		}
+	}
+
+	for _, result := range results {
+		report.Counts[string(result.Status)]++
+	}
+	report.Rejected = rejected
+	report.Results = results
+	return report, nil
+}
+
+// parseCSVImport reads a CSV upload. The header row names the columns:
+// name and email are required, subjects (separated by ";") and created_at
+// (RFC 3339) are optional.
+func parseCSVImport(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid import: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		switch column {
+		case "name", "email", "subjects", "created_at":
+		default:
+			return nil, fmt.Errorf("invalid import: unknown column %q", column)
+		}
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("invalid import: duplicate column %q", column)
+		}
+		columns[column] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("invalid import: missing email column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("invalid import: more than %d rows", MaxImportRows)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid import: %v", err)
+		}
+		if len(record) != len(header) {
+			rows = append(rows, importRow{err: fmt.Errorf("expected %d fields, got %d", len(header), len(record))})
+			continue
+		}
+		rows = append(rows, csvImportRow(record, columns))
+	}
+}
+
+func csvImportRow(record []string, columns map[string]int) importRow {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := importRow{req: request.UserRequest{Name: field("name"), Email: field("email")}}
+	for _, subject := range strings.Split(field("subjects"), ";") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			row.req.Subjects = append(row.req.Subjects, subject)
+		}
+	}
+	if createdAt := field("created_at"); createdAt != "" {
+		parsed, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			row.err = fmt.Errorf("created_at must be an RFC 3339 timestamp")
+			return row
+		}
+		row.req.CreatedAt = &parsed
+	}
+	return row
+}
+
+// parseNDJSONImport reads one user request per line. Blank lines are
+// skipped and do not count as rows.
+func parseNDJSONImport(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []importRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("invalid import: more than %d rows", MaxImportRows)
+		}
+
+		var row importRow
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.req); err != nil {
+			row.err = fmt.Errorf("invalid JSON: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid import: %v", err)
+	}
+	return rows, nil
+}
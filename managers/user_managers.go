@@ -1,21 +1,30 @@
 package manager
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fitness-api/model"
+	"fitness-api/patch"
 	"fitness-api/request"
 	"fitness-api/service"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/go-playground/validator/v10"
 	//"github.com/jinzhu/now"
 )
 
 type UserManager struct {
+	repo     service.UserRepository
+	subjects service.SubjectRepository
 }
 
-func NewUserManager() *UserManager {
+func NewUserManager(repo service.UserRepository, subjects service.SubjectRepository) *UserManager {
 
-	return &UserManager{}
+	return &UserManager{repo: repo, subjects: subjects}
 }
 
 // func derefString(ptr *string) string {
@@ -25,22 +34,28 @@ func NewUserManager() *UserManager {
 // 	return *ptr
 // }
 
-func (um *UserManager) CreateUser(req request.UserRequest) (model.User, error) {
+// CreateUser stores a new user. actor names who made the change in the
+// audit history, as it does for every other write below.
+func (um *UserManager) CreateUser(req request.UserRequest, actor string) (model.User, error) {
 
 	if req.CreatedAt == nil {
 		now := time.Now()
 		req.CreatedAt = &now
 	}
+	subjects, err := um.resolveSubjects(req.Subjects, nil)
+	if err != nil {
+		return model.User{}, err
+	}
 
 	user := model.User{
 		Name:      req.Name,
 		Email:     req.Email,
-		Subjects:  req.Subjects,
+		Subjects:  subjects,
 		CreatedAt: req.CreatedAt,
 		UpdatedAt: req.CreatedAt,
 		DeletedAt: nil,
 	}
-	createdUser, err := service.CreateUser(user)
+	createdUser, err := um.repo.CreateUser(user, actor)
 	if err != nil {
 		log.Println("Failed to create user:", err)
 		return model.User{}, fmt.Errorf("error unable to create user please try again: %w", err)
@@ -48,18 +63,28 @@ func (um *UserManager) CreateUser(req request.UserRequest) (model.User, error) {
 	return createdUser, nil
 }
 
-func (um *UserManager) UpdateUser(id string, req request.UserRequest) (model.User, error) {
+// UpdateUser replaces the user's fields. A non-zero expectedVersion makes the
+// update conditional on the stored version, as sent by clients in If-Match.
+func (um *UserManager) UpdateUser(id string, req request.UserRequest, expectedVersion int, actor string) (model.User, error) {
+	var current []string
+	if stored := um.snapshot(id, false); stored != nil {
+		current = stored.Subjects
+	}
+	subjects, err := um.resolveSubjects(req.Subjects, current)
+	if err != nil {
+		return model.User{}, err
+	}
 
 	user := model.User{
 		Name:      req.Name,
 		Email:     req.Email,
-		Subjects:  req.Subjects,
+		Subjects:  subjects,
 		CreatedAt: req.CreatedAt,
 		UpdatedAt: &time.Time{},
 		DeletedAt: nil,
 	}
 
-	updatedUser, err := service.UpdateUser(user, id)
+	updatedUser, err := um.repo.UpdateUser(user, id, expectedVersion, actor)
 	if err != nil {
 
 		return model.User{}, err
@@ -68,28 +93,175 @@ func (um *UserManager) UpdateUser(id string, req request.UserRequest) (model.Use
 	return updatedUser, nil
 }
 
-func (um *UserManager) DeleteUser(id string) error {
-	err := service.DeleteUser(id)
+// userPatchDocument is the JSON view of a user that PATCH requests edit.
+// Fields outside it, such as id and timestamps, cannot be patched.
+type userPatchDocument struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Subjects []string `json:"subjects"`
+}
+
+// PatchUser applies a merge patch or JSON patch to the stored user, checks
+// the result with the same rules as create and saves it. Without an
+// expectedVersion the update is still conditional on the version that was
+// patched, so a concurrent write is reported instead of overwritten.
+func (um *UserManager) PatchUser(id string, contentType string, body []byte, expectedVersion int, actor string) (model.User, error) {
+	current, err := um.repo.GetUserByID(id, false)
 	if err != nil {
-		return err
+		return model.User{}, fmt.Errorf("no user found with the given ID: %s", id)
+	}
+	if expectedVersion != 0 && current.Version != expectedVersion {
+		return model.User{}, fmt.Errorf("version mismatch for user %s", id)
 	}
 
-	return nil
+	doc, err := json.Marshal(userPatchDocument{Name: current.Name, Email: current.Email, Subjects: current.Subjects})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	var patched []byte
+	switch contentType {
+	case patch.MergePatchContentType:
+		patched, err = patch.MergePatch(doc, body)
+	case patch.JSONPatchContentType:
+		patched, err = patch.JSONPatch(doc, body)
+	default:
+		return model.User{}, fmt.Errorf("unsupported patch content type %q", contentType)
+	}
+	if err != nil {
+		return model.User{}, fmt.Errorf("invalid patch: %v", err)
+	}
+
+	var result userPatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		return model.User{}, fmt.Errorf("invalid patch: %v", err)
+	}
+
+	req := request.UserRequest{Name: result.Name, Email: result.Email, Subjects: result.Subjects}
+	if err := validator.New().Struct(req); err != nil {
+		return model.User{}, fmt.Errorf("invalid patch: %v", err)
+	}
+	if req.Subjects, err = um.resolveSubjects(req.Subjects, current.Subjects); err != nil {
+		return model.User{}, err
+	}
+
+	now := time.Now()
+	user := model.User{
+		Name:      req.Name,
+		Email:     req.Email,
+		Subjects:  req.Subjects,
+		CreatedAt: current.CreatedAt,
+		UpdatedAt: &now,
+	}
+	patchedUser, err := um.repo.UpdateUser(user, id, current.Version, actor)
+	if err != nil {
+		return model.User{}, err
+	}
+	return patchedUser, nil
 }
 
-func (um *UserManager) GetAllUsers(pageSize int, pageNo int, subject string, order string, orderby string) ([]model.User, int, int, error) {
+func (um *UserManager) DeleteUser(id string, actor string) error {
+	return um.repo.DeleteUser(id, actor)
+}
+
+func (um *UserManager) RestoreUser(id string, actor string) (model.User, error) {
+	return um.repo.RestoreUser(id, actor)
+}
 
-	users, lastPage, totalDocuments, err := service.GetAllUsers(pageSize, pageNo, subject, order, orderby)
+// PurgeDeletedUsers permanently removes users that were soft-deleted more
+// than olderThanDays days ago and returns how many were removed. Each one
+// gets a purge entry in its history.
+func (um *UserManager) PurgeDeletedUsers(olderThanDays int, actor string) (int, error) {
+	cutoff := time.Now().AddDate(0, 0, -olderThanDays)
+	purged, err := um.repo.PurgeDeletedUsers(cutoff, actor)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Purged %d user(s) deleted before %s", purged, cutoff.Format(time.RFC3339))
+	return purged, nil
+}
+
+func (um *UserManager) GetAllUsers(query service.UserQuery) ([]model.User, int, int, error) {
+
+	users, lastPage, totalDocuments, err := um.repo.GetAllUsers(query)
 	if err != nil {
 		return nil, 0, 0, fmt.Errorf("failed to fetch users: ")
 	}
 	return users, lastPage, totalDocuments, nil
 }
 
-func (um *UserManager) GetUserByID(id string) (model.User, error) {
-	user, err := service.GetUserByID(id)
+// SearchUsers ranks users by how well their name and email match the search.
+func (um *UserManager) SearchUsers(search service.UserSearch) ([]service.UserSearchResult, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, fmt.Errorf("invalid search: q is required")
+	}
+	if len(search.Query) > 200 {
+		return nil, fmt.Errorf("invalid search: q is longer than 200 characters")
+	}
+	if search.Mode != service.SearchModeFullText && search.Mode != service.SearchModeAutocomplete {
+		return nil, fmt.Errorf("invalid search: mode must be %s or %s", service.SearchModeFullText, service.SearchModeAutocomplete)
+	}
+
+	results, err := um.repo.SearchUsers(context.Background(), search)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %v", err)
+	}
+	return results, nil
+}
+
+func (um *UserManager) GetUserByID(id string, includeDeleted bool) (model.User, error) {
+	user, err := um.repo.GetUserByID(id, includeDeleted)
 	if err != nil {
 		return model.User{}, err
 	}
 	return user, nil
 }
+
+// GetUserHistory returns a page of the user's audit entries, newest first.
+// The history outlives the user, so an id that no longer resolves is looked
+// up as given.
+func (um *UserManager) GetUserHistory(id string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error) {
+	if user := um.snapshot(id, true); user != nil {
+		id = user.Id
+	}
+	entries, lastPage, totalDocuments, err := um.repo.GetUserHistory(id, pageSize, pageNo)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch user history: %v", err)
+	}
+	return entries, lastPage, totalDocuments, nil
+}
+
+// resolveSubjects checks the subjects given for a user against the catalog
+// and returns them as catalog slugs. current holds the subjects the user
+// already has.
+func (um *UserManager) resolveSubjects(subjects []string, current []string) ([]string, error) {
+	if subjects == nil {
+		return nil, nil
+	}
+	catalog, err := um.subjectCatalog()
+	if err != nil {
+		return nil, err
+	}
+	return catalog.resolve(subjects, current)
+}
+
+func (um *UserManager) subjectCatalog() (subjectCatalog, error) {
+	subjects, err := um.subjects.ListSubjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the subject catalog: %v", err)
+	}
+	return subjectCatalog(subjects), nil
+}
+
+// snapshot returns the stored user for an audit entry, or nil if it cannot
+// be read.
+func (um *UserManager) snapshot(id string, includeDeleted bool) *model.User {
+	user, err := um.repo.GetUserByID(id, includeDeleted)
+	if err != nil {
+		return nil
+	}
+	return &user
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"context"
+	"fitness-api/service"
+	"fmt"
+	"time"
+)
+
+// maxSignupBuckets bounds the series CountSignups returns.
+const maxSignupBuckets = 5000
+
+func (um *UserManager) CountUsersBySubject(query service.UserStatsQuery) ([]service.SubjectCount, error) {
+	if err := checkStatsRange(query); err != nil {
+		return nil, err
+	}
+	counts, err := um.repo.CountUsersBySubject(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute stats: %v", err)
+	}
+	return counts, nil
+}
+
+// CountSignups returns the number of users created per day, week or month.
+// The series has no gaps: periods without signups are included with zero,
+// from the range's start (or the first signup) to its end (or the last
+// signup).
+func (um *UserManager) CountSignups(interval string, query service.UserStatsQuery) ([]service.SignupBucket, error) {
+	switch interval {
+	case service.StatsIntervalDay, service.StatsIntervalWeek, service.StatsIntervalMonth:
+	default:
+		return nil, fmt.Errorf("invalid stats query: interval must be %s, %s or %s",
+			service.StatsIntervalDay, service.StatsIntervalWeek, service.StatsIntervalMonth)
+	}
+	if err := checkStatsRange(query); err != nil {
+		return nil, err
+	}
+
+	buckets, err := um.repo.CountSignups(context.Background(), interval, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute stats: %v", err)
+	}
+	return fillSignupGaps(buckets, interval, query)
+}
+
+func (um *UserManager) CountUsers(query service.UserStatsQuery) (service.UserTotals, error) {
+	if err := checkStatsRange(query); err != nil {
+		return service.UserTotals{}, err
+	}
+	totals, err := um.repo.CountUsers(context.Background(), query)
+	if err != nil {
+		return service.UserTotals{}, fmt.Errorf("failed to compute stats: %v", err)
+	}
+	return totals, nil
+}
+
+func checkStatsRange(query service.UserStatsQuery) error {
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return fmt.Errorf("invalid stats query: from must be before to")
+	}
+	return nil
+}
+
+func fillSignupGaps(buckets []service.SignupBucket, interval string, query service.UserStatsQuery) ([]service.SignupBucket, error) {
+	counts := map[string]int{}
+	for _, bucket := range buckets {
+		counts[bucket.Period] = bucket.Users
+	}
+
+	var first, last time.Time
+	if len(buckets) > 0 {
+		var err error
+		if first, err = time.Parse(time.DateOnly, buckets[0].Period); err != nil {
+			return nil, fmt.Errorf("failed to compute stats: bad period %q", buckets[0].Period)
+		}
+		if last, err = time.Parse(time.DateOnly, buckets[len(buckets)-1].Period); err != nil {
+			return nil, fmt.Errorf("failed to compute stats: bad period %q", buckets[len(buckets)-1].Period)
+		}
+	}
+	if query.From != nil {
+		first = service.StatsPeriodStart(*query.From, interval)
+	}
+	if query.To != nil {
+		last = service.StatsPeriodStart(query.To.Add(-time.Nanosecond), interval)
+	}
+	if first.IsZero() || last.IsZero() {
+		return []service.SignupBucket{}, nil
+	}
+
+	filled := []service.SignupBucket{}
+	for period := first; !period.After(last); period = service.NextStatsPeriod(period, interval) {
+		if len(filled) == maxSignupBuckets {
+			return nil, fmt.Errorf("invalid stats query: more than %d %ss, narrow the range or use a longer interval", maxSignupBuckets, interval)
+		}
+		key := period.Format(time.DateOnly)
+		filled = append(filled, service.SignupBucket{Period: key, Users: counts[key]})
+	}
+	return filled, nil
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"context"
+	"fitness-api/model"
+	"fitness-api/request"
+	"fitness-api/service"
+	"fmt"
+	"time"
+)
+
+type WebhookManager struct {
+	repo       service.WebhookRepository
+	dispatcher *service.WebhookDispatcher
+}
+
+func NewWebhookManager(repo service.WebhookRepository, dispatcher *service.WebhookDispatcher) *WebhookManager {
+	return &WebhookManager{repo: repo, dispatcher: dispatcher}
+}
+
+func (wm *WebhookManager) CreateWebhook(req request.WebhookRequest) (model.Webhook, error) {
+	if req.Secret == "" {
+		return model.Webhook{}, fmt.Errorf("secret is required")
+	}
+
+	now := time.Now().UTC()
+	webhook := model.Webhook{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+		Active:     req.Active == nil || *req.Active,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	return wm.repo.CreateWebhook(webhook)
+}
+
+// UpdateWebhook replaces the webhook's settings. An empty secret keeps the
+// current one and an omitted active flag keeps the current state.
+func (wm *WebhookManager) UpdateWebhook(id string, req request.WebhookRequest) (model.Webhook, error) {
+	webhook, err := wm.repo.GetWebhook(id)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	webhook.URL = req.URL
+	webhook.EventTypes = req.EventTypes
+	if req.Secret != "" {
+		webhook.Secret = req.Secret
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	webhook.UpdatedAt = time.Now().UTC()
+	return wm.repo.UpdateWebhook(webhook)
+}
+
+func (wm *WebhookManager) DeleteWebhook(id string) error {
+	return wm.repo.DeleteWebhook(id)
+}
+
+func (wm *WebhookManager) GetWebhook(id string) (model.Webhook, error) {
+	return wm.repo.GetWebhook(id)
+}
+
+func (wm *WebhookManager) ListWebhooks() ([]model.Webhook, error) {
+	return wm.repo.ListWebhooks()
+}
+
+// ListDeliveries returns a page of the webhook's deliveries, newest first.
+// status narrows it to pending, succeeded or dead (the dead-letter list).
+func (wm *WebhookManager) ListDeliveries(webhookID string, status string, pageSize int, pageNo int) ([]model.WebhookDelivery, int, int, error) {
+	if _, err := wm.repo.GetWebhook(webhookID); err != nil {
+		return nil, 0, 0, err
+	}
+	switch status {
+	case "", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryDead:
+	default:
+		return nil, 0, 0, fmt.Errorf("status must be %s, %s or %s", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryDead)
+	}
+	return wm.repo.ListDeliveries(webhookID, status, pageSize, pageNo)
+}
+
+// RetryDelivery sends a dead-lettered delivery once more and returns it
+// with the outcome recorded.
+func (wm *WebhookManager) RetryDelivery(ctx context.Context, webhookID string, deliveryID string) (model.WebhookDelivery, error) {
+	delivery, err := wm.repo.GetDelivery(deliveryID)
+	if err != nil || delivery.WebhookId != webhookID {
+		return model.WebhookDelivery{}, fmt.Errorf("no delivery found with id %s", deliveryID)
+	}
+	return wm.dispatcher.Redeliver(ctx, deliveryID)
+}
@@ -0,0 +1,240 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var sqlFiles embed.FS
+
+// Dialects supported by SQLMigrator. Each one has a directory of numbered
+// migrations named <version>_<name>.up.sql / <version>_<name>.down.sql.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator is implemented by every backend specific migration runner so the
+// migrate command can drive them the same way.
+type Migrator interface {
+	Up(ctx context.Context) ([]MigrationStatus, error)
+	Down(ctx context.Context) (*MigrationStatus, error)
+	Status(ctx context.Context) ([]MigrationStatus, error)
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// SQLMigrator applies the embedded migrations of one dialect and records them
+// in the schema_migrations table.
+type SQLMigrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+func NewSQLMigrator(db *sql.DB, dialect string) (*SQLMigrator, error) {
+	migrations, err := loadMigrations(sqlFiles, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLMigrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unknown migration dialect %q: %v", dir, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func (m *SQLMigrator) placeholder(n int) string {
+	if m.dialect == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+func (m *SQLMigrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+func (m *SQLMigrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in version order, each one in its own
+// transaction, and returns the migrations that were applied.
+func (m *SQLMigrator) Up(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []MigrationStatus
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		now := time.Now().UTC()
+		insert := fmt.Sprintf(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)`,
+			m.placeholder(1), m.placeholder(2), m.placeholder(3))
+		err := m.inTx(ctx, migration.Up, insert, migration.Version, migration.Name, now)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		done = append(done, MigrationStatus{Version: migration.Version, Name: migration.Name, AppliedAt: &now})
+	}
+	return done, nil
+}
+
+// Down reverts the most recently applied migration. It returns nil when there
+// is nothing left to revert.
+func (m *SQLMigrator) Down(ctx context.Context) (*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+
+		remove := fmt.Sprintf(`DELETE FROM schema_migrations WHERE version = %s`, m.placeholder(1))
+		if err := m.inTx(ctx, migration.Down, remove, migration.Version); err != nil {
+			return nil, fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+
+		log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+		return &MigrationStatus{Version: migration.Version, Name: migration.Name}, nil
+	}
+	return nil, nil
+}
+
+func (m *SQLMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// inTx runs script followed by the bookkeeping statement in one transaction.
+func (m *SQLMigrator) inTx(ctx context.Context, script string, bookkeeping string, args ...any) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,352 @@
+package migrations
+
+import (
+	"context"
+	"fitness-api/service"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoMigration is the MongoDB counterpart of an SQL migration. Collections,
+// indexes and validators are managed through driver calls, so the steps are
+// written in Go instead of embedded scripts.
+type MongoMigration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// mongoMigrations is the ordered list of migrations for the "fitness"
+// database. Append new steps with the next version number.
+var mongoMigrations = []MongoMigration{
+	{
+		Version: 1,
+		Name:    "create_users",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureCollection(ctx, db, "users"); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "users", usersValidator)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return setValidator(ctx, db, "users", bson.M{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index_users_email_subjects",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("users_email_unique").SetUnique(true)},
+				{Keys: bson.D{{Key: "subjects", Value: 1}}, Options: options.Index().SetName("users_subjects_idx")},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("users").Indexes().DropOne(ctx, "users_email_unique"); err != nil {
+				return err
+			}
+			_, err := db.Collection("users").Indexes().DropOne(ctx, "users_subjects_idx")
+			return err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "index_users_deleted_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetName("users_deleted_at_idx"),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().DropOne(ctx, "users_deleted_at_idx")
+			return err
+		},
+	},
+	{
+		Version: 4,
+		Name:    "users_version",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").UpdateMany(ctx,
+				bson.M{"version": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"version": 1}})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"version": ""}})
+			return err
+		},
+	},
+	{
+		Version: 5,
+		Name:    "index_users_text",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// No stemming or stop words: names and email parts are not prose.
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+				Options: options.Index().SetName("users_text_idx").
+					SetWeights(bson.D{{Key: "name", Value: 2}, {Key: "email", Value: 1}}).
+					SetDefaultLanguage("none"),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().DropOne(ctx, "users_text_idx")
+			return err
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_subjects",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureCollection(ctx, db, "subjects"); err != nil {
+				return err
+			}
+			_, err := db.Collection("subjects").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "slug", Value: 1}},
+				Options: options.Index().SetName("subjects_slug_unique").SetUnique(true),
+			})
+			if err != nil {
+				return err
+			}
+
+			// Seed the catalog with every subject already in use, so existing
+			// users stay valid.
+			used, err := db.Collection("users").Distinct(ctx, "subjects", bson.M{})
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			for _, value := range used {
+				slug, ok := value.(string)
+				if !ok || slug == "" {
+					continue
+				}
+				_, err := db.Collection("subjects").UpdateOne(ctx,
+					bson.M{"slug": slug},
+					bson.M{"$setOnInsert": bson.M{
+						"_id":          uuid.Must(uuid.NewV7()).String(),
+						"display_name": slug,
+						"description":  "",
+						"active":       true,
+						"created_at":   now,
+						"updated_at":   now,
+					}},
+					options.Update().SetUpsert(true))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("subjects").Drop(ctx)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_api_keys",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureCollection(ctx, db, "api_keys"); err != nil {
+				return err
+			}
+			_, err := db.Collection("api_keys").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "key_hash", Value: 1}},
+				Options: options.Index().SetName("api_keys_key_hash_unique").SetUnique(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("api_keys").Drop(ctx)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "index_users_search_words",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Backfill the words autocomplete matches prefixes against; the
+			// repository keeps them current from here on.
+			users := db.Collection("users")
+			cursor, err := users.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"name": 1, "email": 1}))
+			if err != nil {
+				return err
+			}
+			defer cursor.Close(ctx)
+			for cursor.Next(ctx) {
+				var user struct {
+					Id    string `bson:"_id"`
+					Name  string `bson:"name"`
+					Email string `bson:"email"`
+				}
+				if err := cursor.Decode(&user); err != nil {
+					return err
+				}
+				_, err := users.UpdateOne(ctx, bson.M{"_id": user.Id},
+					bson.M{"$set": bson.M{"search_words": service.SearchWords(user.Name, user.Email)}})
+				if err != nil {
+					return err
+				}
+			}
+			if err := cursor.Err(); err != nil {
+				return err
+			}
+
+			_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "search_words", Value: 1}},
+				Options: options.Index().SetName("users_search_words_idx"),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("users").Indexes().DropOne(ctx, "users_search_words_idx"); err != nil {
+				return err
+			}
+			_, err := db.Collection("users").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"search_words": ""}})
+			return err
+		},
+	},
+}
+
+var usersValidator = bson.M{
+	"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"email"},
+		"properties": bson.M{
+			"name":     bson.M{"bsonType": "string"},
+			"email":    bson.M{"bsonType": "string"},
+			"subjects": bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "string"}},
+		},
+	},
+}
+
+// MongoMigrator applies mongoMigrations and records them in the
+// schema_migrations collection.
+type MongoMigrator struct {
+	db         *mongo.Database
+	migrations []MongoMigration
+}
+
+func NewMongoMigrator(client *mongo.Client) *MongoMigrator {
+	return &MongoMigrator{db: client.Database("fitness"), migrations: mongoMigrations}
+}
+
+func (m *MongoMigrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	cursor, err := m.db.Collection("schema_migrations").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	applied := map[int]time.Time{}
+	for cursor.Next(ctx) {
+		var record struct {
+			Version   int       `bson:"_id"`
+			AppliedAt time.Time `bson:"applied_at"`
+		}
+		if err := cursor.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to decode schema_migrations: %v", err)
+		}
+		applied[record.Version] = record.AppliedAt
+	}
+	return applied, cursor.Err()
+}
+
+func (m *MongoMigrator) Up(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []MigrationStatus
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := migration.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		now := time.Now().UTC()
+		_, err := m.db.Collection("schema_migrations").InsertOne(ctx, bson.M{
+			"_id":        migration.Version,
+			"name":       migration.Name,
+			"applied_at": now,
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to record migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		done = append(done, MigrationStatus{Version: migration.Version, Name: migration.Name, AppliedAt: &now})
+	}
+	return done, nil
+}
+
+func (m *MongoMigrator) Down(ctx context.Context) (*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if err := migration.Down(ctx, m.db); err != nil {
+			return nil, fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		if _, err := m.db.Collection("schema_migrations").DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+			return nil, fmt.Errorf("failed to unrecord migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+
+		log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+		return &MigrationStatus{Version: migration.Version, Name: migration.Name}, nil
+	}
+	return nil, nil
+}
+
+func (m *MongoMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func ensureCollection(ctx context.Context, db *mongo.Database, name string) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+	return db.CreateCollection(ctx, name)
+}
+
+func setValidator(ctx context.Context, db *mongo.Database, collection string, validator bson.M) error {
+	return db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+	}).Err()
+}
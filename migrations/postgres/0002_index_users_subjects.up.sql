@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_subjects_idx ON users USING GIN (subjects);
@@ -0,0 +1,13 @@
+-- Restore the integer key. Users created after the switch get fresh
+-- sequence values.
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+CREATE SEQUENCE users_id_seq;
+SELECT setval('users_id_seq', COALESCE((SELECT MAX(legacy_id) FROM users), 0) + 1, false);
+UPDATE users SET legacy_id = nextval('users_id_seq') WHERE legacy_id IS NULL;
+ALTER TABLE users DROP COLUMN id;
+ALTER TABLE users DROP CONSTRAINT users_legacy_id_key;
+ALTER TABLE users RENAME COLUMN legacy_id TO id;
+ALTER TABLE users ALTER COLUMN id SET NOT NULL;
+ALTER TABLE users ALTER COLUMN id SET DEFAULT nextval('users_id_seq');
+ALTER SEQUENCE users_id_seq OWNED BY users.id;
+ALTER TABLE users ADD PRIMARY KEY (id);
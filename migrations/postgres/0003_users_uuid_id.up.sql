@@ -0,0 +1,23 @@
+-- Switch users.id from SERIAL to UUID. The old integer key is kept in
+-- legacy_id so references created before the switch still resolve.
+--
+-- Existing users get version 7 shaped ids built from created_at, with the
+-- old integer key in the low bits, so ordering by id keeps both the
+-- creation order and the order of users created in the same millisecond.
+-- Users without created_at sort first. There is no default: the application
+-- issues every new id as a UUIDv7, which sorts after these.
+ALTER TABLE users ADD COLUMN new_id UUID;
+UPDATE users SET new_id = (
+    lpad(to_hex(floor(extract(epoch FROM COALESCE(created_at, 'epoch'::timestamp)) * 1000)::bigint), 12, '0')
+    || '7000'
+    || to_hex(id::bigint | (1::bigint << 63))
+)::uuid;
+ALTER TABLE users ALTER COLUMN new_id SET NOT NULL;
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+ALTER TABLE users RENAME COLUMN id TO legacy_id;
+ALTER TABLE users ALTER COLUMN legacy_id DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN legacy_id DROP NOT NULL;
+DROP SEQUENCE IF EXISTS users_id_seq;
+ALTER TABLE users ADD CONSTRAINT users_legacy_id_key UNIQUE (legacy_id);
+ALTER TABLE users RENAME COLUMN new_id TO id;
+ALTER TABLE users ADD PRIMARY KEY (id);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at);
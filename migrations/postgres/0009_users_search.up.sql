@@ -0,0 +1,16 @@
+-- Full-text search over name and email. Email punctuation is turned into
+-- spaces so each part of the address is its own word. search_text backs
+-- the typo-tolerant trigram matching used for autocomplete.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('simple', regexp_replace(email, '[^[:alnum:]]+', ' ', 'g')), 'B')
+) STORED;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+    lower(coalesce(name, '') || ' ' || regexp_replace(email, '[^[:alnum:]]+', ' ', 'g'))
+) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS users_search_text_trgm_idx ON users USING GIN (search_text gin_trgm_ops);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS subjects (
+    id UUID PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Seed the catalog with every subject already in use, so existing users stay
+-- valid. Near-duplicates such as "Yoga" and "yoga" can then be merged.
+INSERT INTO subjects (id, slug, display_name, created_at, updated_at)
+SELECT gen_random_uuid(), subject, subject, NOW(), NOW()
+FROM (SELECT DISTINCT unnest(subjects) AS subject FROM users) AS used
+WHERE subject <> ''
+ON CONFLICT (slug) DO NOTHING;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_audit (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    before_snapshot TEXT,
+    after_snapshot TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS user_audit_user_id_idx ON user_audit (user_id, id DESC);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_outbox (
+    id TEXT PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS user_outbox_pending_idx ON user_outbox (id) WHERE published_at IS NULL;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS subjects (
+    id TEXT PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Seed the catalog with every subject already in use, so existing users stay
+-- valid. Near-duplicates such as "Yoga" and "yoga" can then be merged. The
+-- ids are random version 4 UUIDs.
+INSERT INTO subjects (id, slug, display_name, created_at, updated_at)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-'
+        || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    subject, subject, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM (SELECT DISTINCT s.value AS subject FROM users, json_each(users.subjects) AS s) AS used
+WHERE subject <> ''
+ON CONFLICT (slug) DO NOTHING;
@@ -0,0 +1,16 @@
+-- users_fts indexes the words of each user's name and email for SearchUsers.
+-- It reads the text from users by rowid, and the triggers keep it in step.
+-- VACUUM may renumber users' rowids; rebuild the index after one with
+-- INSERT INTO users_fts (users_fts) VALUES ('rebuild').
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(name, email, content = 'users', content_rowid = 'rowid');
+INSERT INTO users_fts (users_fts) VALUES ('rebuild');
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts (rowid, name, email) VALUES (new.rowid, new.name, new.email);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF name, email ON users BEGIN
+    INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.rowid, old.name, old.email);
+    INSERT INTO users_fts (rowid, name, email) VALUES (new.rowid, new.name, new.email);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.rowid, old.name, old.email);
+END;
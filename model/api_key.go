@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// APIKey lets a service authenticate with the X-API-Key header. Only a
+// SHA-256 hash of the key is stored; Prefix keeps its first characters so a
+// key can be recognized in listings.
+type APIKey struct {
+	Id         string     `json:"id" bson:"_id"`
+	Name       string     `json:"name" bson:"name"`
+	Prefix     string     `json:"prefix" bson:"prefix"`
+	KeyHash    string     `json:"-" bson:"key_hash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	CreatedBy  string     `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at" bson:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" bson:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" bson:"revoked_at"`
+}
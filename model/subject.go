@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// Subject is an entry in the subject catalog. Users refer to subjects by
+// Slug; inactive subjects stay on the users that have them but cannot be
+// newly assigned.
+type Subject struct {
+	Id          string    `json:"id" bson:"_id"`
+	Slug        string    `json:"slug" bson:"slug"`
+	DisplayName string    `json:"display_name" bson:"display_name"`
+	Description string    `json:"description" bson:"description"`
+	Active      bool      `json:"active" bson:"active"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
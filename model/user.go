@@ -12,4 +12,5 @@ type User struct {
 	CreatedAt *time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp" bson:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at" gorm:"column:updated_at;default:current_timestamp" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"deleted_at" gorm:"column:deleted_at" bson:"deleted_at,omitempty"`
+	Version   int        `json:"version" gorm:"column:version;default:1" bson:"version"`
 }
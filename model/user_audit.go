@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// UserAuditEntry records one change to a user. Before is nil for a create,
+// After is nil for a purge and otherwise holds the stored user once the
+// change was applied.
+type UserAuditEntry struct {
+	Id        string    `json:"id" bson:"_id"`
+	UserId    string    `json:"user_id" bson:"user_id"`
+	Action    string    `json:"action" bson:"action"`
+	Actor     string    `json:"actor" bson:"actor"`
+	Before    *User     `json:"before" bson:"before"`
+	After     *User     `json:"after" bson:"after"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
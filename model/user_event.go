@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	UserCreated  = "UserCreated"
+	UserUpdated  = "UserUpdated"
+	UserDeleted  = "UserDeleted"
+	UserRestored = "UserRestored"
+)
+
+// UserEvent announces a change to a user to downstream services. User holds
+// the stored user as of the change.
+type UserEvent struct {
+	Id          string     `json:"id" bson:"_id"`
+	Type        string     `json:"type" bson:"type"`
+	UserId      string     `json:"user_id" bson:"user_id"`
+	User        User       `json:"user" bson:"user"`
+	OccurredAt  time.Time  `json:"occurred_at" bson:"occurred_at"`
+	PublishedAt *time.Time `json:"-" bson:"published_at"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+)
+
+// UserEventTypes lists the event types a webhook can subscribe to.
+var UserEventTypes = []string{UserCreated, UserUpdated, UserDeleted, UserRestored}
+
+// Webhook is an operator registered endpoint that receives user events.
+// Secret signs every delivery and is never returned by the API.
+type Webhook struct {
+	Id         string    `json:"id" bson:"_id"`
+	URL        string    `json:"url" bson:"url"`
+	Secret     string    `json:"-" bson:"secret"`
+	EventTypes []string  `json:"event_types" bson:"event_types"`
+	Active     bool      `json:"active" bson:"active"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead marks a delivery that used up its retries. Dead deliveries
+	// form the dead-letter list and can be retried by hand.
+	DeliveryDead = "dead"
+)
+
+// WebhookDelivery is one event on its way to one webhook. Payload is the
+// exact body sent, so every attempt carries the same bytes.
+type WebhookDelivery struct {
+	Id            string           `json:"id" bson:"_id"`
+	WebhookId     string           `json:"webhook_id" bson:"webhook_id"`
+	EventId       string           `json:"event_id" bson:"event_id"`
+	EventType     string           `json:"event_type" bson:"event_type"`
+	Payload       string           `json:"payload" bson:"payload"`
+	Status        string           `json:"status" bson:"status"`
+	Attempts      []WebhookAttempt `json:"attempts" bson:"attempts"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     time.Time        `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at" bson:"updated_at"`
+}
+
+// WebhookAttempt is the outcome of one POST to a webhook. StatusCode is 0
+// when no response was received.
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at" bson:"attempted_at"`
+	StatusCode  int       `json:"status_code" bson:"status_code"`
+	Error       string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms" bson:"duration_ms"`
+}
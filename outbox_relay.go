@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fitness-api/config"
+	"fitness-api/service"
+	"log"
+	"net/http"
+)
+
+// startOutboxRelay publishes the backend's outbox events in the background
+// to the webhook dispatcher and the publisher chosen by OUTBOX_PUBLISHER.
+// The dispatcher goes first: its enqueue is idempotent, so a retry caused by
+// the other publisher does not notify webhooks twice.
+func startOutboxRelay(flagConfig *config.Flag, store service.OutboxStore, dispatcher *service.WebhookDispatcher) {
+	publishers := service.MultiPublisher{dispatcher}
+	switch flagConfig.OutboxPublisher {
+	case "none":
+	case "file":
+		filePublisher, err := service.NewFilePublisher(flagConfig.OutboxFile)
+		if err != nil {
+			log.Fatalf("Failed to start outbox relay: %v", err)
+		}
+		publishers = append(publishers, filePublisher)
+		log.Printf("Publishing user events to %s", flagConfig.OutboxFile)
+	case "channel":
+		channelPublisher := service.NewChannelPublisher(flagConfig.OutboxBatchSize)
+		go func() {
+			for event := range channelPublisher.Events() {
+				log.Printf("User event %s: %s for user %s", event.Id, event.Type, event.UserId)
+			}
+		}()
+		publishers = append(publishers, channelPublisher)
+	default:
+		log.Fatalf("OUTBOX_PUBLISHER must be file, channel or none, got %q", flagConfig.OutboxPublisher)
+	}
+
+	relay := service.NewOutboxRelay(store, publishers, flagConfig.OutboxRelayInterval, flagConfig.OutboxBatchSize)
+	go relay.Run(context.Background())
+	go dispatcher.Run(context.Background())
+}
+
+func newWebhookDispatcher(flagConfig *config.Flag, store service.WebhookRepository) *service.WebhookDispatcher {
+	return service.NewWebhookDispatcher(store, &http.Client{Timeout: flagConfig.WebhookTimeout}, service.WebhookDispatcherConfig{
+		MaxAttempts:  flagConfig.WebhookMaxAttempts,
+		RetryBase:    flagConfig.WebhookRetryBase,
+		RetryMax:     flagConfig.WebhookRetryMax,
+		PollInterval: flagConfig.WebhookPollInterval,
+		Concurrency:  flagConfig.WebhookConcurrency,
+	})
+}
@@ -0,0 +1,148 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assertJSONEqual compares two JSON documents by value.
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("result is not JSON: %s", got)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("expected value is not JSON: %s", want)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// The cases follow the examples of RFC 7396, appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{name: "replace member", doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add member", doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "null removes", doc: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "null removes only that member", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "array replaced", doc: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "value becomes array", doc: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "nested merge", doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "non-object patch replaces", doc: `["a","b"]`, patch: `["c","d"]`, want: `["c","d"]`},
+		{name: "object patch over array", doc: `["a"]`, patch: `{"a":"b"}`, want: `{"a":"b"}`},
+		{name: "null in new object dropped", doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("MergePatch: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestMergePatchRejectsInvalidJSON(t *testing.T) {
+	if _, err := MergePatch([]byte(`{`), []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "invalid document") {
+		t.Errorf("bad document: error = %v", err)
+	}
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); err == nil || !strings.Contains(err.Error(), "invalid merge patch") {
+		t.Errorf("bad patch: error = %v", err)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	const doc = `{"name":"Ann","subjects":["yoga","pilates"],"meta":{"a/b":1,"m~n":2}}`
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+		err   string
+	}{
+		{
+			name:  "replace member",
+			patch: `[{"op":"replace","path":"/name","value":"Bob"}]`,
+			want:  `{"name":"Bob","subjects":["yoga","pilates"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "add to object",
+			patch: `[{"op":"add","path":"/email","value":"a@b.c"}]`,
+			want:  `{"name":"Ann","email":"a@b.c","subjects":["yoga","pilates"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "append with dash",
+			patch: `[{"op":"add","path":"/subjects/-","value":"spin"}]`,
+			want:  `{"name":"Ann","subjects":["yoga","pilates","spin"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "insert at index",
+			patch: `[{"op":"add","path":"/subjects/0","value":"spin"}]`,
+			want:  `{"name":"Ann","subjects":["spin","yoga","pilates"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "remove array element",
+			patch: `[{"op":"remove","path":"/subjects/0"}]`,
+			want:  `{"name":"Ann","subjects":["pilates"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "escaped pointer tokens",
+			patch: `[{"op":"remove","path":"/meta/a~1b"},{"op":"replace","path":"/meta/m~0n","value":3}]`,
+			want:  `{"name":"Ann","subjects":["yoga","pilates"],"meta":{"m~n":3}}`,
+		},
+		{
+			name:  "move",
+			patch: `[{"op":"move","from":"/subjects/1","path":"/subjects/0"}]`,
+			want:  `{"name":"Ann","subjects":["pilates","yoga"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "copy is deep",
+			patch: `[{"op":"copy","from":"/meta","path":"/copy"},{"op":"remove","path":"/meta/m~0n"}]`,
+			want:  `{"name":"Ann","subjects":["yoga","pilates"],"meta":{"a/b":1},"copy":{"a/b":1,"m~n":2}}`,
+		},
+		{
+			name:  "passing test",
+			patch: `[{"op":"test","path":"/subjects","value":["yoga","pilates"]},{"op":"replace","path":"/name","value":"Bob"}]`,
+			want:  `{"name":"Bob","subjects":["yoga","pilates"],"meta":{"a/b":1,"m~n":2}}`,
+		},
+		{name: "failing test aborts the patch", patch: `[{"op":"replace","path":"/name","value":"Bob"},{"op":"test","path":"/name","value":"Ann"}]`, err: "operation 1 (test /name) failed: test failed"},
+		{name: "replace missing member", patch: `[{"op":"replace","path":"/email","value":"x"}]`, err: "path not found"},
+		{name: "remove missing member", patch: `[{"op":"remove","path":"/email"}]`, err: "path not found"},
+		{name: "index out of range", patch: `[{"op":"add","path":"/subjects/3","value":"x"}]`, err: "out of range"},
+		{name: "leading zero index", patch: `[{"op":"remove","path":"/subjects/01"}]`, err: "invalid array index"},
+		{name: "move into own child", patch: `[{"op":"move","from":"/meta","path":"/meta/x"}]`, err: "cannot move a value into one of its children"},
+		{name: "missing value", patch: `[{"op":"add","path":"/x"}]`, err: "missing value"},
+		{name: "unsupported op", patch: `[{"op":"merge","path":"/x"}]`, err: `unsupported op "merge"`},
+		{name: "relative path", patch: `[{"op":"remove","path":"name"}]`, err: `invalid path "name"`},
+		{name: "remove root", patch: `[{"op":"remove","path":""}]`, err: "cannot remove the whole document"},
+		{name: "not an array", patch: `{"op":"remove","path":"/name"}`, err: "invalid json patch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(doc), []byte(tt.patch))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("JSONPatch error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JSONPatch: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package request
+
+import (
+	"time"
+)
+
+// APIKeyRequest creates an API key. Scopes are free-form strings such as
+// "users:read"; a key without expires_at never expires.
+type APIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"max=20,dive,required,max=64"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
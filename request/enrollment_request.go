@@ -0,0 +1,5 @@
+package request
+
+type EnrollmentRequest struct {
+	Subject string `json:"subject" validate:"required"`
+}
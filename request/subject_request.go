@@ -0,0 +1,15 @@
+package request
+
+type SubjectRequest struct {
+	Slug        string `json:"slug" validate:"required,max=64"`
+	DisplayName string `json:"display_name" validate:"required,max=200"`
+	Description string `json:"description" validate:"max=2000"`
+	Active      *bool  `json:"active"`
+}
+
+// SubjectRenameRequest renames the subject From to To on every user. When
+// To is already in the catalog the two subjects are merged.
+type SubjectRenameRequest struct {
+	From string `json:"from" validate:"required"`
+	To   string `json:"to" validate:"required,max=64"`
+}
@@ -0,0 +1,8 @@
+package request
+
+type WebhookRequest struct {
+	URL        string   `json:"url" validate:"required,http_url"`
+	Secret     string   `json:"secret" validate:"omitempty,min=16"`
+	EventTypes []string `json:"event_types" validate:"required,min=1,dive,oneof=UserCreated UserUpdated UserDeleted UserRestored"`
+	Active     *bool    `json:"active"`
+}
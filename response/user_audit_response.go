@@ -0,0 +1,44 @@
+package response
+
+import (
+	"fitness-api/model"
+	"time"
+)
+
+type UserAuditEntryResponse struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"user_id"`
+	Action    string        `json:"action"`
+	Actor     string        `json:"actor"`
+	Before    *UserResponse `json:"before"`
+	After     *UserResponse `json:"after"`
+	CreatedAt string        `json:"created_at"`
+}
+
+func NewUserAuditEntryResponse(entry model.UserAuditEntry) UserAuditEntryResponse {
+	return UserAuditEntryResponse{
+		ID:        entry.Id,
+		UserID:    entry.UserId,
+		Action:    entry.Action,
+		Actor:     entry.Actor,
+		Before:    optionalUserResponse(entry.Before),
+		After:     optionalUserResponse(entry.After),
+		CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func NewUserAuditEntryResponses(entries []model.UserAuditEntry) []UserAuditEntryResponse {
+	responses := make([]UserAuditEntryResponse, len(entries))
+	for i, entry := range entries {
+		responses[i] = NewUserAuditEntryResponse(entry)
+	}
+	return responses
+}
+
+func optionalUserResponse(user *model.User) *UserResponse {
+	if user == nil {
+		return nil
+	}
+	response := NewUserResponse(*user)
+	return &response
+}
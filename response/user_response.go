@@ -1,5 +1,14 @@
 package response
 
+import (
+	"bytes"
+	"encoding/json"
+	"fitness-api/model"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type UserResponse struct {
 	ID       string   `json:"id" bson:"id"`
 	Name     string   `json:"name" bson:"name"`
@@ -9,4 +18,158 @@ type UserResponse struct {
 	CreatedAt string `json:"created_at" bson:"created_at"`
 	UpdatedAt string `json:"updated_at" bson:"updated_at"`
 	DeletedAt string `json:"deleted_at" bson:"deleted_at"`
+	Version   int    `json:"version" bson:"version"`
+}
+
+// UserFields lists the fields of a UserResponse in the order they are
+// rendered. fields= may name any of them.
+var UserFields = []string{"id", "name", "email", "subjects", "created_at", "updated_at", "deleted_at", "version"}
+
+// NewUserResponse is the one place a stored user becomes API output.
+func NewUserResponse(user model.User) UserResponse {
+	subjects := user.Subjects
+	if subjects == nil {
+		subjects = []string{}
+	}
+	return UserResponse{
+		ID:        user.Id,
+		Name:      user.Name,
+		Email:     user.Email,
+		Subjects:  subjects,
+		CreatedAt: formatTime(user.CreatedAt),
+		UpdatedAt: formatTime(user.UpdatedAt),
+		DeletedAt: formatTime(user.DeletedAt),
+		Version:   user.Version,
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Field returns the value of one of UserFields.
+func (r UserResponse) Field(name string) interface{} {
+	switch name {
+	case "id":
+		return r.ID
+	case "name":
+		return r.Name
+	case "email":
+		return r.Email
+	case "subjects":
+		return r.Subjects
+	case "created_at":
+		return r.CreatedAt
+	case "updated_at":
+		return r.UpdatedAt
+	case "deleted_at":
+		return r.DeletedAt
+	case "version":
+		return r.Version
+	}
+	return nil
+}
+
+// UserView is what a request asked to see of each user: a subset of
+// UserFields (all of them when Fields is empty) and the related resources
+// to expand inline.
+type UserView struct {
+	Fields []string
+	Expand []string
+}
+
+// ParseUserView reads the fields= and expand= parameters, both comma
+// separated. expandable lists the resources expand= may name.
+func ParseUserView(fields string, expand string, expandable []string) (UserView, error) {
+	var view UserView
+	for _, field := range splitList(fields) {
+		if !contains(UserFields, field) {
+			return UserView{}, fmt.Errorf("invalid fields: unknown field %q", field)
+		}
+		if !contains(view.Fields, field) {
+			view.Fields = append(view.Fields, field)
+		}
+	}
+	for _, resource := range splitList(expand) {
+		if !contains(expandable, resource) {
+			return UserView{}, fmt.Errorf("invalid expand: cannot expand %q", resource)
+		}
+		if !contains(view.Expand, resource) {
+			view.Expand = append(view.Expand, resource)
+		}
+	}
+	return view, nil
+}
+
+// Render maps user to its response, trimmed to the view's fields and with
+// the expanded resources added under their own names.
+func (v UserView) Render(user model.User, expanded map[string]interface{}) interface{} {
+	response := NewUserResponse(user)
+	if len(v.Fields) == 0 && len(v.Expand) == 0 {
+		return response
+	}
+
+	fields := v.Fields
+	if len(fields) == 0 {
+		fields = UserFields
+	}
+	document := make(orderedDocument, 0, len(fields)+len(v.Expand))
+	for _, field := range fields {
+		document = append(document, documentField{field, response.Field(field)})
+	}
+	for _, resource := range v.Expand {
+		document = append(document, documentField{resource, expanded[resource]})
+	}
+	return document
+}
+
+type documentField struct {
+	name  string
+	value interface{}
+}
+
+// orderedDocument is a JSON object that keeps its keys in the order given,
+// so trimmed users read like full ones.
+type orderedDocument []documentField
+
+func (d orderedDocument) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range d {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.name)
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(list []string, item string) bool {
+	for _, candidate := range list {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
 }
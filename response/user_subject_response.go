@@ -0,0 +1,46 @@
+package response
+
+import (
+	"fitness-api/model"
+)
+
+// EnrollmentResponse is one of a user's subjects with its catalog details.
+// InCatalog is false for a value that was never added to the catalog; it
+// only carries the slug.
+type EnrollmentResponse struct {
+	Slug        string `json:"slug"`
+	DisplayName string `json:"display_name"`
+	Active      bool   `json:"active"`
+	InCatalog   bool   `json:"in_catalog"`
+}
+
+// NewEnrollmentResponses describes subjects in order, taking the details
+// from catalog.
+func NewEnrollmentResponses(subjects []string, catalog []model.Subject) []EnrollmentResponse {
+	enrollments := make([]EnrollmentResponse, len(subjects))
+	for i, slug := range subjects {
+		enrollments[i] = EnrollmentResponse{Slug: slug}
+		for _, subject := range catalog {
+			if subject.Slug == slug {
+				enrollments[i] = EnrollmentResponse{Slug: slug, DisplayName: subject.DisplayName, Active: subject.Active, InCatalog: true}
+				break
+			}
+		}
+	}
+	return enrollments
+}
+
+// UserSubjectsResponse is the body of the user's subjects sub-resource.
+type UserSubjectsResponse struct {
+	UserID   string               `json:"user_id"`
+	Version  int                  `json:"version"`
+	Subjects []EnrollmentResponse `json:"subjects"`
+}
+
+func NewUserSubjectsResponse(user model.User, catalog []model.Subject) UserSubjectsResponse {
+	return UserSubjectsResponse{
+		UserID:   user.Id,
+		Version:  user.Version,
+		Subjects: NewEnrollmentResponses(user.Subjects, catalog),
+	}
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"fitness-api/model"
+	"time"
+)
+
+// APIKeyRepository stores API keys on the same backend as the users.
+// Revoked keys are kept so listings show when a key was retired.
+type APIKeyRepository interface {
+	CreateAPIKey(key model.APIKey) (model.APIKey, error)
+	GetAPIKey(id string) (model.APIKey, error)
+	// GetAPIKeyByHash finds the key whose hash is keyHash, revoked or not.
+	GetAPIKeyByHash(keyHash string) (model.APIKey, error)
+	// ListAPIKeys returns every key, oldest first.
+	ListAPIKeys() ([]model.APIKey, error)
+	// RevokeAPIKey marks the key revoked. Revoking it again keeps the first
+	// revocation time.
+	RevokeAPIKey(id string, revokedAt time.Time) (model.APIKey, error)
+	TouchAPIKey(id string, usedAt time.Time) error
+}
@@ -0,0 +1,115 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"fitness-api/migrations"
+	"fitness-api/model"
+	"fitness-api/service"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// openSQLiteRepository returns a repository on a freshly migrated database
+// in the test's temporary directory.
+func openSQLiteRepository(t *testing.T) *service.SQLiteUserRepository {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fitness.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_time_format=sqlite")
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.NewSQLMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatalf("NewSQLMigrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return service.NewSQLiteUserRepository(db)
+}
+
+func TestWritesRecordTheirAuditEntries(t *testing.T) {
+	backends := map[string]func(t *testing.T) service.UserRepository{
+		"memory": func(t *testing.T) service.UserRepository { return service.NewMemoryUserRepository() },
+		"sqlite": func(t *testing.T) service.UserRepository { return openSQLiteRepository(t) },
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			repo := open(t)
+			ctx := context.Background()
+			now := time.Now()
+
+			created, err := repo.CreateUser(model.User{Name: "Ann", Email: "ann@example.com", Subjects: []string{}, CreatedAt: &now, UpdatedAt: &now}, "alice")
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			if _, err := repo.UpdateUser(model.User{Name: "Ann B", Email: "ann@example.com", Subjects: []string{}, UpdatedAt: &now}, created.Id, 1, "bob"); err != nil {
+				t.Fatalf("UpdateUser: %v", err)
+			}
+			if _, _, err := repo.AddUserSubject(created.Id, "yoga", now, "carol"); err != nil {
+				t.Fatalf("AddUserSubject: %v", err)
+			}
+			if err := repo.DeleteUser(created.Id, "dave"); err != nil {
+				t.Fatalf("DeleteUser: %v", err)
+			}
+			if _, err := repo.RestoreUser(created.Id, "erin"); err != nil {
+				t.Fatalf("RestoreUser: %v", err)
+			}
+			if err := repo.DeleteUser(created.Id, "dave"); err != nil {
+				t.Fatalf("DeleteUser: %v", err)
+			}
+			purged, err := repo.PurgeDeletedUsers(time.Now().Add(time.Minute), "frank")
+			if err != nil || purged != 1 {
+				t.Fatalf("PurgeDeletedUsers = %d, %v; want 1", purged, err)
+			}
+			if _, err := repo.ImportUsers(ctx, []model.User{{Name: "Imp", Email: "imp@example.com", Subjects: []string{}, CreatedAt: &now, UpdatedAt: &now}}, true, "grace"); err != nil {
+				t.Fatalf("ImportUsers: %v", err)
+			}
+
+			entries, _, total, err := repo.GetUserHistory(created.Id, 10, 1)
+			if err != nil {
+				t.Fatalf("GetUserHistory: %v", err)
+			}
+			want := []struct {
+				action, actor string
+				before, after int
+			}{
+				{model.AuditActionPurge, "frank", 6, 0},
+				{model.AuditActionDelete, "dave", 5, 6},
+				{model.AuditActionRestore, "erin", 4, 5},
+				{model.AuditActionDelete, "dave", 3, 4},
+				{model.AuditActionUpdate, "carol", 2, 3},
+				{model.AuditActionUpdate, "bob", 1, 2},
+				{model.AuditActionCreate, "alice", 0, 1},
+			}
+			if total != len(want) || len(entries) != len(want) {
+				t.Fatalf("history has %d entries (total %d), want %d", len(entries), total, len(want))
+			}
+			for i, w := range want {
+				entry := entries[i]
+				beforeVersion, afterVersion := 0, 0
+				if entry.Before != nil {
+					beforeVersion = entry.Before.Version
+				}
+				if entry.After != nil {
+					afterVersion = entry.After.Version
+				}
+				if entry.Action != w.action || entry.Actor != w.actor || beforeVersion != w.before || afterVersion != w.after {
+					t.Errorf("entry %d = %s by %s, versions %d -> %d; want %s by %s, %d -> %d",
+						i, entry.Action, entry.Actor, beforeVersion, afterVersion, w.action, w.actor, w.before, w.after)
+				}
+			}
+			if before := entries[5].Before; before == nil || before.Name != "Ann" {
+				t.Errorf("update before = %+v, want the stored name Ann", before)
+			}
+		})
+	}
+}
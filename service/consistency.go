@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"fmt"
+	"time"
+)
+
+// UserMismatch lists the differing fields of a user present in both stores.
+type UserMismatch struct {
+	Id     string      `json:"id"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+// ConsistencyReport is the result of comparing two user stores.
+type ConsistencyReport struct {
+	Left           string         `json:"left"`
+	Right          string         `json:"right"`
+	LeftCount      int            `json:"left_count"`
+	RightCount     int            `json:"right_count"`
+	MissingInLeft  []string       `json:"missing_in_left"`
+	MissingInRight []string       `json:"missing_in_right"`
+	Mismatches     []UserMismatch `json:"mismatches"`
+	TimestampDrift []UserMismatch `json:"timestamp_drift"`
+	MaxDrift       time.Duration  `json:"max_drift_ns"`
+}
+
+func (r ConsistencyReport) Consistent() bool {
+	return len(r.MissingInLeft) == 0 && len(r.MissingInRight) == 0 &&
+		len(r.Mismatches) == 0 && len(r.TimestampDrift) == 0
+}
+
+// CompareUserStores walks both stores in id order side by side, so memory use
+// is bounded by batchSize regardless of how many users they hold.
+func CompareUserStores(ctx context.Context, leftName string, left UserBatchReader, rightName string, right UserBatchReader, batchSize int) (ConsistencyReport, error) {
+	report := ConsistencyReport{Left: leftName, Right: rightName}
+	leftIter := &userIterator{reader: left, batchSize: batchSize}
+	rightIter := &userIterator{reader: right, batchSize: batchSize}
+
+	leftUser, leftOK, err := leftIter.next(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to read %s: %v", leftName, err)
+	}
+	rightUser, rightOK, err := rightIter.next(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to read %s: %v", rightName, err)
+	}
+
+	for leftOK || rightOK {
+		advanceLeft, advanceRight := false, false
+		switch {
+		case !rightOK || (leftOK && leftUser.Id < rightUser.Id):
+			report.MissingInRight = append(report.MissingInRight, leftUser.Id)
+			advanceLeft = true
+		case !leftOK || rightUser.Id < leftUser.Id:
+			report.MissingInLeft = append(report.MissingInLeft, rightUser.Id)
+			advanceRight = true
+		default:
+			report.addDiffs(leftUser.Id, DiffUsers(leftUser, rightUser))
+			advanceLeft, advanceRight = true, true
+		}
+
+		if advanceLeft {
+			report.LeftCount++
+			if leftUser, leftOK, err = leftIter.next(ctx); err != nil {
+				return report, fmt.Errorf("failed to read %s: %v", leftName, err)
+			}
+		}
+		if advanceRight {
+			report.RightCount++
+			if rightUser, rightOK, err = rightIter.next(ctx); err != nil {
+				return report, fmt.Errorf("failed to read %s: %v", rightName, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func (r *ConsistencyReport) addDiffs(id string, diffs []FieldDiff) {
+	var fields, drift []FieldDiff
+	for _, diff := range diffs {
+		switch diff.Field {
+		case "created_at", "updated_at", "deleted_at":
+			drift = append(drift, diff)
+			if diff.Drift.Abs() > r.MaxDrift {
+				r.MaxDrift = diff.Drift.Abs()
+			}
+		default:
+			fields = append(fields, diff)
+		}
+	}
+	if len(fields) > 0 {
+		r.Mismatches = append(r.Mismatches, UserMismatch{Id: id, Fields: fields})
+	}
+	if len(drift) > 0 {
+		r.TimestampDrift = append(r.TimestampDrift, UserMismatch{Id: id, Fields: drift})
+	}
+}
+
+// userIterator hands out users one at a time from UsersAfter batches.
+type userIterator struct {
+	reader    UserBatchReader
+	batchSize int
+	batch     []model.User
+	lastID    string
+	done      bool
+}
+
+func (it *userIterator) next(ctx context.Context) (model.User, bool, error) {
+	if len(it.batch) == 0 && !it.done {
+		users, err := it.reader.UsersAfter(ctx, it.lastID, it.batchSize)
+		if err != nil {
+			return model.User{}, false, err
+		}
+		if len(users) < it.batchSize {
+			it.done = true
+		}
+		if len(users) > 0 {
+			it.lastID = users[len(users)-1].Id
+		}
+		it.batch = users
+	}
+	if len(it.batch) == 0 {
+		return model.User{}, false, nil
+	}
+
+	user := it.batch[0]
+	it.batch = it.batch[1:]
+	return user, true, nil
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// SecondaryUserRepository is what the dual-write mode needs from the backend
+// that follows the primary: the normal operations plus inserting a user
+// under the id the primary already issued and overwriting a user with the
+// primary's copy. Its outbox is switched off since the primary already
+// announces every change.
+type SecondaryUserRepository interface {
+	UserRepository
+	UserBatchWriter
+	UserReplacer
+	DisableOutbox()
+}
+
+// DualWriteStats counts what the dual-write mode observed since startup.
+type DualWriteStats struct {
+	SecondaryWrites      int64 `json:"secondary_writes"`
+	SecondaryWriteErrors int64 `json:"secondary_write_errors"`
+	ShadowReads          int64 `json:"shadow_reads"`
+	ShadowReadMismatches int64 `json:"shadow_read_mismatches"`
+	ShadowReadErrors     int64 `json:"shadow_read_errors"`
+	ShadowReadsSkipped   int64 `json:"shadow_reads_skipped"`
+}
+
+// DualWriteUserRepository sends every write to both backends and serves
+// reads from the primary. Each read is repeated against the secondary in the
+// background and any difference is logged and counted, so the secondary can
+// be verified against real traffic before it becomes the primary.
+//
+// The primary decides the outcome of every request; secondary failures are
+// only logged so they never affect clients.
+type DualWriteUserRepository struct {
+	primary   UserRepository
+	secondary SecondaryUserRepository
+	// shadowSlots bounds the number of comparisons running at once. Reads
+	// arriving while it is full skip the comparison.
+	shadowSlots chan struct{}
+	stats       struct {
+		secondaryWrites      atomic.Int64
+		secondaryWriteErrors atomic.Int64
+		shadowReads          atomic.Int64
+		shadowReadMismatches atomic.Int64
+		shadowReadErrors     atomic.Int64
+		shadowReadsSkipped   atomic.Int64
+	}
+}
+
+func NewDualWriteUserRepository(primary UserRepository, secondary SecondaryUserRepository, maxShadowReads int) *DualWriteUserRepository {
+	secondary.DisableOutbox()
+	return &DualWriteUserRepository{
+		primary:     primary,
+		secondary:   secondary,
+		shadowSlots: make(chan struct{}, maxShadowReads),
+	}
+}
+
+func (r *DualWriteUserRepository) Stats() DualWriteStats {
+	return DualWriteStats{
+		SecondaryWrites:      r.stats.secondaryWrites.Load(),
+		SecondaryWriteErrors: r.stats.secondaryWriteErrors.Load(),
+		ShadowReads:          r.stats.shadowReads.Load(),
+		ShadowReadMismatches: r.stats.shadowReadMismatches.Load(),
+		ShadowReadErrors:     r.stats.shadowReadErrors.Load(),
+		ShadowReadsSkipped:   r.stats.shadowReadsSkipped.Load(),
+	}
+}
+
+func (r *DualWriteUserRepository) CreateUser(user model.User, actor string) (model.User, error) {
+	createdUser, err := r.primary.CreateUser(user, actor)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	r.writeSecondary("create", createdUser.Id, func() error {
+		return r.upsertSecondary(createdUser)
+	})
+	return createdUser, nil
+}
+
+func (r *DualWriteUserRepository) UpdateUser(user model.User, id string, expectedVersion int, actor string) (model.User, error) {
+	updatedUser, err := r.primary.UpdateUser(user, id, expectedVersion, actor)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	// Replay the primary's result rather than the request so both sides end
+	// up with identical fields.
+	r.writeSecondary("update", updatedUser.Id, func() error {
+		return r.upsertSecondary(updatedUser)
+	})
+	return updatedUser, nil
+}
+
+func (r *DualWriteUserRepository) DeleteUser(id string, actor string) error {
+	if err := r.primary.DeleteUser(id, actor); err != nil {
+		return err
+	}
+
+	// Copy the primary's deleted_at and version instead of deleting on the
+	// secondary, which would stamp its own.
+	r.writeSecondary("delete", id, func() error {
+		user, err := r.primary.GetUserByID(id, true)
+		if err != nil {
+			return fmt.Errorf("failed to read deleted user from primary: %v", err)
+		}
+		return r.upsertSecondary(user)
+	})
+	return nil
+}
+
+func (r *DualWriteUserRepository) RestoreUser(id string, actor string) (model.User, error) {
+	user, err := r.primary.RestoreUser(id, actor)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	r.writeSecondary("restore", id, func() error {
+		return r.upsertSecondary(user)
+	})
+	return user, nil
+}
+
+// PurgeDeletedUsers purges both sides with the same cutoff. Each records
+// its own audit entries for the users it removed.
+func (r *DualWriteUserRepository) PurgeDeletedUsers(deletedBefore time.Time, actor string) (int, error) {
+	purged, err := r.primary.PurgeDeletedUsers(deletedBefore, actor)
+	if err != nil {
+		return 0, err
+	}
+
+	r.writeSecondary("purge", "*", func() error {
+		_, err := r.secondary.PurgeDeletedUsers(deletedBefore, actor)
+		return err
+	})
+	return purged, nil
+}
+
+func (r *DualWriteUserRepository) GetAllUsers(query UserQuery) ([]model.User, int, int, error) {
+	users, lastPage, totalDocuments, err := r.primary.GetAllUsers(query)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	label := fmt.Sprintf("GetAllUsers(%+v)", query)
+	r.shadowRead(label, func() ([]string, error) {
+		shadowUsers, _, shadowTotal, err := r.secondary.GetAllUsers(query)
+		if err != nil {
+			return nil, err
+		}
+
+		var mismatches []string
+		if shadowTotal != totalDocuments {
+			mismatches = append(mismatches, fmt.Sprintf("total_documents %d != %d", totalDocuments, shadowTotal))
+		}
+		if len(shadowUsers) != len(users) {
+			mismatches = append(mismatches, fmt.Sprintf("page length %d != %d", len(users), len(shadowUsers)))
+			return mismatches, nil
+		}
+		for i := range users {
+			if users[i].Id != shadowUsers[i].Id {
+				mismatches = append(mismatches, fmt.Sprintf("position %d: id %s != %s", i, users[i].Id, shadowUsers[i].Id))
+				continue
+			}
+			for _, diff := range DiffUsers(users[i], shadowUsers[i]) {
+				mismatches = append(mismatches, fmt.Sprintf("user %s: %s %q != %q", users[i].Id, diff.Field, diff.Left, diff.Right))
+			}
+		}
+		return mismatches, nil
+	})
+
+	return users, lastPage, totalDocuments, nil
+}
+
+func (r *DualWriteUserRepository) GetUserByID(id string, includeDeleted bool) (model.User, error) {
+	user, err := r.primary.GetUserByID(id, includeDeleted)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	r.shadowRead(fmt.Sprintf("GetUserByID(%s)", id), func() ([]string, error) {
+		shadowUser, err := r.secondary.GetUserByID(id, includeDeleted)
+		if err != nil {
+			return nil, err
+		}
+		var mismatches []string
+		for _, diff := range DiffUsers(user, shadowUser) {
+			mismatches = append(mismatches, fmt.Sprintf("%s %q != %q", diff.Field, diff.Left, diff.Right))
+		}
+		return mismatches, nil
+	})
+
+	return user, nil
+}
+
+func (r *DualWriteUserRepository) GetUsersPage(query UserQuery, cursor *UserCursor) ([]model.User, bool, error) {
+	users, hasMore, err := r.primary.GetUsersPage(query, cursor)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.shadowRead(fmt.Sprintf("GetUsersPage(%+v, %+v)", query, cursor), func() ([]string, error) {
+		shadowUsers, shadowHasMore, err := r.secondary.GetUsersPage(query, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		var mismatches []string
+		if shadowHasMore != hasMore {
+			mismatches = append(mismatches, fmt.Sprintf("has_more %t != %t", hasMore, shadowHasMore))
+		}
+		if len(shadowUsers) != len(users) {
+			mismatches = append(mismatches, fmt.Sprintf("page length %d != %d", len(users), len(shadowUsers)))
+			return mismatches, nil
+		}
+		for i := range users {
+			if users[i].Id != shadowUsers[i].Id {
+				mismatches = append(mismatches, fmt.Sprintf("position %d: id %s != %s", i, users[i].Id, shadowUsers[i].Id))
+			}
+		}
+		return mismatches, nil
+	})
+
+	return users, hasMore, nil
+}
+
+func (r *DualWriteUserRepository) SearchUsers(ctx context.Context, search UserSearch) ([]UserSearchResult, error) {
+	return r.primary.SearchUsers(ctx, search)
+}
+
+// StreamUsers reads from the primary only; exports are too large to compare
+// in the background.
+func (r *DualWriteUserRepository) StreamUsers(ctx context.Context, query UserQuery, fn func(model.User) error) error {
+	return r.primary.StreamUsers(ctx, query, fn)
+}
+
+// ImportUsers imports into the primary and copies the users it created, and
+// their audit entries, to the secondary under the same ids.
+func (r *DualWriteUserRepository) ImportUsers(ctx context.Context, users []model.User, atomic bool, actor string) ([]InsertResult, error) {
+	results, err := r.primary.ImportUsers(ctx, users, atomic, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []model.User
+	for _, result := range results {
+		if result.Status != InsertCreated {
+			continue
+		}
+		user, err := r.primary.GetUserByID(result.Id, false)
+		if err != nil {
+			log.Printf("Dual-write: imported user %s could not be read back: %v", result.Id, err)
+			continue
+		}
+		created = append(created, user)
+	}
+	if len(created) > 0 {
+		r.writeSecondary("import", fmt.Sprintf("batch of %d", len(created)), func() error {
+			if _, err := r.secondary.InsertUsers(ctx, created, false); err != nil {
+				return err
+			}
+			for _, user := range created {
+				if err := r.mirrorAudit(user); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return results, nil
+}
+
+func (r *DualWriteUserRepository) CountUsersBySubject(ctx context.Context, query UserStatsQuery) ([]SubjectCount, error) {
+	return r.primary.CountUsersBySubject(ctx, query)
+}
+
+func (r *DualWriteUserRepository) CountSignups(ctx context.Context, interval string, query UserStatsQuery) ([]SignupBucket, error) {
+	return r.primary.CountSignups(ctx, interval, query)
+}
+
+func (r *DualWriteUserRepository) CountUsers(ctx context.Context, query UserStatsQuery) (UserTotals, error) {
+	return r.primary.CountUsers(ctx, query)
+}
+
+func (r *DualWriteUserRepository) AddUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	user, changed, err := r.primary.AddUserSubject(id, subject, updatedAt, actor)
+	if err != nil || !changed {
+		return user, changed, err
+	}
+	r.writeSecondary("subject add", user.Id, func() error { return r.upsertSecondary(user) })
+	return user, true, nil
+}
+
+func (r *DualWriteUserRepository) RemoveUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	user, changed, err := r.primary.RemoveUserSubject(id, subject, updatedAt, actor)
+	if err != nil || !changed {
+		return user, changed, err
+	}
+	r.writeSecondary("subject remove", user.Id, func() error { return r.upsertSecondary(user) })
+	return user, true, nil
+}
+
+// ReplaceSubject rewrites the subject on both sides with the same timestamp,
+// so the users stay identical.
+func (r *DualWriteUserRepository) ReplaceSubject(ctx context.Context, from string, to string, updatedAt time.Time) (int, error) {
+	replaced, err := r.primary.ReplaceSubject(ctx, from, to, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	r.writeSecondary("subject rename", fmt.Sprintf("with subject %s", from), func() error {
+		_, err := r.secondary.ReplaceSubject(ctx, from, to, updatedAt)
+		return err
+	})
+	return replaced, nil
+}
+
+// RecordUserAudit stores the entry on both sides under the same id so the
+// history survives a cutover to the secondary.
+func (r *DualWriteUserRepository) RecordUserAudit(entry model.UserAuditEntry) error {
+	if entry.Id == "" {
+		entry.Id = newID()
+	}
+	if err := r.primary.RecordUserAudit(entry); err != nil {
+		return err
+	}
+	r.writeSecondary("audit", entry.UserId, func() error { return r.secondary.RecordUserAudit(entry) })
+	return nil
+}
+
+func (r *DualWriteUserRepository) GetUserHistory(userID string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error) {
+	return r.primary.GetUserHistory(userID, pageSize, pageNo)
+}
+
+func (r *DualWriteUserRepository) PendingUserEvents(ctx context.Context, limit int) ([]model.UserEvent, error) {
+	return r.primary.PendingUserEvents(ctx, limit)
+}
+
+func (r *DualWriteUserRepository) MarkUserEventPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	return r.primary.MarkUserEventPublished(ctx, id, publishedAt)
+}
+
+// upsertSecondary makes the secondary's copy of user identical to the
+// primary's, version and deleted_at included, and copies the audit entry of
+// the change. The user is inserted with the primary's id when the secondary
+// does not have it yet (for example because it was created before
+// dual-write was switched on).
+func (r *DualWriteUserRepository) upsertSecondary(user model.User) error {
+	if err := r.secondary.ReplaceUser(context.Background(), user); err != nil {
+		return err
+	}
+	return r.mirrorAudit(user)
+}
+
+// auditMirrorWindow is how many of the primary's newest entries for a user
+// mirrorAudit searches for the one a write just recorded.
+const auditMirrorWindow = 10
+
+// mirrorAudit copies the primary's audit entry for the change that left user
+// at its current version to the secondary under the same id, so the history
+// survives a cutover to the secondary.
+func (r *DualWriteUserRepository) mirrorAudit(user model.User) error {
+	entries, _, _, err := r.primary.GetUserHistory(user.Id, auditMirrorWindow, 1)
+	if err != nil {
+		return fmt.Errorf("failed to read audit entry from primary: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.After != nil && entry.After.Version == user.Version {
+			return r.secondary.RecordUserAudit(entry)
+		}
+	}
+	return fmt.Errorf("no audit entry for version %d on the primary", user.Version)
+}
+
+func (r *DualWriteUserRepository) writeSecondary(operation string, id string, write func() error) {
+	r.stats.secondaryWrites.Add(1)
+	if err := write(); err != nil {
+		r.stats.secondaryWriteErrors.Add(1)
+		log.Printf("Dual-write: secondary %s of user %s failed: %v", operation, id, err)
+	}
+}
+
+// shadowRead runs compare in the background and records its outcome.
+// compare returns a description of every mismatch it found.
+func (r *DualWriteUserRepository) shadowRead(label string, compare func() ([]string, error)) {
+	select {
+	case r.shadowSlots <- struct{}{}:
+	default:
+		r.stats.shadowReadsSkipped.Add(1)
+		return
+	}
+
+	go func() {
+		defer func() { <-r.shadowSlots }()
+
+		mismatches, err := compare()
+		r.stats.shadowReads.Add(1)
+		if err != nil {
+			r.stats.shadowReadErrors.Add(1)
+			log.Printf("Shadow read %s failed: %v", label, err)
+			return
+		}
+		if len(mismatches) == 0 {
+			return
+		}
+
+		r.stats.shadowReadMismatches.Add(1)
+		for _, mismatch := range mismatches {
+			log.Printf("Shadow read %s mismatch: %s", label, mismatch)
+		}
+	}()
+}
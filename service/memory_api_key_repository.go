@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fitness-api/model"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryAPIKeyRepository keeps API keys in process memory, alongside
+// MemoryUserRepository.
+type MemoryAPIKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[string]model.APIKey
+}
+
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{keys: make(map[string]model.APIKey)}
+}
+
+func (r *MemoryAPIKeyRepository) CreateAPIKey(key model.APIKey) (model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.KeyHash == key.KeyHash {
+			return model.APIKey{}, fmt.Errorf("failed to create API key: duplicate key hash")
+		}
+	}
+	key.Id = newID()
+	r.keys[key.Id] = key
+	return key, nil
+}
+
+func (r *MemoryAPIKeyRepository) GetAPIKey(id string) (model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return model.APIKey{}, fmt.Errorf("no API key found with id %s", id)
+	}
+	return key, nil
+}
+
+func (r *MemoryAPIKeyRepository) GetAPIKeyByHash(keyHash string) (model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return model.APIKey{}, fmt.Errorf("no API key found with the given hash")
+}
+
+func (r *MemoryAPIKeyRepository) ListAPIKeys() ([]model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]model.APIKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) RevokeAPIKey(id string, revokedAt time.Time) (model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return model.APIKey{}, fmt.Errorf("no API key found with id %s", id)
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		r.keys[id] = key
+	}
+	return key, nil
+}
+
+func (r *MemoryAPIKeyRepository) TouchAPIKey(id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return fmt.Errorf("no API key found with id %s", id)
+	}
+	key.LastUsedAt = &usedAt
+	r.keys[id] = key
+	return nil
+}
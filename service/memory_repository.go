@@ -0,0 +1,494 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository keeps users in process memory. It is meant for local
+// development and tests where MongoDB and PostgreSQL are not available, and
+// mirrors the PostgreSQL semantics for uniqueness, filtering and paging.
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[string]model.User
+	audit  map[string][]model.UserAuditEntry
+	outbox []model.UserEvent
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: make(map[string]model.User), audit: make(map[string][]model.UserAuditEntry)}
+}
+
+func (r *MemoryUserRepository) CreateUser(user model.User, actor string) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, "") {
+		log.Printf("Duplicate email found: %s\n", user.Email)
+		return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+	}
+
+	user.Id = newID()
+	user.Version = 1
+	user.Subjects = copySubjects(user.Subjects)
+	r.users[user.Id] = user
+	r.writeEvent(model.UserCreated, user)
+	r.writeAudit(newAuditEntry(model.AuditActionCreate, actor, nil, &user))
+
+	log.Println("User successfully created in memory")
+	return copyUser(user), nil
+}
+
+func (r *MemoryUserRepository) UpdateUser(user model.User, id string, expectedVersion int, actor string) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[id]
+	if !ok || existing.DeletedAt != nil {
+		return model.User{}, fmt.Errorf("no user found with the given ID: %s", id)
+	}
+	if expectedVersion != 0 && existing.Version != expectedVersion {
+		return model.User{}, fmt.Errorf("version mismatch for user %s", id)
+	}
+	if r.emailTaken(user.Email, id) {
+		return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+	}
+
+	before := existing
+	existing.Name = user.Name
+	existing.Email = user.Email
+	existing.Subjects = copySubjects(user.Subjects)
+	existing.UpdatedAt = user.UpdatedAt
+	existing.Version++
+	r.users[id] = existing
+	r.writeEvent(model.UserUpdated, existing)
+	r.writeAudit(newAuditEntry(model.AuditActionUpdate, actor, &before, &existing))
+
+	log.Println("User successfully updated in memory")
+	return copyUser(existing), nil
+}
+
+func (r *MemoryUserRepository) DeleteUser(id string, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return fmt.Errorf("no user found with id %s", id)
+	}
+	before := user
+	now := time.Now()
+	user.DeletedAt = &now
+	user.Version++
+	r.users[id] = user
+	r.writeEvent(model.UserDeleted, user)
+	r.writeAudit(newAuditEntry(model.AuditActionDelete, actor, &before, &user))
+
+	log.Println("User successfully deleted from memory")
+	return nil
+}
+
+func (r *MemoryUserRepository) RestoreUser(id string, actor string) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return model.User{}, fmt.Errorf("no deleted user found with id %s", id)
+	}
+	before := user
+	user.DeletedAt = nil
+	user.Version++
+	r.users[id] = user
+	r.writeEvent(model.UserRestored, user)
+	r.writeAudit(newAuditEntry(model.AuditActionRestore, actor, &before, &user))
+
+	log.Println("User successfully restored in memory")
+	return copyUser(user), nil
+}
+
+func (r *MemoryUserRepository) PurgeDeletedUsers(deletedBefore time.Time, actor string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for id, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			delete(r.users, id)
+			r.writeAudit(newAuditEntry(model.AuditActionPurge, actor, &user, nil))
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *MemoryUserRepository) GetAllUsers(query UserQuery) ([]model.User, int, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pageSize, pageNo := query.PageSize, query.PageNo
+	orderby, order := userOrder(query)
+
+	var users []model.User
+	for _, user := range r.users {
+		if matchesUserQuery(user, query) {
+			users = append(users, copyUser(user))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		a, b := UserSortKey(users[i], orderby), UserSortKey(users[j], orderby)
+		if a == b {
+			a, b = users[i].Id, users[j].Id
+		}
+		if order == "DESC" {
+			return a > b
+		}
+		return a < b
+	})
+
+	totalDocuments := len(users)
+	if pageSize == -1 {
+		return users, 1, totalDocuments, nil
+	}
+
+	start := (pageNo - 1) * pageSize
+	if start > totalDocuments {
+		start = totalDocuments
+	}
+	end := start + pageSize
+	if end > totalDocuments {
+		end = totalDocuments
+	}
+
+	lastPage := (totalDocuments + pageSize - 1) / pageSize
+	return users[start:end], lastPage, totalDocuments, nil
+}
+
+func (r *MemoryUserRepository) GetUserByID(id string, includeDeleted bool) (model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || (user.DeletedAt != nil && !includeDeleted) {
+		return model.User{}, fmt.Errorf("user not found")
+	}
+	return copyUser(user), nil
+}
+
+// emailTaken reports whether another user than exceptID already uses email.
+// Callers must hold r.mu.
+func (r *MemoryUserRepository) emailTaken(email string, exceptID string) bool {
+	for id, user := range r.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSubject(subjects []string, subject string) bool {
+	for _, s := range subjects {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
+func copySubjects(subjects []string) []string {
+	if subjects == nil {
+		return nil
+	}
+	return append([]string(nil), subjects...)
+}
+
+func copyUser(user model.User) model.User {
+	user.Subjects = copySubjects(user.Subjects)
+	return user
+}
+
+func (r *MemoryUserRepository) RecordUserAudit(entry model.UserAuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.Id == "" {
+		entry.Id = newID()
+	}
+	r.writeAudit(entry)
+	return nil
+}
+
+// writeAudit appends to the user's history; callers hold r.mu so the entry
+// is recorded atomically with the change.
+func (r *MemoryUserRepository) writeAudit(entry model.UserAuditEntry) {
+	entry.Before = copyUserPtr(entry.Before)
+	entry.After = copyUserPtr(entry.After)
+	r.audit[entry.UserId] = append(r.audit[entry.UserId], entry)
+}
+
+func (r *MemoryUserRepository) GetUserHistory(userID string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.audit[userID]
+	totalDocuments := len(entries)
+	start := min((pageNo-1)*pageSize, totalDocuments)
+	end := min(start+pageSize, totalDocuments)
+
+	page := make([]model.UserAuditEntry, 0, end-start)
+	for i := totalDocuments - 1 - start; i > totalDocuments-1-end; i-- {
+		entry := entries[i]
+		entry.Before = copyUserPtr(entry.Before)
+		entry.After = copyUserPtr(entry.After)
+		page = append(page, entry)
+	}
+
+	lastPage := (totalDocuments + pageSize - 1) / pageSize
+	return page, lastPage, totalDocuments, nil
+}
+
+func copyUserPtr(user *model.User) *model.User {
+	if user == nil {
+		return nil
+	}
+	copied := copyUser(*user)
+	return &copied
+}
+
+// writeEvent appends to the outbox; callers hold r.mu so the event is
+// recorded atomically with the change.
+func (r *MemoryUserRepository) writeEvent(eventType string, user model.User) {
+	r.outbox = append(r.outbox, newUserEvent(eventType, user))
+}
+
+func (r *MemoryUserRepository) PendingUserEvents(ctx context.Context, limit int) ([]model.UserEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pending := make([]model.UserEvent, 0, min(limit, len(r.outbox)))
+	for _, event := range r.outbox[:cap(pending)] {
+		event.User = copyUser(event.User)
+		pending = append(pending, event)
+	}
+	return pending, nil
+}
+
+// MarkUserEventPublished drops the event, there being no durable history to
+// keep in memory.
+
+func (r *MemoryUserRepository) MarkUserEventPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.outbox {
+		if r.outbox[i].Id == id {
+			r.outbox = append(r.outbox[:i], r.outbox[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no outbox event found with id %s", id)
+}
+
+func (r *MemoryUserRepository) ImportUsers(ctx context.Context, users []model.User, atomic bool, actor string) ([]InsertResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users = withNewIDs(users)
+	emailOwners := map[string]string{}
+	for _, user := range users {
+		for id, stored := range r.users {
+			if stored.Email == user.Email {
+				emailOwners[user.Email] = id
+			}
+		}
+	}
+
+	results := classifyBatch(users, nil, emailOwners)
+	if atomic && !allCreated(results) {
+		return rejectImport(results), nil
+	}
+	for i, result := range results {
+		if result.Status == InsertCreated {
+			user := users[i]
+			user.Subjects = copySubjects(user.Subjects)
+			r.users[user.Id] = user
+			r.writeEvent(model.UserCreated, user)
+			r.writeAudit(newAuditEntry(model.AuditActionCreate, actor, nil, &user))
+		}
+	}
+	return results, nil
+}
+
+// StreamUsers works on a copy of the matching users taken under the lock, so
+// fn may call back into the repository.
+func (r *MemoryUserRepository) StreamUsers(ctx context.Context, query UserQuery, fn func(model.User) error) error {
+	query.PageSize = -1
+	users, _, _, err := r.GetAllUsers(query)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryUserRepository) GetUsersPage(query UserQuery, cursor *UserCursor) ([]model.User, bool, error) {
+	pageSize := query.PageSize
+	orderby, order := userOrder(query)
+	query.PageSize = -1
+	users, _, _, err := r.GetAllUsers(query)
+	if err != nil {
+		return nil, false, err
+	}
+
+	comparison, direction := keysetDirection(order, cursor)
+	if direction != order {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	var page []model.User
+	for _, user := range users {
+		if len(page) > pageSize {
+			break
+		}
+		if cursor != nil {
+			key, cursorKey := UserSortKey(user, orderby), cursor.Key
+			if key == cursorKey {
+				key, cursorKey = user.Id, cursor.Id
+			}
+			if (comparison == "<" && key >= cursorKey) || (comparison == ">" && key <= cursorKey) {
+				continue
+			}
+		}
+		page = append(page, user)
+	}
+
+	page, hasMore := keysetPage(page, pageSize, cursor)
+	return page, hasMore, nil
+}
+
+// SearchUsers scores the stored users in place and copies only the ones it
+// keeps.
+func (r *MemoryUserRepository) SearchUsers(ctx context.Context, search UserSearch) ([]UserSearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query := UserQuery{IncludeDeleted: search.IncludeDeleted}
+	ranker := newSearchRanker(search)
+	for _, user := range r.users {
+		if matchesUserQuery(user, query) {
+			ranker.add(user)
+		}
+	}
+
+	results := ranker.results()
+	for i := range results {
+		results[i].User = copyUser(results[i].User)
+	}
+	return results, nil
+}
+
+func (r *MemoryUserRepository) ReplaceSubject(ctx context.Context, from string, to string, updatedAt time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	replaced := 0
+	for id, user := range r.users {
+		if !hasSubject(user.Subjects, from) {
+			continue
+		}
+		user.Subjects = replaceSubject(user.Subjects, from, to)
+		user.UpdatedAt = &updatedAt
+		user.Version++
+		r.users[id] = user
+		r.writeEvent(model.UserUpdated, user)
+		replaced++
+	}
+	return replaced, nil
+}
+
+func (r *MemoryUserRepository) AddUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, updatedAt, actor, func(subjects []string) ([]string, bool) {
+		if hasSubject(subjects, subject) {
+			return subjects, false
+		}
+		return append(copySubjects(subjects), subject), true
+	})
+}
+
+func (r *MemoryUserRepository) RemoveUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, updatedAt, actor, func(subjects []string) ([]string, bool) {
+		if !hasSubject(subjects, subject) {
+			return subjects, false
+		}
+		kept := []string{}
+		for _, s := range subjects {
+			if s != subject {
+				kept = append(kept, s)
+			}
+		}
+		return kept, true
+	})
+}
+
+// editSubjects applies edit to the user's subjects under the lock, saving
+// the user only when edit reports a change.
+func (r *MemoryUserRepository) editSubjects(id string, updatedAt time.Time, actor string, edit func([]string) ([]string, bool)) (model.User, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return model.User{}, false, fmt.Errorf("no user found with the given ID: %s", id)
+	}
+	subjects, changed := edit(user.Subjects)
+	if !changed {
+		return copyUser(user), false, nil
+	}
+	before := user
+	user.Subjects = subjects
+	user.UpdatedAt = &updatedAt
+	user.Version++
+	r.users[id] = user
+	r.writeEvent(model.UserUpdated, user)
+	r.writeAudit(newAuditEntry(model.AuditActionUpdate, actor, &before, &user))
+	return copyUser(user), true, nil
+}
+
+func (r *MemoryUserRepository) CountUsersBySubject(ctx context.Context, query UserStatsQuery) ([]SubjectCount, error) {
+	users, _, _, err := r.GetAllUsers(query.userQuery(query.IncludeDeleted))
+	if err != nil {
+		return nil, err
+	}
+	return countUsersBySubject(users), nil
+}
+
+func (r *MemoryUserRepository) CountSignups(ctx context.Context, interval string, query UserStatsQuery) ([]SignupBucket, error) {
+	users, _, _, err := r.GetAllUsers(query.userQuery(true))
+	if err != nil {
+		return nil, err
+	}
+	return countSignups(users, interval), nil
+}
+
+func (r *MemoryUserRepository) CountUsers(ctx context.Context, query UserStatsQuery) (UserTotals, error) {
+	users, _, _, err := r.GetAllUsers(query.userQuery(true))
+	if err != nil {
+		return UserTotals{}, err
+	}
+	return countUserTotals(users), nil
+}
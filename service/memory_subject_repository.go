@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fitness-api/model"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemorySubjectRepository keeps the subject catalog in process memory,
+// alongside MemoryUserRepository.
+type MemorySubjectRepository struct {
+	mu       sync.RWMutex
+	subjects map[string]model.Subject
+}
+
+func NewMemorySubjectRepository() *MemorySubjectRepository {
+	return &MemorySubjectRepository{subjects: make(map[string]model.Subject)}
+}
+
+func (r *MemorySubjectRepository) CreateSubject(subject model.Subject) (model.Subject, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.slugTaken(subject.Slug, "") {
+		return model.Subject{}, fmt.Errorf("subject %s already exists", subject.Slug)
+	}
+	subject.Id = newID()
+	r.subjects[subject.Id] = subject
+	return subject, nil
+}
+
+func (r *MemorySubjectRepository) UpdateSubject(subject model.Subject) (model.Subject, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subjects[subject.Id]; !ok {
+		return model.Subject{}, fmt.Errorf("no subject found with id %s", subject.Id)
+	}
+	if r.slugTaken(subject.Slug, subject.Id) {
+		return model.Subject{}, fmt.Errorf("subject %s already exists", subject.Slug)
+	}
+	r.subjects[subject.Id] = subject
+	return subject, nil
+}
+
+func (r *MemorySubjectRepository) DeleteSubject(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subjects[id]; !ok {
+		return fmt.Errorf("no subject found with id %s", id)
+	}
+	delete(r.subjects, id)
+	return nil
+}
+
+func (r *MemorySubjectRepository) GetSubject(id string) (model.Subject, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subject, ok := r.subjects[id]
+	if !ok {
+		return model.Subject{}, fmt.Errorf("no subject found with id %s", id)
+	}
+	return subject, nil
+}
+
+func (r *MemorySubjectRepository) ListSubjects() ([]model.Subject, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subjects := make([]model.Subject, 0, len(r.subjects))
+	for _, subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Slug < subjects[j].Slug })
+	return subjects, nil
+}
+
+// slugTaken reports whether a subject other than exceptID already uses slug.
+// Callers must hold r.mu.
+func (r *MemorySubjectRepository) slugTaken(slug string, exceptID string) bool {
+	for id, subject := range r.subjects {
+		if id != exceptID && subject.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fitness-api/model"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryWebhookRepository keeps webhooks and deliveries in process memory,
+// alongside MemoryUserRepository.
+type MemoryWebhookRepository struct {
+	mu         sync.RWMutex
+	webhooks   map[string]model.Webhook
+	deliveries map[string]model.WebhookDelivery
+	leases     map[string]time.Time
+}
+
+func NewMemoryWebhookRepository() *MemoryWebhookRepository {
+	return &MemoryWebhookRepository{
+		webhooks:   make(map[string]model.Webhook),
+		deliveries: make(map[string]model.WebhookDelivery),
+		leases:     make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryWebhookRepository) CreateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook.Id = newID()
+	r.webhooks[webhook.Id] = copyWebhook(webhook)
+	return webhook, nil
+}
+
+func (r *MemoryWebhookRepository) UpdateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[webhook.Id]; !ok {
+		return model.Webhook{}, fmt.Errorf("no webhook found with id %s", webhook.Id)
+	}
+	r.webhooks[webhook.Id] = copyWebhook(webhook)
+	return webhook, nil
+}
+
+func (r *MemoryWebhookRepository) DeleteWebhook(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return fmt.Errorf("no webhook found with id %s", id)
+	}
+	delete(r.webhooks, id)
+	for deliveryID, delivery := range r.deliveries {
+		if delivery.WebhookId == id {
+			delete(r.deliveries, deliveryID)
+			delete(r.leases, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWebhookRepository) GetWebhook(id string) (model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return model.Webhook{}, fmt.Errorf("no webhook found with id %s", id)
+	}
+	return copyWebhook(webhook), nil
+}
+
+func (r *MemoryWebhookRepository) ListWebhooks() ([]model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := make([]model.Webhook, 0, len(r.webhooks))
+	for _, webhook := range r.webhooks {
+		webhooks = append(webhooks, copyWebhook(webhook))
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].Id < webhooks[j].Id })
+	return webhooks, nil
+}
+
+func (r *MemoryWebhookRepository) EnqueueDeliveries(deliveries []model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		duplicate := false
+		for _, existing := range r.deliveries {
+			if existing.WebhookId == delivery.WebhookId && existing.EventId == delivery.EventId {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			r.deliveries[delivery.Id] = copyDelivery(delivery)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWebhookRepository) ClaimDueDeliveries(now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []model.WebhookDelivery
+	for id, delivery := range r.deliveries {
+		if lease, ok := r.leases[id]; ok && lease.After(now) {
+			continue
+		}
+		if delivery.Status == model.DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+			due = append(due, copyDelivery(delivery))
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, delivery := range due {
+		r.leases[delivery.Id] = leaseUntil
+	}
+	return due, nil
+}
+
+func (r *MemoryWebhookRepository) ClaimDeadDelivery(id string, now time.Time, leaseUntil time.Time) (model.WebhookDelivery, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok || delivery.Status != model.DeliveryDead {
+		return model.WebhookDelivery{}, false, nil
+	}
+	if lease, ok := r.leases[id]; ok && lease.After(now) {
+		return model.WebhookDelivery{}, false, nil
+	}
+	r.leases[id] = leaseUntil
+	return copyDelivery(delivery), true, nil
+}
+
+func (r *MemoryWebhookRepository) SaveDelivery(delivery model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deliveries[delivery.Id]; !ok {
+		return fmt.Errorf("no delivery found with id %s", delivery.Id)
+	}
+	r.deliveries[delivery.Id] = copyDelivery(delivery)
+	delete(r.leases, delivery.Id)
+	return nil
+}
+
+func (r *MemoryWebhookRepository) GetDelivery(id string) (model.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return model.WebhookDelivery{}, fmt.Errorf("no delivery found with id %s", id)
+	}
+	return copyDelivery(delivery), nil
+}
+
+func (r *MemoryWebhookRepository) ListDeliveries(webhookID string, status string, pageSize int, pageNo int) ([]model.WebhookDelivery, int, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []model.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookId == webhookID && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Id > deliveries[j].Id })
+
+	totalDocuments := len(deliveries)
+	start := min((pageNo-1)*pageSize, totalDocuments)
+	end := min(start+pageSize, totalDocuments)
+	lastPage := (totalDocuments + pageSize - 1) / pageSize
+	return deliveries[start:end], lastPage, totalDocuments, nil
+}
+
+func copyWebhook(webhook model.Webhook) model.Webhook {
+	webhook.EventTypes = slices.Clone(webhook.EventTypes)
+	return webhook
+}
+
+func copyDelivery(delivery model.WebhookDelivery) model.WebhookDelivery {
+	delivery.Attempts = slices.Clone(delivery.Attempts)
+	if delivery.NextAttemptAt != nil {
+		next := *delivery.NextAttemptAt
+		delivery.NextAttemptAt = &next
+	}
+	return delivery
+}
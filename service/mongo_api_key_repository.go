@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoAPIKeyRepository struct {
+	keys *mongo.Collection
+}
+
+func NewMongoAPIKeyRepository(client *mongo.Client) *MongoAPIKeyRepository {
+	return &MongoAPIKeyRepository{keys: client.Database("fitness").Collection("api_keys")}
+}
+
+func (r *MongoAPIKeyRepository) CreateAPIKey(key model.APIKey) (model.APIKey, error) {
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	key.Id = newID()
+	if _, err := r.keys.InsertOne(context.Background(), key); err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to create API key: %v", err)
+	}
+	return key, nil
+}
+
+func (r *MongoAPIKeyRepository) GetAPIKey(id string) (model.APIKey, error) {
+	return r.findOne(bson.M{"_id": id}, fmt.Sprintf("no API key found with id %s", id))
+}
+
+func (r *MongoAPIKeyRepository) GetAPIKeyByHash(keyHash string) (model.APIKey, error) {
+	return r.findOne(bson.M{"key_hash": keyHash}, "no API key found with the given hash")
+}
+
+func (r *MongoAPIKeyRepository) ListAPIKeys() ([]model.APIKey, error) {
+	cursor, err := r.keys.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	keys := []model.APIKey{}
+	if err := cursor.All(context.Background(), &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API keys: %v", err)
+	}
+	return keys, nil
+}
+
+func (r *MongoAPIKeyRepository) RevokeAPIKey(id string, revokedAt time.Time) (model.APIKey, error) {
+	_, err := r.keys.UpdateOne(context.Background(),
+		bson.M{"_id": id, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	return r.GetAPIKey(id)
+}
+
+func (r *MongoAPIKeyRepository) TouchAPIKey(id string, usedAt time.Time) error {
+	result, err := r.keys.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": usedAt}})
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no API key found with id %s", id)
+	}
+	return nil
+}
+
+func (r *MongoAPIKeyRepository) findOne(filter bson.M, notFound string) (model.APIKey, error) {
+	var key model.APIKey
+	err := r.keys.FindOne(context.Background(), filter).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return model.APIKey{}, fmt.Errorf("%s", notFound)
+	}
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to fetch API key: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,952 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoUserRepository struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	audit      *mongo.Collection
+	outbox     *mongo.Collection
+
+	outboxDisabled bool
+}
+
+func NewMongoUserRepository(client *mongo.Client) *MongoUserRepository {
+	return &MongoUserRepository{
+		client:     client,
+		collection: client.Database("fitness").Collection("users"),
+		audit:      client.Database("fitness").Collection("user_audit"),
+		outbox:     client.Database("fitness").Collection("user_outbox"),
+	}
+}
+
+// DisableOutbox stops mutations from writing events, for a dual-write
+// secondary whose changes were already announced by the primary.
+func (r *MongoUserRepository) DisableOutbox() {
+	r.outboxDisabled = true
+}
+
+func (r *MongoUserRepository) CreateUser(user model.User, actor string) (model.User, error) {
+
+	log.Println("Processing user creation in MongoDB")
+
+	var existingUser model.User
+	err := r.collection.FindOne(context.Background(), bson.M{"email": user.Email}).Decode(&existingUser)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("MongoDB error checking user existence: %v\n", err)
+		return model.User{}, fmt.Errorf("failed to check user existence: %v", err)
+	}
+
+	if existingUser.Id != "" {
+		log.Printf("Duplicate email found: %s\n", user.Email)
+
+		return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+	}
+	var id = newID()
+
+	user.Id = id
+	user.Version = 1
+	mongoUser := mongoUserDocument(user)
+
+	log.Printf("Inserting user into MongoDB: %+v\n", mongoUser)
+	log.Printf("Database: %s, Collection:, Inserted User: %+v", r.client.Database("fitness").Name(), mongoUser)
+
+	err = r.inTransaction(func(sc mongo.SessionContext) error {
+		if _, err := r.collection.InsertOne(sc, mongoUser); err != nil {
+			return err
+		}
+		if err := r.writeEvent(sc, model.UserCreated, user); err != nil {
+			return err
+		}
+		return r.writeAudit(sc, newAuditEntry(model.AuditActionCreate, actor, nil, &user))
+	})
+	if err != nil {
+		log.Printf("Failed to create user in MongoDB: %v", err)
+		return model.User{}, fmt.Errorf("database error")
+
+	}
+
+	log.Println(" User successfully created in MongoDB")
+	return user, nil
+}
+
+func (r *MongoUserRepository) UpdateUser(user model.User, id string, expectedVersion int, actor string) (model.User, error) {
+
+	log.Println("Processing user update in MongoDB")
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "deleted_at", Value: nil}}
+	if expectedVersion != 0 {
+		filter = append(filter, bson.E{Key: "version", Value: expectedVersion})
+	}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		{Key: "$set", Value: bson.D{
+			{Key: "name", Value: user.Name},
+			{Key: "email", Value: user.Email},
+			{Key: "search_words", Value: SearchWords(user.Name, user.Email)},
+			{Key: "subjects", Value: user.Subjects},
+			{Key: "updated_at", Value: user.UpdatedAt},
+		}},
+	}
+
+	var updatedUser model.User
+	err := r.inTransaction(func(sc mongo.SessionContext) error {
+		var before model.User
+		if err := r.collection.FindOne(sc, filter).Decode(&before); err != nil {
+			return err
+		}
+		err := r.collection.FindOneAndUpdate(sc, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedUser)
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(sc, model.UserUpdated, updatedUser); err != nil {
+			return err
+		}
+		return r.writeAudit(sc, newAuditEntry(model.AuditActionUpdate, actor, &before, &updatedUser))
+	})
+	if err == mongo.ErrNoDocuments {
+		if expectedVersion != 0 {
+			if _, err := r.GetUserByID(id, false); err == nil {
+				return model.User{}, fmt.Errorf("version mismatch for user %s", id)
+			}
+		}
+		return model.User{}, fmt.Errorf("no user found with the given ID: %s", id)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+	}
+	if err != nil {
+		log.Printf("MongoDB update error: %v\n", err)
+		return model.User{}, fmt.Errorf("failed to update user in MongoDB: %v", err)
+	}
+
+	log.Println("User successfully updated in MongoDB")
+	return updatedUser, nil
+}
+
+func (r *MongoUserRepository) DeleteUser(id string, actor string) error {
+	log.Println("Processing user deletion in MongoDB")
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "deleted_at", Value: nil}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "deleted_at", Value: time.Now()}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
+	err := r.inTransaction(func(sc mongo.SessionContext) error {
+		var before, deletedUser model.User
+		if err := r.collection.FindOne(sc, filter).Decode(&before); err != nil {
+			return err
+		}
+		err := r.collection.FindOneAndUpdate(sc, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&deletedUser)
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(sc, model.UserDeleted, deletedUser); err != nil {
+			return err
+		}
+		return r.writeAudit(sc, newAuditEntry(model.AuditActionDelete, actor, &before, &deletedUser))
+	})
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("no user found with id %s", id)
+	}
+	if err != nil {
+		log.Printf("MongoDB deletion error: %v\n", err)
+		return fmt.Errorf("failed to delete user from MongoDB")
+	}
+
+	log.Println("User successfully deleted from MongoDB")
+	return nil
+}
+
+func (r *MongoUserRepository) RestoreUser(id string, actor string) (model.User, error) {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "deleted_at", Value: bson.D{{Key: "$ne", Value: nil}}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "deleted_at", Value: nil}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
+
+	var user model.User
+	err := r.inTransaction(func(sc mongo.SessionContext) error {
+		var before model.User
+		if err := r.collection.FindOne(sc, filter).Decode(&before); err != nil {
+			return err
+		}
+		err := r.collection.FindOneAndUpdate(sc, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(sc, model.UserRestored, user); err != nil {
+			return err
+		}
+		return r.writeAudit(sc, newAuditEntry(model.AuditActionRestore, actor, &before, &user))
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.User{}, fmt.Errorf("no deleted user found with id %s", id)
+		}
+		log.Printf("MongoDB restore error: %v\n", err)
+		return model.User{}, fmt.Errorf("failed to restore user in MongoDB")
+	}
+
+	log.Println("User successfully restored in MongoDB")
+	return user, nil
+}
+
+func (r *MongoUserRepository) PurgeDeletedUsers(deletedBefore time.Time, actor string) (int, error) {
+	purged := 0
+	err := r.inTransaction(func(sc mongo.SessionContext) error {
+		cursor, err := r.collection.Find(sc, bson.D{{Key: "deleted_at", Value: bson.D{{Key: "$lt", Value: deletedBefore}}}})
+		if err != nil {
+			return err
+		}
+		var users []model.User
+		if err := cursor.All(sc, &users); err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+
+		ids := make(bson.A, len(users))
+		entries := make([]interface{}, len(users))
+		for i := range users {
+			ids[i] = users[i].Id
+			entries[i] = newAuditEntry(model.AuditActionPurge, actor, &users[i], nil)
+		}
+		result, err := r.collection.DeleteMany(sc, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		if _, err := r.audit.InsertMany(sc, entries); err != nil {
+			return fmt.Errorf("failed to record audit entries: %v", err)
+		}
+		purged = int(result.DeletedCount)
+		return nil
+	})
+	if err != nil {
+		log.Printf("MongoDB purge error: %v\n", err)
+		return 0, fmt.Errorf("failed to purge users from MongoDB")
+	}
+	return purged, nil
+}
+
+func (r *MongoUserRepository) GetAllUsers(query UserQuery) ([]model.User, int, int, error) {
+	log.Println("Fetching users from MongoDB")
+
+	pageSize, pageNo := query.PageSize, query.PageNo
+
+	filter := mongoUserFilter(query)
+
+	totalDocuments, err := r.collection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Printf("MongoDB count error: %v\n", err)
+		return nil, 0, 0, fmt.Errorf("failed to count users: %v", err)
+	}
+
+	if pageSize == -1 {
+		pageSize = int(totalDocuments)
+	}
+
+	skip := (pageNo - 1) * pageSize
+
+	opts := options.Find().SetSort(mongoUserSort(query)).SetSkip(int64(skip))
+	if query.PageSize != -1 {
+		opts.SetLimit(int64(pageSize))
+	}
+
+	cursor, err := r.collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("MongoDB find error: %v\n", err)
+		return nil, 0, 0, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	var users []model.User
+	for cursor.Next(context.Background()) {
+		var user model.User
+		if err := cursor.Decode(&user); err != nil {
+			log.Printf("MongoDB decode error: %v\n", err)
+			return nil, 0, 0, fmt.Errorf("failed to decode user data: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Printf("MongoDB cursor iteration error: %v\n", err)
+		return nil, 0, 0, fmt.Errorf("error iterating MongoDB cursor: %v", err)
+	}
+
+	lastPage := (int(totalDocuments) + pageSize - 1) / pageSize
+
+	return users, lastPage, int(totalDocuments), nil
+}
+
+func (r *MongoUserRepository) GetUserByID(id string, includeDeleted bool) (model.User, error) {
+	log.Println("Fetching user from MongoDB")
+
+	filter := bson.D{{Key: "_id", Value: id}}
+	if !includeDeleted {
+		filter = append(filter, bson.E{Key: "deleted_at", Value: nil})
+	}
+
+	var user model.User
+	err := r.collection.FindOne(context.Background(), filter).Decode(&user)
+	if err != nil {
+		log.Printf("MongoDB error: %v", err)
+		return model.User{}, fmt.Errorf("user not found in MongoDB")
+	}
+	return user, nil
+}
+
+func mongoUserDocument(user model.User) bson.M {
+	return bson.M{
+		"_id":        user.Id,
+		"name":       user.Name,
+		"email":      user.Email,
+		"subjects":   user.Subjects,
+		"created_at": user.CreatedAt,
+		"updated_at": user.UpdatedAt,
+		"deleted_at": user.DeletedAt,
+		"version":    max(user.Version, 1),
+		// search_words backs the anchored prefix matches of autocomplete.
+		"search_words": SearchWords(user.Name, user.Email),
+	}
+}
+
+func (r *MongoUserRepository) UsersAfter(ctx context.Context, afterID string, limit int) ([]model.User, error) {
+	filter := bson.M{}
+	if afterID != "" {
+		filter["_id"] = bson.M{"$gt": afterID}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []model.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode user data: %v", err)
+	}
+	return users, nil
+}
+
+func (r *MongoUserRepository) ReplaceUser(ctx context.Context, user model.User) error {
+	version := max(user.Version, 1)
+	filter := bson.M{"_id": user.Id, "version": bson.M{"$lt": version}}
+	_, err := r.collection.ReplaceOne(ctx, filter, mongoUserDocument(user), options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The filter missed a stored copy, so the upsert collided with its
+		// _id. That copy is already this version or newer unless the
+		// collision was on another unique key such as the email.
+		newer, countErr := r.collection.CountDocuments(ctx, bson.M{"_id": user.Id, "version": bson.M{"$gte": version}})
+		if countErr == nil && newer > 0 {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to replace user in MongoDB: %v", err)
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) InsertUsers(ctx context.Context, users []model.User, dryRun bool) ([]InsertResult, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	ids := make(bson.A, 0, len(users))
+	emails := make(bson.A, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+		emails = append(emails, user.Email)
+	}
+
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"$or": bson.A{bson.M{"_id": bson.M{"$in": ids}}, bson.M{"email": bson.M{"$in": emails}}}},
+		options.Find().SetProjection(bson.M{"_id": 1, "email": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+	var stored []model.User
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+
+	existingIDs := map[string]bool{}
+	emailOwners := map[string]string{}
+	for _, user := range stored {
+		existingIDs[user.Id] = true
+		emailOwners[user.Email] = user.Id
+	}
+
+	results := classifyBatch(users, existingIDs, emailOwners)
+	if dryRun {
+		return results, nil
+	}
+
+	var docs []interface{}
+	var docIndex []int
+	for i, result := range results {
+		if result.Status == InsertCreated {
+			docs = append(docs, mongoUserDocument(users[i]))
+			docIndex = append(docIndex, i)
+		}
+	}
+	if len(docs) == 0 {
+		return results, nil
+	}
+
+	_, err = r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		// A concurrent writer may have taken an id or email since the check
+		// above; report those rows instead of failing the whole batch.
+		bulkErr, ok := err.(mongo.BulkWriteException)
+		if !ok || bulkErr.WriteConcernError != nil {
+			return nil, fmt.Errorf("failed to insert users into MongoDB: %v", err)
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return nil, fmt.Errorf("failed to insert users into MongoDB: %v", writeErr)
+			}
+			i := docIndex[writeErr.Index]
+			if strings.Contains(writeErr.Message, "_id_") {
+				results[i].Status = InsertExists
+			} else {
+				results[i].Status = InsertDuplicateEmail
+			}
+		}
+	}
+	return results, nil
+}
+
+func (r *MongoUserRepository) RecordUserAudit(entry model.UserAuditEntry) error {
+	if entry.Id == "" {
+		entry.Id = newID()
+	}
+	if _, err := r.audit.InsertOne(context.Background(), entry); err != nil {
+		return fmt.Errorf("failed to record audit entry in MongoDB: %v", err)
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) GetUserHistory(userID string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error) {
+	ctx := context.Background()
+	filter := bson.M{"user_id": userID}
+
+	totalDocuments, err := r.audit.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count audit entries: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(int64((pageNo - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+	cursor, err := r.audit.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch audit entries: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []model.UserAuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to decode audit entries: %v", err)
+	}
+
+	lastPage := (int(totalDocuments) + pageSize - 1) / pageSize
+	return entries, lastPage, int(totalDocuments), nil
+}
+
+// inTransaction runs fn in a multi-document transaction so a change and its
+// outbox event commit together. Transactions need MongoDB to run as a
+// replica set; a single node one is enough.
+func (r *MongoUserRepository) inTransaction(fn func(sc mongo.SessionContext) error) error {
+	session, err := r.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start MongoDB session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// writeAudit records an audit entry as part of the session's transaction.
+func (r *MongoUserRepository) writeAudit(sc mongo.SessionContext, entry model.UserAuditEntry) error {
+	if _, err := r.audit.InsertOne(sc, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry in MongoDB: %v", err)
+	}
+	return nil
+}
+
+// writeEvent records a user event in the outbox as part of the session's
+// transaction.
+func (r *MongoUserRepository) writeEvent(sc mongo.SessionContext, eventType string, user model.User) error {
+	if r.outboxDisabled {
+		return nil
+	}
+	if _, err := r.outbox.InsertOne(sc, newUserEvent(eventType, user)); err != nil {
+		return fmt.Errorf("failed to write outbox event: %v", err)
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) PendingUserEvents(ctx context.Context, limit int) ([]model.UserEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := r.outbox.Find(ctx, bson.M{"published_at": nil}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []model.UserEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox events: %v", err)
+	}
+	return events, nil
+}
+
+func (r *MongoUserRepository) MarkUserEventPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	_, err := r.outbox.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"published_at": publishedAt}})
+	if err != nil {
+		return fmt.Errorf("failed to mark event %s published: %v", id, err)
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) ImportUsers(ctx context.Context, users []model.User, atomic bool, actor string) ([]InsertResult, error) {
+	return runImport(users, atomic, r.inTransaction, func(sc mongo.SessionContext, batch []model.User) ([]InsertResult, error) {
+		return r.importBatch(sc, batch, actor)
+	})
+}
+
+func (r *MongoUserRepository) importBatch(sc mongo.SessionContext, users []model.User, actor string) ([]InsertResult, error) {
+	emails := make(bson.A, len(users))
+	for i, user := range users {
+		emails[i] = user.Email
+	}
+
+	cursor, err := r.collection.Find(sc, bson.M{"email": bson.M{"$in": emails}}, options.Find().SetProjection(bson.M{"_id": 1, "email": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+	var stored []model.User
+	if err := cursor.All(sc, &stored); err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+	emailOwners := map[string]string{}
+	for _, user := range stored {
+		emailOwners[user.Email] = user.Id
+	}
+
+	results := classifyBatch(users, nil, emailOwners)
+
+	var docs, events, entries []interface{}
+	for i, result := range results {
+		if result.Status == InsertCreated {
+			docs = append(docs, mongoUserDocument(users[i]))
+			entries = append(entries, newAuditEntry(model.AuditActionCreate, actor, nil, &users[i]))
+			if !r.outboxDisabled {
+				events = append(events, newUserEvent(model.UserCreated, users[i]))
+			}
+		}
+	}
+	if len(docs) == 0 {
+		return results, nil
+	}
+
+	// A duplicate key here means a concurrent writer took an email after the
+	// lookup; it aborts the transaction and the import reports the error.
+	if _, err := r.collection.InsertMany(sc, docs); err != nil {
+		return nil, fmt.Errorf("failed to insert users into MongoDB: %v", err)
+	}
+	if len(events) > 0 {
+		if _, err := r.outbox.InsertMany(sc, events); err != nil {
+			return nil, fmt.Errorf("failed to write outbox events: %v", err)
+		}
+	}
+	if _, err := r.audit.InsertMany(sc, entries); err != nil {
+		return nil, fmt.Errorf("failed to record audit entries: %v", err)
+	}
+	return results, nil
+}
+
+func (r *MongoUserRepository) StreamUsers(ctx context.Context, query UserQuery, fn func(model.User) error) error {
+	filter := mongoUserFilter(query)
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(mongoUserSort(query)))
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user model.User
+		if err := cursor.Decode(&user); err != nil {
+			return fmt.Errorf("failed to decode user data: %v", err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+	return nil
+}
+
+// mongoUserSort orders a listing the way the SQL and in-memory backends do:
+// by userOrder's column, then by id in the same direction to break ties.
+func mongoUserSort(query UserQuery) bson.D {
+	orderby, order := userOrder(query)
+	sortOrder := 1
+	if order == "DESC" {
+		sortOrder = -1
+	}
+	if orderby == "id" {
+		return bson.D{{Key: "_id", Value: sortOrder}}
+	}
+	return bson.D{{Key: orderby, Value: sortOrder}, {Key: "_id", Value: sortOrder}}
+}
+
+// GetUsersPage sorts like the other listings (id DESC unless told
+// otherwise), so cursors behave the same everywhere.
+func (r *MongoUserRepository) GetUsersPage(query UserQuery, cursor *UserCursor) ([]model.User, bool, error) {
+	orderby, order := userOrder(query)
+	comparison, direction := keysetDirection(order, cursor)
+
+	filter := mongoUserFilter(query)
+
+	operator, sortOrder := "$gt", 1
+	if comparison == "<" {
+		operator = "$lt"
+	}
+	if direction == "DESC" {
+		sortOrder = -1
+	}
+	sort := bson.D{{Key: "_id", Value: sortOrder}}
+	if orderby != "id" {
+		sort = bson.D{{Key: orderby, Value: sortOrder}, {Key: "_id", Value: sortOrder}}
+	}
+
+	if cursor != nil {
+		if orderby == "id" {
+			filter["_id"] = bson.M{operator: cursor.Id}
+		} else {
+			filter["$or"] = bson.A{
+				bson.M{orderby: bson.M{operator: cursor.Key}},
+				bson.M{orderby: cursor.Key, "_id": bson.M{operator: cursor.Id}},
+			}
+		}
+	}
+
+	opts := options.Find().SetSort(sort).SetLimit(int64(query.PageSize + 1))
+	found, err := r.collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer found.Close(context.Background())
+
+	var users []model.User
+	if err := found.All(context.Background(), &users); err != nil {
+		return nil, false, fmt.Errorf("failed to decode user data: %v", err)
+	}
+
+	users, hasMore := keysetPage(users, query.PageSize, cursor)
+	return users, hasMore, nil
+}
+
+// SearchUsers runs full-text searches against the users_text_idx text index.
+// Text indexes only match whole words, so autocomplete matches the indexed
+// search_words array instead, in stages that follow the scores: users having
+// every term as a word, then as a word prefix, then users with a word
+// starting like some term, which may be a typo. Each stage is an anchored
+// match on the index and fetches at most autocompleteCandidates users; a
+// later stage only runs while the earlier ones found fewer than the limit.
+func (r *MongoUserRepository) SearchUsers(ctx context.Context, search UserSearch) ([]UserSearchResult, error) {
+	deletedFilter := bson.M{}
+	if !search.IncludeDeleted {
+		deletedFilter = bson.M{"deleted_at": nil}
+	}
+
+	if search.Mode == SearchModeAutocomplete {
+		terms := searchTerms(search.Query)
+		if len(terms) == 0 {
+			return nil, nil
+		}
+		exact, prefixes, initials := bson.A{}, bson.A{}, bson.A{}
+		for _, term := range terms {
+			exact = append(exact, term)
+			prefixes = append(prefixes, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(term)})
+			initials = append(initials, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(string([]rune(term)[0]))})
+		}
+		stages := []bson.M{
+			{"search_words": bson.M{"$all": exact}},
+			{"search_words": bson.M{"$all": prefixes}},
+			{"search_words": bson.M{"$in": initials}},
+		}
+
+		var candidates []model.User
+		var results []UserSearchResult
+		seen := bson.A{}
+		for _, stage := range stages {
+			filter := bson.M{"$and": bson.A{deletedFilter, stage, bson.M{"_id": bson.M{"$nin": seen}}}}
+			opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(autocompleteCandidates)
+			found, err := r.collection.Find(ctx, filter, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to search users: %v", err)
+			}
+			var users []model.User
+			if err := found.All(ctx, &users); err != nil {
+				return nil, fmt.Errorf("failed to decode user data: %v", err)
+			}
+			for _, user := range users {
+				seen = append(seen, user.Id)
+			}
+			candidates = append(candidates, users...)
+			if results = rankUsers(candidates, search); len(results) >= search.Limit {
+				break
+			}
+		}
+		return results, nil
+	}
+
+	filter := bson.M{"$and": bson.A{deletedFilter, bson.M{"$text": bson.M{"$search": search.Query}}}}
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(search.Limit))
+	found, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %v", err)
+	}
+	var documents []struct {
+		model.User `bson:",inline"`
+		Score      float64 `bson:"score"`
+	}
+	if err := found.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("failed to decode user data: %v", err)
+	}
+
+	results := make([]UserSearchResult, len(documents))
+	for i, document := range documents {
+		results[i] = UserSearchResult{Score: document.Score, User: document.User}
+	}
+	return results, nil
+}
+
+func (r *MongoUserRepository) ReplaceSubject(ctx context.Context, from string, to string, updatedAt time.Time) (int, error) {
+	replaced := 0
+	err := r.inTransaction(func(sc mongo.SessionContext) error {
+		cursor, err := r.collection.Find(sc, bson.M{"subjects": from})
+		if err != nil {
+			return err
+		}
+		var users []model.User
+		if err := cursor.All(sc, &users); err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			user.Subjects = replaceSubject(user.Subjects, from, to)
+			user.UpdatedAt = &updatedAt
+			user.Version++
+			_, err := r.collection.UpdateOne(sc, bson.M{"_id": user.Id}, bson.M{
+				"$set": bson.M{"subjects": user.Subjects, "updated_at": updatedAt, "version": user.Version},
+			})
+			if err != nil {
+				return err
+			}
+			if err := r.writeEvent(sc, model.UserUpdated, user); err != nil {
+				return err
+			}
+		}
+		replaced = len(users)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to replace subject in MongoDB: %v", err)
+	}
+	return replaced, nil
+}
+
+func (r *MongoUserRepository) AddUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, updatedAt, actor,
+		bson.E{Key: "subjects", Value: bson.M{"$ne": subject}},
+		bson.E{Key: "$addToSet", Value: bson.M{"subjects": subject}})
+}
+
+func (r *MongoUserRepository) RemoveUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, updatedAt, actor,
+		bson.E{Key: "subjects", Value: subject},
+		bson.E{Key: "$pull", Value: bson.M{"subjects": subject}})
+}
+
+// editSubjects applies the subjects operator to the user when condition
+// holds. The condition makes a repeated add or remove a no-op that leaves
+// the version alone.
+func (r *MongoUserRepository) editSubjects(id string, updatedAt time.Time, actor string, condition bson.E, operator bson.E) (model.User, bool, error) {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "deleted_at", Value: nil}, condition}
+	update := bson.D{
+		operator,
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+	}
+
+	var user model.User
+	err := r.inTransaction(func(sc mongo.SessionContext) error {
+		var before model.User
+		if err := r.collection.FindOne(sc, filter).Decode(&before); err != nil {
+			return err
+		}
+		// $addToSet fails on a null array, which users created without
+		// subjects have.
+		_, err := r.collection.UpdateOne(sc, bson.M{"_id": id, "subjects": bson.M{"$type": "null"}},
+			bson.M{"$set": bson.M{"subjects": bson.A{}}})
+		if err != nil {
+			return err
+		}
+		err = r.collection.FindOneAndUpdate(sc, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(sc, model.UserUpdated, user); err != nil {
+			return err
+		}
+		return r.writeAudit(sc, newAuditEntry(model.AuditActionUpdate, actor, &before, &user))
+	})
+	if err == mongo.ErrNoDocuments {
+		user, err := r.GetUserByID(id, false)
+		if err != nil {
+			return model.User{}, false, fmt.Errorf("no user found with the given ID: %s", id)
+		}
+		return user, false, nil
+	}
+	if err != nil {
+		log.Printf("MongoDB subject update error: %v\n", err)
+		return model.User{}, false, fmt.Errorf("failed to update user subjects in MongoDB: %v", err)
+	}
+	return user, true, nil
+}
+
+// mongoActive is true for a user that is not soft-deleted, whether
+// deleted_at is null or missing.
+var mongoActive = bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$deleted_at", nil}}, nil}}
+
+func (r *MongoUserRepository) CountUsersBySubject(ctx context.Context, query UserStatsQuery) ([]SubjectCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: mongoUserFilter(query.userQuery(query.IncludeDeleted))}},
+		// $setUnion drops repeated subjects so each user counts once.
+		{{Key: "$project", Value: bson.M{"subjects": bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$subjects", bson.A{}}}}}}}},
+		{{Key: "$unwind", Value: "$subjects"}},
+		{{Key: "$group", Value: bson.M{"_id": "$subjects", "users": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "users", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	var results []struct {
+		Subject string `bson:"_id"`
+		Users   int    `bson:"users"`
+	}
+	if err := r.aggregate(ctx, pipeline, &results); err != nil {
+		return nil, fmt.Errorf("failed to count users by subject: %v", err)
+	}
+	counts := make([]SubjectCount, len(results))
+	for i, result := range results {
+		counts[i] = SubjectCount{Subject: result.Subject, Users: result.Users}
+	}
+	return counts, nil
+}
+
+// CountSignups relies on $dateTrunc, which needs MongoDB 5.0.
+func (r *MongoUserRepository) CountSignups(ctx context.Context, interval string, query UserStatsQuery) ([]SignupBucket, error) {
+	trunc := bson.M{"date": "$created_at", "unit": interval}
+	if interval == StatsIntervalWeek {
+		trunc["startOfWeek"] = "monday"
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": bson.A{
+			mongoUserFilter(query.userQuery(true)),
+			bson.M{"created_at": bson.M{"$ne": nil}},
+		}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": bson.M{"$dateTrunc": trunc}}},
+			"users": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	var results []struct {
+		Period string `bson:"_id"`
+		Users  int    `bson:"users"`
+	}
+	if err := r.aggregate(ctx, pipeline, &results); err != nil {
+		return nil, fmt.Errorf("failed to count signups: %v", err)
+	}
+	buckets := make([]SignupBucket, len(results))
+	for i, result := range results {
+		buckets[i] = SignupBucket{Period: result.Period, Users: result.Users}
+	}
+	return buckets, nil
+}
+
+func (r *MongoUserRepository) CountUsers(ctx context.Context, query UserStatsQuery) (UserTotals, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: mongoUserFilter(query.userQuery(true))}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      nil,
+			"active":   bson.M{"$sum": bson.M{"$cond": bson.A{mongoActive, 1, 0}}},
+			"deleted":  bson.M{"$sum": bson.M{"$cond": bson.A{mongoActive, 0, 1}}},
+			"subjects": bson.M{"$sum": bson.M{"$cond": bson.A{mongoActive, bson.M{"$size": bson.M{"$ifNull": bson.A{"$subjects", bson.A{}}}}, 0}}},
+		}}},
+	}
+
+	var results []struct {
+		Active   int `bson:"active"`
+		Deleted  int `bson:"deleted"`
+		Subjects int `bson:"subjects"`
+	}
+	if err := r.aggregate(ctx, pipeline, &results); err != nil {
+		return UserTotals{}, fmt.Errorf("failed to count users: %v", err)
+	}
+
+	var totals UserTotals
+	if len(results) > 0 {
+		totals.Active, totals.Deleted = results[0].Active, results[0].Deleted
+		if totals.Active > 0 {
+			totals.AverageSubjects = float64(results[0].Subjects) / float64(totals.Active)
+		}
+	}
+	totals.Total = totals.Active + totals.Deleted
+	return totals, nil
+}
+
+func (r *MongoUserRepository) aggregate(ctx context.Context, pipeline mongo.Pipeline, results interface{}) error {
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoWebhookRepository struct {
+	webhooks   *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func NewMongoWebhookRepository(client *mongo.Client) *MongoWebhookRepository {
+	return &MongoWebhookRepository{
+		webhooks:   client.Database("fitness").Collection("webhooks"),
+		deliveries: client.Database("fitness").Collection("webhook_deliveries"),
+	}
+}
+
+func (r *MongoWebhookRepository) CreateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	webhook.Id = newID()
+	if _, err := r.webhooks.InsertOne(context.Background(), webhook); err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to create webhook: %v", err)
+	}
+	return webhook, nil
+}
+
+func (r *MongoWebhookRepository) UpdateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	result, err := r.webhooks.ReplaceOne(context.Background(), bson.M{"_id": webhook.Id}, webhook)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to update webhook: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return model.Webhook{}, fmt.Errorf("no webhook found with id %s", webhook.Id)
+	}
+	return webhook, nil
+}
+
+func (r *MongoWebhookRepository) DeleteWebhook(id string) error {
+	result, err := r.webhooks.DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no webhook found with id %s", id)
+	}
+	if _, err := r.deliveries.DeleteMany(context.Background(), bson.M{"webhook_id": id}); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %v", err)
+	}
+	return nil
+}
+
+func (r *MongoWebhookRepository) GetWebhook(id string) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := r.webhooks.FindOne(context.Background(), bson.M{"_id": id}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return model.Webhook{}, fmt.Errorf("no webhook found with id %s", id)
+	}
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to fetch webhook: %v", err)
+	}
+	return webhook, nil
+}
+
+func (r *MongoWebhookRepository) ListWebhooks() ([]model.Webhook, error) {
+	cursor, err := r.webhooks.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	webhooks := []model.Webhook{}
+	if err := cursor.All(context.Background(), &webhooks); err != nil {
+		return nil, fmt.Errorf("failed to decode webhooks: %v", err)
+	}
+	return webhooks, nil
+}
+
+func (r *MongoWebhookRepository) EnqueueDeliveries(deliveries []model.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		// Upserting on (webhook_id, event_id) makes a republished event a no-op.
+		_, err := r.deliveries.UpdateOne(context.Background(),
+			bson.M{"webhook_id": delivery.WebhookId, "event_id": delivery.EventId},
+			bson.M{"$setOnInsert": delivery},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue delivery: %v", err)
+		}
+	}
+	return nil
+}
+
+// ClaimDueDeliveries leases due deliveries one findAndModify at a time, each
+// atomic on its own. The lease lives in locked_until, which is not part of
+// the model, so SaveDelivery's replace drops it again.
+func (r *MongoWebhookRepository) ClaimDueDeliveries(now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	filter := bson.M{
+		"status":          model.DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or":             bson.A{bson.M{"locked_until": nil}, bson.M{"locked_until": bson.M{"$lte": now}}},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	claimed := []model.WebhookDelivery{}
+	for len(claimed) < limit {
+		var delivery model.WebhookDelivery
+		err := r.deliveries.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim delivery: %v", err)
+		}
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (r *MongoWebhookRepository) ClaimDeadDelivery(id string, now time.Time, leaseUntil time.Time) (model.WebhookDelivery, bool, error) {
+	filter := bson.M{
+		"_id":    id,
+		"status": model.DeliveryDead,
+		"$or":    bson.A{bson.M{"locked_until": nil}, bson.M{"locked_until": bson.M{"$lte": now}}},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var delivery model.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return model.WebhookDelivery{}, false, nil
+	}
+	if err != nil {
+		return model.WebhookDelivery{}, false, fmt.Errorf("failed to claim delivery: %v", err)
+	}
+	return delivery, true, nil
+}
+
+func (r *MongoWebhookRepository) SaveDelivery(delivery model.WebhookDelivery) error {
+	result, err := r.deliveries.ReplaceOne(context.Background(), bson.M{"_id": delivery.Id}, delivery)
+	if err != nil {
+		return fmt.Errorf("failed to save delivery: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no delivery found with id %s", delivery.Id)
+	}
+	return nil
+}
+
+func (r *MongoWebhookRepository) GetDelivery(id string) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := r.deliveries.FindOne(context.Background(), bson.M{"_id": id}).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return model.WebhookDelivery{}, fmt.Errorf("no delivery found with id %s", id)
+	}
+	if err != nil {
+		return model.WebhookDelivery{}, fmt.Errorf("failed to fetch delivery: %v", err)
+	}
+	return delivery, nil
+}
+
+func (r *MongoWebhookRepository) ListDeliveries(webhookID string, status string, pageSize int, pageNo int) ([]model.WebhookDelivery, int, int, error) {
+	filter := bson.M{"webhook_id": webhookID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	totalDocuments, err := r.deliveries.CountDocuments(context.Background(), filter)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count deliveries: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(int64((pageNo - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+	deliveries, err := r.findDeliveries(filter, opts)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	lastPage := (int(totalDocuments) + pageSize - 1) / pageSize
+	return deliveries, lastPage, int(totalDocuments), nil
+}
+
+func (r *MongoWebhookRepository) findDeliveries(filter bson.M, opts *options.FindOptions) ([]model.WebhookDelivery, error) {
+	cursor, err := r.deliveries.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deliveries: %v", err)
+	}
+	deliveries := []model.WebhookDelivery{}
+	if err := cursor.All(context.Background(), &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode deliveries: %v", err)
+	}
+	return deliveries, nil
+}
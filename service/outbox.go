@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"log"
+	"time"
+)
+
+// OutboxStore is the outbox side of a backend. Every user mutation writes a
+// UserEvent into the outbox in the same transaction as the change itself, so
+// an event exists if and only if the change was committed. The relay reads
+// pending events in the order they were written and marks them once sent.
+type OutboxStore interface {
+	PendingUserEvents(ctx context.Context, limit int) ([]model.UserEvent, error)
+	MarkUserEventPublished(ctx context.Context, id string, publishedAt time.Time) error
+}
+
+// Publisher delivers user events to downstream consumers. Delivery is at
+// least once: an event whose publish succeeded but could not be marked is
+// sent again, so consumers should de-duplicate on the event id.
+type Publisher interface {
+	Publish(ctx context.Context, event model.UserEvent) error
+}
+
+func newUserEvent(eventType string, user model.User) model.UserEvent {
+	return model.UserEvent{
+		Id:         newID(),
+		Type:       eventType,
+		UserId:     user.Id,
+		User:       copyUser(user),
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// OutboxRelay moves events from an OutboxStore to a Publisher.
+type OutboxRelay struct {
+	store     OutboxStore
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewOutboxRelay(store OutboxStore, publisher Publisher, interval time.Duration, batchSize int) *OutboxRelay {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &OutboxRelay{store: store, publisher: publisher, interval: interval, batchSize: batchSize}
+}
+
+// Run relays pending events every interval until ctx is cancelled. A full
+// batch is followed immediately by the next one so a backlog drains quickly.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			relayed, err := r.RelayOnce(ctx)
+			if err != nil {
+				log.Printf("Outbox relay: %v", err)
+				break
+			}
+			if relayed < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of pending events and returns how many were
+// sent. It stops at the first failure so events keep their order; the failed
+// event is retried on the next call.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	events, err := r.store.PendingUserEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, event := range events {
+		if err := r.publisher.Publish(ctx, event); err != nil {
+			return i, err
+		}
+		if err := r.store.MarkUserEventPublished(ctx, event.Id, time.Now().UTC()); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
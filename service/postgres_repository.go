@@ -0,0 +1,1011 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fitness-api/model"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const postgresUserColumns = `id, name, email, subjects, created_at, updated_at, deleted_at, version`
+
+type PostgresUserRepository struct {
+	db             *sql.DB
+	outboxDisabled bool
+}
+
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+// DisableOutbox stops mutations from writing events, for a dual-write
+// secondary whose changes were already announced by the primary.
+func (r *PostgresUserRepository) DisableOutbox() {
+	r.outboxDisabled = true
+}
+
+func scanPostgresUser(row rowScanner) (model.User, error) {
+	var user model.User
+	err := row.Scan(&user.Id, &user.Name, &user.Email, pq.Array(&user.Subjects), &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Version)
+	return user, err
+}
+
+func (r *PostgresUserRepository) CreateUser(user model.User, actor string) (model.User, error) {
+	log.Println("Processing user creation in PostgreSQL")
+
+	var existingUser model.User
+	err := r.db.QueryRow("SELECT id FROM users WHERE email = $1 LIMIT 1", user.Email).Scan(&existingUser.Id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+		} else {
+			return model.User{}, fmt.Errorf("failed to check user existence: %v", err)
+		}
+	} else {
+		return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+	}
+	sqlStatement := `
+		INSERT INTO users (` + postgresUserColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 1)
+		RETURNING ` + postgresUserColumns
+
+	var createdUser model.User
+	err = r.inTx(func(tx *sql.Tx) error {
+		var err error
+		createdUser, err = scanPostgresUser(tx.QueryRow(
+			sqlStatement,
+			newID(),
+			user.Name,
+			user.Email,
+			pq.Array(user.Subjects),
+			user.CreatedAt,
+			user.UpdatedAt,
+			user.DeletedAt,
+		))
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserCreated, createdUser); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionCreate, actor, nil, &createdUser))
+	})
+	if err != nil {
+		return model.User{}, fmt.Errorf("PostgreSQL insertion error: %v", err)
+	}
+
+	return createdUser, nil
+}
+
+func (r *PostgresUserRepository) UpdateUser(user model.User, id string, expectedVersion int, actor string) (model.User, error) {
+	column, key, ok := userKey(id)
+	if !ok {
+		return model.User{}, fmt.Errorf("no user found with the given ID")
+	}
+
+	sqlStatement := fmt.Sprintf(`
+        UPDATE users
+        SET name = $1, email = $2, subjects = $3, updated_at = $4, version = version + 1
+        WHERE %s = $5 AND deleted_at IS NULL AND ($6 = 0 OR version = $6)
+        RETURNING `+postgresUserColumns, column)
+
+	log.Printf("Updating user: ID: %s, Name: %s, Email: %s, Subjects: %v", id, user.Name, user.Email, user.Subjects)
+
+	var updatedUser model.User
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := lockPostgresUser(tx, column, key, "deleted_at IS NULL")
+		if err != nil {
+			return err
+		}
+		updatedUser, err = scanPostgresUser(tx.QueryRow(sqlStatement, user.Name, user.Email, pq.Array(user.Subjects), user.UpdatedAt, key, expectedVersion))
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserUpdated, updatedUser); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionUpdate, actor, &before, &updatedUser))
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if expectedVersion != 0 {
+				if _, err := r.GetUserByID(id, false); err == nil {
+					return model.User{}, fmt.Errorf("version mismatch for user %s", id)
+				}
+			}
+			return model.User{}, fmt.Errorf("no user found with the given ID")
+		}
+		if isPostgresUniqueViolation(err) {
+			return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+		}
+		log.Printf("PostgreSQL update error: %v\n", err)
+		return model.User{}, fmt.Errorf("failed to update user in PostgreSQL: %v", err)
+	}
+
+	return updatedUser, nil
+}
+
+func (r *PostgresUserRepository) DeleteUser(id string, actor string) error {
+	column, key, ok := userKey(id)
+	if !ok {
+		return fmt.Errorf("no user found with id %s", id)
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		UPDATE users SET deleted_at = $2, version = version + 1
+		WHERE %s = $1 AND deleted_at IS NULL
+		RETURNING `+postgresUserColumns, column)
+
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := lockPostgresUser(tx, column, key, "deleted_at IS NULL")
+		if err != nil {
+			return err
+		}
+		deletedUser, err := scanPostgresUser(tx.QueryRow(sqlStatement, key, time.Now()))
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserDeleted, deletedUser); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionDelete, actor, &before, &deletedUser))
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no user found with id %s", id)
+		}
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	log.Println("User successfully deleted from PostgreSQL")
+	return nil
+}
+
+func (r *PostgresUserRepository) RestoreUser(id string, actor string) (model.User, error) {
+	column, key, ok := userKey(id)
+	if !ok {
+		return model.User{}, fmt.Errorf("no deleted user found with id %s", id)
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		UPDATE users SET deleted_at = NULL, version = version + 1
+		WHERE %s = $1 AND deleted_at IS NOT NULL
+		RETURNING `+postgresUserColumns, column)
+
+	var user model.User
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := lockPostgresUser(tx, column, key, "deleted_at IS NOT NULL")
+		if err != nil {
+			return err
+		}
+		user, err = scanPostgresUser(tx.QueryRow(sqlStatement, key))
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserRestored, user); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionRestore, actor, &before, &user))
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.User{}, fmt.Errorf("no deleted user found with id %s", id)
+		}
+		return model.User{}, fmt.Errorf("failed to restore user: %v", err)
+	}
+
+	log.Println("User successfully restored in PostgreSQL")
+	return user, nil
+}
+
+func (r *PostgresUserRepository) PurgeDeletedUsers(deletedBefore time.Time, actor string) (int, error) {
+	purged := 0
+	err := r.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			RETURNING `+postgresUserColumns, deletedBefore)
+		if err != nil {
+			return err
+		}
+		var users []model.User
+		for rows.Next() {
+			user, err := scanPostgresUser(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range users {
+			if err := r.writeAudit(tx, newAuditEntry(model.AuditActionPurge, actor, &users[i], nil)); err != nil {
+				return err
+			}
+		}
+		purged = len(users)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge users: %v", err)
+	}
+	return purged, nil
+}
+
+func (r *PostgresUserRepository) GetAllUsers(query UserQuery) ([]model.User, int, int, error) {
+	pageSize, pageNo := query.PageSize, query.PageNo
+	orderby, order := userOrder(query)
+
+	where := newPostgresFilter()
+	whereClause, err := where.where(query)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	countArgs := where.args
+
+	var sqlStatement string
+	if pageSize == -1 {
+		sqlStatement = fmt.Sprintf(`
+			SELECT %s
+			FROM users
+			WHERE %s
+			ORDER BY %s %s, id %s`, postgresUserColumns, whereClause, orderby, order, order)
+	} else {
+		offset := (pageNo - 1) * pageSize
+		sqlStatement = fmt.Sprintf(`
+			SELECT %s
+			FROM users
+			WHERE %s
+			ORDER BY %s %s, id %s
+			LIMIT %s OFFSET %s`, postgresUserColumns, whereClause, orderby, order, order, where.arg(pageSize), where.arg(offset))
+	}
+
+	rows, err := r.db.Query(sqlStatement, where.args...)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanPostgresUser(rows)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	var totalDocuments int
+	countQuery := `
+		SELECT COUNT(*)
+		FROM users
+		WHERE ` + whereClause
+	err = r.db.QueryRow(countQuery, countArgs...).Scan(&totalDocuments)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count total users: ")
+	}
+
+	lastPage := 1
+	if pageSize != -1 {
+		lastPage = (totalDocuments + pageSize - 1) / pageSize
+	}
+
+	return users, lastPage, totalDocuments, nil
+}
+
+func (r *PostgresUserRepository) GetUserByID(id string, includeDeleted bool) (model.User, error) {
+	column, key, ok := userKey(id)
+	if !ok {
+		return model.User{}, fmt.Errorf("user not found")
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		WHERE %s = $1 AND ($2 OR deleted_at IS NULL)`, postgresUserColumns, column)
+
+	user, err := scanPostgresUser(r.db.QueryRow(sqlStatement, key, includeDeleted))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.User{}, fmt.Errorf("user not found")
+		}
+		log.Printf("PostgreSQL query error: %v\n", err)
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// lockPostgresUser reads the user a write is about to change and locks its
+// row until tx ends, so the audit entry's before is exactly what the write
+// replaced. state selects live or deleted users.
+func lockPostgresUser(tx *sql.Tx, column string, key any, state string) (model.User, error) {
+	return scanPostgresUser(tx.QueryRow(fmt.Sprintf(
+		`SELECT `+postgresUserColumns+` FROM users WHERE %s = $1 AND %s FOR UPDATE`, column, state), key))
+}
+
+// userKey maps an id path parameter to the column that identifies it. Integer
+// IDs issued before users.id became a UUID are resolved through legacy_id.
+func userKey(id string) (string, any, bool) {
+	if _, err := uuid.Parse(id); err == nil {
+		return "id", id, true
+	}
+	if legacyID, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return "legacy_id", legacyID, true
+	}
+	return "", nil, false
+}
+
+func (r *PostgresUserRepository) UsersAfter(ctx context.Context, afterID string, limit int) ([]model.User, error) {
+	var rows *sql.Rows
+	var err error
+	if afterID == "" {
+		rows, err = r.db.QueryContext(ctx,
+			`SELECT `+postgresUserColumns+` FROM users ORDER BY id LIMIT $1`, limit)
+	} else {
+		rows, err = r.db.QueryContext(ctx,
+			`SELECT `+postgresUserColumns+` FROM users WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanPostgresUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *PostgresUserRepository) InsertUsers(ctx context.Context, users []model.User, dryRun bool) ([]InsertResult, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	// Ids that are not UUIDs cannot be stored in users.id; mark them invalid
+	// up front so the lookup below does not fail on the uuid[] cast.
+	var ids, emails []string
+	valid := make([]bool, len(users))
+	for i, user := range users {
+		if _, err := uuid.Parse(user.Id); err == nil {
+			valid[i] = true
+			ids = append(ids, user.Id)
+		}
+		emails = append(emails, user.Email)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, email FROM users WHERE id = ANY($1::uuid[]) OR email = ANY($2)`,
+		pq.Array(ids), pq.Array(emails))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+	existingIDs := map[string]bool{}
+	emailOwners := map[string]string{}
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to check user existence: %v", err)
+		}
+		existingIDs[id] = true
+		emailOwners[email] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+
+	results := classifyBatch(users, existingIDs, emailOwners)
+	for i := range results {
+		if !valid[i] {
+			results[i].Status = InsertInvalid
+		}
+	}
+	if dryRun {
+		return results, nil
+	}
+
+	var placeholders []string
+	var args []interface{}
+	for i, result := range results {
+		if result.Status != InsertCreated {
+			continue
+		}
+		user := users[i]
+		n := len(args)
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+		args = append(args, user.Id, user.Name, user.Email, pq.Array(user.Subjects), user.CreatedAt, user.UpdatedAt, user.DeletedAt, max(user.Version, 1))
+	}
+	if len(placeholders) == 0 {
+		return results, nil
+	}
+
+	// ON CONFLICT DO NOTHING keeps the batch going if a concurrent writer
+	// took an id or email after the lookup above.
+	inserted, err := r.db.QueryContext(ctx,
+		`INSERT INTO users (`+postgresUserColumns+`) VALUES `+strings.Join(placeholders, ", ")+`
+		ON CONFLICT DO NOTHING RETURNING id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("PostgreSQL insertion error: %v", err)
+	}
+	defer inserted.Close()
+
+	created := map[string]bool{}
+	for inserted.Next() {
+		var id string
+		if err := inserted.Scan(&id); err != nil {
+			return nil, fmt.Errorf("PostgreSQL insertion error: %v", err)
+		}
+		created[id] = true
+	}
+	if err := inserted.Err(); err != nil {
+		return nil, fmt.Errorf("PostgreSQL insertion error: %v", err)
+	}
+
+	for i, result := range results {
+		if result.Status == InsertCreated && !created[result.Id] {
+			results[i].Status = InsertDuplicateEmail
+		}
+	}
+	return results, nil
+}
+
+func (r *PostgresUserRepository) ReplaceUser(ctx context.Context, user model.User) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO users (`+postgresUserColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, email = EXCLUDED.email, subjects = EXCLUDED.subjects,
+			created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at, deleted_at = EXCLUDED.deleted_at,
+			version = EXCLUDED.version
+		WHERE users.version < EXCLUDED.version`,
+		user.Id, user.Name, user.Email, pq.Array(user.Subjects), user.CreatedAt, user.UpdatedAt, user.DeletedAt, max(user.Version, 1))
+	if err != nil {
+		return fmt.Errorf("failed to replace user in PostgreSQL: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) RecordUserAudit(entry model.UserAuditEntry) error {
+	if entry.Id == "" {
+		entry.Id = newID()
+	}
+	return r.inTx(func(tx *sql.Tx) error { return r.writeAudit(tx, entry) })
+}
+
+// writeAudit records an audit entry as part of tx.
+func (r *PostgresUserRepository) writeAudit(tx *sql.Tx, entry model.UserAuditEntry) error {
+	before, err := encodeSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := encodeSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_audit (`+auditColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.Id, entry.UserId, entry.Action, entry.Actor, before, after, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry in PostgreSQL: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) GetUserHistory(userID string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error) {
+	var totalDocuments int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM user_audit WHERE user_id = $1`, userID).Scan(&totalDocuments); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count audit entries: %v", err)
+	}
+
+	rows, err := r.db.Query(
+		`SELECT `+auditColumns+` FROM user_audit WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3`,
+		userID, pageSize, (pageNo-1)*pageSize,
+	)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch audit entries: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []model.UserAuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, fmt.Errorf("error iterating audit entries: %v", err)
+	}
+
+	lastPage := (totalDocuments + pageSize - 1) / pageSize
+	return entries, lastPage, totalDocuments, nil
+}
+
+// inTx runs fn in a transaction, committing when it succeeds. fn's error is
+// returned unchanged so callers can still test for sql.ErrNoRows.
+func (r *PostgresUserRepository) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isPostgresUniqueViolation reports whether err is a unique constraint
+// violation (SQLSTATE 23505).
+func isPostgresUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// writeEvent records a user event in the outbox as part of tx.
+func (r *PostgresUserRepository) writeEvent(tx *sql.Tx, eventType string, user model.User) error {
+	if r.outboxDisabled {
+		return nil
+	}
+	event := newUserEvent(eventType, user)
+	payload, err := json.Marshal(event.User)
+	if err != nil {
+		return fmt.Errorf("failed to encode event payload: %v", err)
+	}
+	_, err = tx.Exec(
+		`INSERT INTO user_outbox (id, event_type, user_id, payload, occurred_at) VALUES ($1, $2, $3, $4, $5)`,
+		event.Id, event.Type, event.UserId, string(payload), event.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) PendingUserEvents(ctx context.Context, limit int) ([]model.UserEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, event_type, user_id, payload, occurred_at FROM user_outbox
+		WHERE published_at IS NULL ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	defer rows.Close()
+
+	var events []model.UserEvent
+	for rows.Next() {
+		event, err := scanUserEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *PostgresUserRepository) MarkUserEventPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE user_outbox SET published_at = $2 WHERE id = $1`, id, publishedAt); err != nil {
+		return fmt.Errorf("failed to mark event %s published: %v", id, err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) ImportUsers(ctx context.Context, users []model.User, atomic bool, actor string) ([]InsertResult, error) {
+	return runImport(users, atomic, r.inTx, func(tx *sql.Tx, batch []model.User) ([]InsertResult, error) {
+		return r.importBatch(ctx, tx, batch, actor)
+	})
+}
+
+func (r *PostgresUserRepository) importBatch(ctx context.Context, tx *sql.Tx, users []model.User, actor string) ([]InsertResult, error) {
+	emails := make([]string, len(users))
+	for i, user := range users {
+		emails[i] = user.Email
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, email FROM users WHERE email = ANY($1)`, pq.Array(emails))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+	emailOwners := map[string]string{}
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to check user existence: %v", err)
+		}
+		emailOwners[email] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+
+	results := classifyBatch(users, nil, emailOwners)
+
+	var placeholders []string
+	var args []interface{}
+	for i, result := range results {
+		if result.Status != InsertCreated {
+			continue
+		}
+		user := users[i]
+		n := len(args)
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, 1)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+		args = append(args, user.Id, user.Name, user.Email, pq.Array(user.Subjects), user.CreatedAt, user.UpdatedAt, user.DeletedAt)
+	}
+	if len(placeholders) == 0 {
+		return results, nil
+	}
+
+	inserted, err := tx.QueryContext(ctx,
+		`INSERT INTO users (`+postgresUserColumns+`) VALUES `+strings.Join(placeholders, ", ")+`
+		ON CONFLICT DO NOTHING RETURNING `+postgresUserColumns, args...)
+	if err != nil {
+		return nil, fmt.Errorf("PostgreSQL insertion error: %v", err)
+	}
+	var createdUsers []model.User
+	for inserted.Next() {
+		user, err := scanPostgresUser(inserted)
+		if err != nil {
+			inserted.Close()
+			return nil, fmt.Errorf("PostgreSQL insertion error: %v", err)
+		}
+		createdUsers = append(createdUsers, user)
+	}
+	inserted.Close()
+	if err := inserted.Err(); err != nil {
+		return nil, fmt.Errorf("PostgreSQL insertion error: %v", err)
+	}
+
+	created := map[string]bool{}
+	for i, user := range createdUsers {
+		created[user.Id] = true
+		if err := r.writeEvent(tx, model.UserCreated, user); err != nil {
+			return nil, err
+		}
+		if err := r.writeAudit(tx, newAuditEntry(model.AuditActionCreate, actor, nil, &createdUsers[i])); err != nil {
+			return nil, err
+		}
+	}
+	// A concurrent writer took the email after the lookup above.
+	for i, result := range results {
+		if result.Status == InsertCreated && !created[result.Id] {
+			results[i].Status = InsertDuplicateEmail
+		}
+	}
+	return results, nil
+}
+
+func (r *PostgresUserRepository) StreamUsers(ctx context.Context, query UserQuery, fn func(model.User) error) error {
+	orderby, order := userOrder(query)
+	where := newPostgresFilter()
+	whereClause, err := where.where(query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		WHERE %s
+		ORDER BY %s %s, id %s`, postgresUserColumns, whereClause, orderby, order, order), where.args...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanPostgresUser(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan user: %v", err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) GetUsersPage(query UserQuery, cursor *UserCursor) ([]model.User, bool, error) {
+	orderby, order := userOrder(query)
+	comparison, direction := keysetDirection(order, cursor)
+
+	where := newPostgresFilter()
+	whereClause, err := where.where(query)
+	if err != nil {
+		return nil, false, err
+	}
+	if cursor != nil {
+		whereClause += fmt.Sprintf(" AND (%s, id) %s (%s, %s)", orderby, comparison, where.arg(cursor.Key), where.arg(cursor.Id))
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT %s`, postgresUserColumns, whereClause, orderby, direction, direction, where.arg(query.PageSize+1))
+
+	rows, err := r.db.Query(sqlStatement, where.args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanPostgresUser(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	users, hasMore := keysetPage(users, query.PageSize, cursor)
+	return users, hasMore, nil
+}
+
+// SearchUsers uses the search_vector column for full-text search. Autocomplete
+// matches each word by prefix through the same index, and falls back to
+// trigram similarity on search_text so a typo still finds the user.
+func (r *PostgresUserRepository) SearchUsers(ctx context.Context, search UserSearch) ([]UserSearchResult, error) {
+	deletedFilter := " AND deleted_at IS NULL"
+	if search.IncludeDeleted {
+		deletedFilter = ""
+	}
+
+	var sqlStatement string
+	var args []interface{}
+	if search.Mode == SearchModeAutocomplete {
+		terms := searchTerms(search.Query)
+		if len(terms) == 0 {
+			return nil, nil
+		}
+		// The terms are letters and digits only, so they cannot carry
+		// tsquery operators.
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		sqlStatement = fmt.Sprintf(`
+			SELECT %s, GREATEST(ts_rank(search_vector, query), word_similarity($2, search_text)) AS score
+			FROM users, to_tsquery('simple', $1) AS query
+			WHERE (search_vector @@ query OR $2 <%% search_text)%s
+			ORDER BY score DESC, id DESC
+			LIMIT $3`, postgresUserColumns, deletedFilter)
+		args = []interface{}{strings.Join(prefixes, " & "), strings.Join(terms, " "), search.Limit}
+	} else {
+		sqlStatement = fmt.Sprintf(`
+			SELECT %s, ts_rank(search_vector, query) AS score
+			FROM users, websearch_to_tsquery('simple', regexp_replace($1, '[@._+]+', ' ', 'g')) AS query
+			WHERE search_vector @@ query%s
+			ORDER BY score DESC, id DESC
+			LIMIT $2`, postgresUserColumns, deletedFilter)
+		args = []interface{}{search.Query, search.Limit}
+	}
+
+	rows, err := r.db.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %v", err)
+	}
+	defer rows.Close()
+
+	var results []UserSearchResult
+	for rows.Next() {
+		var result UserSearchResult
+		user := &result.User
+		if err := rows.Scan(&user.Id, &user.Name, &user.Email, pq.Array(&user.Subjects),
+			&user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Version, &result.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search users: %v", err)
+	}
+	return results, nil
+}
+
+func (r *PostgresUserRepository) ReplaceSubject(ctx context.Context, from string, to string, updatedAt time.Time) (int, error) {
+	replaced := 0
+	err := r.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE users
+			SET subjects = CASE WHEN $2 = ANY(subjects) THEN array_remove(subjects, $1) ELSE array_replace(subjects, $1, $2) END,
+				updated_at = $3, version = version + 1
+			WHERE $1 = ANY(subjects)
+			RETURNING `+postgresUserColumns, from, to, updatedAt)
+		if err != nil {
+			return err
+		}
+		var users []model.User
+		for rows.Next() {
+			user, err := scanPostgresUser(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if err := r.writeEvent(tx, model.UserUpdated, user); err != nil {
+				return err
+			}
+		}
+		replaced = len(users)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to replace subject in PostgreSQL: %v", err)
+	}
+	return replaced, nil
+}
+
+func (r *PostgresUserRepository) AddUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, subject, updatedAt, actor,
+		`array_append(COALESCE(subjects, '{}'::text[]), $2::text)`,
+		`NOT COALESCE($2::text = ANY(subjects), FALSE)`)
+}
+
+func (r *PostgresUserRepository) RemoveUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, subject, updatedAt, actor,
+		`array_remove(subjects, $2::text)`,
+		`COALESCE($2::text = ANY(subjects), FALSE)`)
+}
+
+// editSubjects sets subjects to the expression set when condition holds,
+// both written in terms of $2, the subject. The condition makes a repeated
+// add or remove a no-op that leaves the version alone.
+func (r *PostgresUserRepository) editSubjects(id string, subject string, updatedAt time.Time, actor string, set string, condition string) (model.User, bool, error) {
+	column, key, ok := userKey(id)
+	if !ok {
+		return model.User{}, false, fmt.Errorf("no user found with the given ID: %s", id)
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		UPDATE users
+		SET subjects = %s, updated_at = $3, version = version + 1
+		WHERE %s = $1 AND deleted_at IS NULL AND %s
+		RETURNING `+postgresUserColumns, set, column, condition)
+
+	var user model.User
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := lockPostgresUser(tx, column, key, "deleted_at IS NULL")
+		if err != nil {
+			return err
+		}
+		user, err = scanPostgresUser(tx.QueryRow(sqlStatement, key, subject, updatedAt))
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserUpdated, user); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionUpdate, actor, &before, &user))
+	})
+	if err == sql.ErrNoRows {
+		user, err := r.GetUserByID(id, false)
+		if err != nil {
+			return model.User{}, false, fmt.Errorf("no user found with the given ID: %s", id)
+		}
+		return user, false, nil
+	}
+	if err != nil {
+		log.Printf("PostgreSQL subject update error: %v\n", err)
+		return model.User{}, false, fmt.Errorf("failed to update user subjects in PostgreSQL: %v", err)
+	}
+	return user, true, nil
+}
+
+func (r *PostgresUserRepository) CountUsersBySubject(ctx context.Context, query UserStatsQuery) ([]SubjectCount, error) {
+	where := newPostgresFilter()
+	whereClause, err := where.where(query.userQuery(query.IncludeDeleted))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT subject, COUNT(DISTINCT users.id)
+		FROM users, unnest(subjects) AS subject
+		WHERE `+whereClause+`
+		GROUP BY subject
+		ORDER BY 2 DESC, subject`, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users by subject: %v", err)
+	}
+	defer rows.Close()
+
+	counts := []SubjectCount{}
+	for rows.Next() {
+		var count SubjectCount
+		if err := rows.Scan(&count.Subject, &count.Users); err != nil {
+			return nil, fmt.Errorf("failed to scan subject count: %v", err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+func (r *PostgresUserRepository) CountSignups(ctx context.Context, interval string, query UserStatsQuery) ([]SignupBucket, error) {
+	where := newPostgresFilter()
+	whereClause, err := where.where(query.userQuery(true))
+	if err != nil {
+		return nil, err
+	}
+	period := `to_char(date_trunc(` + where.arg(interval) + `, created_at), 'YYYY-MM-DD')`
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+period+`, COUNT(*)
+		FROM users
+		WHERE `+whereClause+` AND created_at IS NOT NULL
+		GROUP BY 1
+		ORDER BY 1`, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count signups: %v", err)
+	}
+	defer rows.Close()
+
+	buckets := []SignupBucket{}
+	for rows.Next() {
+		var bucket SignupBucket
+		if err := rows.Scan(&bucket.Period, &bucket.Users); err != nil {
+			return nil, fmt.Errorf("failed to scan signup count: %v", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+func (r *PostgresUserRepository) CountUsers(ctx context.Context, query UserStatsQuery) (UserTotals, error) {
+	where := newPostgresFilter()
+	whereClause, err := where.where(query.userQuery(true))
+	if err != nil {
+		return UserTotals{}, err
+	}
+
+	var totals UserTotals
+	err = r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE deleted_at IS NULL),
+			COUNT(*) FILTER (WHERE deleted_at IS NOT NULL),
+			COALESCE(AVG(COALESCE(cardinality(subjects), 0)) FILTER (WHERE deleted_at IS NULL), 0)
+		FROM users
+		WHERE `+whereClause, where.args...).Scan(&totals.Active, &totals.Deleted, &totals.AverageSubjects)
+	if err != nil {
+		return UserTotals{}, fmt.Errorf("failed to count users: %v", err)
+	}
+	totals.Total = totals.Active + totals.Deleted
+	return totals, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fitness-api/model"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FilePublisher appends each event as one JSON line to a file.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %v", err)
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, event model.UserEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %v", event.Id, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event %s: %v", event.Id, err)
+	}
+	return p.file.Sync()
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// ChannelPublisher hands events to an in-process consumer. Publish blocks
+// until the event is received or ctx is cancelled.
+type ChannelPublisher struct {
+	events chan model.UserEvent
+}
+
+func NewChannelPublisher(buffer int) *ChannelPublisher {
+	return &ChannelPublisher{events: make(chan model.UserEvent, buffer)}
+}
+
+func (p *ChannelPublisher) Publish(ctx context.Context, event model.UserEvent) error {
+	select {
+	case p.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *ChannelPublisher) Events() <-chan model.UserEvent {
+	return p.events
+}
+
+// MultiPublisher publishes every event to each of its publishers in turn and
+// fails on the first error. The relay then retries the event everywhere, so
+// publishers that already received it must tolerate the repeat.
+type MultiPublisher []Publisher
+
+func (p MultiPublisher) Publish(ctx context.Context, event model.UserEvent) error {
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
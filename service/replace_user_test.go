@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fitness-api/model"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// replacerBackends opens the dual-write secondaries configured for the test
+// run. TEST_POSTGRES_URL and TEST_MONGO_URI must point at migrated databases;
+// backends without one are skipped.
+func replacerBackends(t *testing.T) map[string]SecondaryUserRepository {
+	t.Helper()
+	backends := map[string]SecondaryUserRepository{}
+
+	if url := os.Getenv("TEST_POSTGRES_URL"); url != "" {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatalf("open PostgreSQL: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		backends["postgres"] = NewPostgresUserRepository(db)
+	}
+	if uri := os.Getenv("TEST_MONGO_URI"); uri != "" {
+		client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+		if err != nil {
+			t.Fatalf("connect to MongoDB: %v", err)
+		}
+		t.Cleanup(func() { client.Disconnect(context.Background()) })
+		backends["mongo"] = NewMongoUserRepository(client)
+	}
+
+	if len(backends) == 0 {
+		t.Skip("set TEST_POSTGRES_URL or TEST_MONGO_URI to run against a database")
+	}
+	return backends
+}
+
+func TestReplaceUserIgnoresOlderVersions(t *testing.T) {
+	for name, repo := range replacerBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			id := uuid.Must(uuid.NewV7()).String()
+			created := time.Now().UTC().Truncate(time.Millisecond)
+			version := func(v int, name string) model.User {
+				updated := created.Add(time.Duration(v) * time.Second)
+				return model.User{
+					Id:        id,
+					Name:      name,
+					Email:     id + "@replace.test",
+					Subjects:  []string{},
+					CreatedAt: &created,
+					UpdatedAt: &updated,
+					Version:   v,
+				}
+			}
+
+			replay := []model.User{version(1, "first"), version(3, "third"), version(2, "second"), version(3, "third again")}
+			for _, user := range replay {
+				if err := repo.ReplaceUser(ctx, user); err != nil {
+					t.Fatalf("ReplaceUser version %d: %v", user.Version, err)
+				}
+			}
+
+			stored, err := repo.GetUserByID(id, false)
+			if err != nil {
+				t.Fatalf("GetUserByID: %v", err)
+			}
+			if stored.Version != 3 || stored.Name != "third" {
+				t.Errorf("stored version %d %q, want version 3 %q", stored.Version, stored.Name, "third")
+			}
+		})
+	}
+}
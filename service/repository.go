@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fitness-api/filter"
+	"fitness-api/model"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserRepository is the storage contract the user manager works against.
+// Each backend (MongoDB, PostgreSQL, ...) provides its own implementation
+// and main.go picks one at startup.
+//
+// DeleteUser only marks a user as deleted by setting deleted_at. Soft-deleted
+// users are hidden from reads and updates unless asked for explicitly, can be
+// brought back with RestoreUser, and are removed for good by
+// PurgeDeletedUsers.
+//
+// Every write increments the user's Version. UpdateUser only applies when
+// the stored version equals expectedVersion; 0 skips the check.
+//
+// Every write also records an audit entry naming actor, with the user as the
+// write found it and as it left it, and a UserEvent in the outbox for each
+// create, update, delete and restore. Both are written in the same
+// transaction as the user. PurgeDeletedUsers audits every user it removes
+// but emits no event, since the users were already announced as deleted.
+type UserRepository interface {
+	UserAuditRepository
+	OutboxStore
+	UserImporter
+	UserStreamer
+	UserPager
+	UserSearcher
+	UserSubjectRewriter
+	UserSubjectEditor
+	UserStatistics
+	CreateUser(user model.User, actor string) (model.User, error)
+	UpdateUser(user model.User, id string, expectedVersion int, actor string) (model.User, error)
+	DeleteUser(id string, actor string) error
+	RestoreUser(id string, actor string) (model.User, error)
+	PurgeDeletedUsers(deletedBefore time.Time, actor string) (int, error)
+	GetAllUsers(query UserQuery) ([]model.User, int, int, error)
+	GetUserByID(id string, includeDeleted bool) (model.User, error)
+}
+
+// UserAuditRepository stores the change history of users. The writes of a
+// UserRepository record their own entries; RecordUserAudit stores an entry
+// as given, for copying history between backends. GetUserHistory returns the
+// entries for one user newest first, along with the last page number and the
+// total number of entries.
+type UserAuditRepository interface {
+	RecordUserAudit(entry model.UserAuditEntry) error
+	GetUserHistory(userID string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error)
+}
+
+// UserQuery describes a page of the users listing. PageSize -1 returns every
+// matching user. Filter narrows the listing further; a nil Filter matches
+// every user.
+type UserQuery struct {
+	PageSize       int
+	PageNo         int
+	Subject        string
+	Order          string
+	OrderBy        string
+	IncludeDeleted bool
+	Filter         filter.Expr
+}
+
+// UserCursor marks a position in a listing sorted by UserQuery's OrderBy
+// and Order, with the id breaking ties. Key is the sort column's value at
+// that position. A page starts right after the cursor, or right before it
+// when Backward is set.
+type UserCursor struct {
+	Key      string
+	Id       string
+	Backward bool
+}
+
+// UserPager lists users by keyset rather than OFFSET, so deep pages cost the
+// same as the first and rows inserted during a scan are neither repeated nor
+// skipped. A nil cursor starts at the beginning. hasMore reports whether
+// further users lie beyond the page in the direction of travel. Users are
+// always returned in the query's order, even when paging backwards.
+type UserPager interface {
+	GetUsersPage(query UserQuery, cursor *UserCursor) (users []model.User, hasMore bool, err error)
+}
+
+// UserSortKey is the value of the column a listing ordered by orderby sorts
+// on, as carried in a UserCursor.
+func UserSortKey(user model.User, orderby string) string {
+	switch orderby {
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	default:
+		return user.Id
+	}
+}
+
+// keysetPage trims a page fetched with one extra row and puts it back in the
+// query's order when it was fetched backwards.
+func keysetPage(users []model.User, pageSize int, cursor *UserCursor) ([]model.User, bool) {
+	hasMore := len(users) > pageSize
+	if hasMore {
+		users = users[:pageSize]
+	}
+	if cursor != nil && cursor.Backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	return users, hasMore
+}
+
+// keysetDirection returns the comparison and sort direction a keyset page is
+// fetched with: the query's own order going forward, the reverse going back.
+func keysetDirection(order string, cursor *UserCursor) (string, string) {
+	backward := cursor != nil && cursor.Backward
+	if (order == "DESC") != backward {
+		return "<", "DESC"
+	}
+	return ">", "ASC"
+}
+
+// UserStreamer hands every user matching query to fn, one at a time and in
+// the query's order, without holding the whole result in memory. Paging
+// fields are ignored. Streaming stops at the first error fn returns.
+type UserStreamer interface {
+	StreamUsers(ctx context.Context, query UserQuery, fn func(model.User) error) error
+}
+
+// UserSubjectRewriter renames a subject on every user that has it, deleted
+// users included; a user that already has to just loses from. Each user
+// changed gets a new version, updatedAt and a UserUpdated event.
+// ReplaceSubject returns how many users changed.
+type UserSubjectRewriter interface {
+	ReplaceSubject(ctx context.Context, from string, to string, updatedAt time.Time) (int, error)
+}
+
+// UserSubjectEditor adds or removes one subject of a user in place, so
+// concurrent enrollments of the same user never overwrite each other. When
+// the user already has, or already lacks, the subject nothing is written:
+// changed is false and the user is returned as stored. Otherwise the user
+// gets a new version, updatedAt, an audit entry naming actor and a
+// UserUpdated event.
+type UserSubjectEditor interface {
+	AddUserSubject(id string, subject string, updatedAt time.Time, actor string) (user model.User, changed bool, err error)
+	RemoveUserSubject(id string, subject string, updatedAt time.Time, actor string) (user model.User, changed bool, err error)
+}
+
+// replaceSubject is the rewrite ReplaceSubject applies to one user's
+// subjects, keeping their order.
+func replaceSubject(subjects []string, from string, to string) []string {
+	replaced := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		if subject == from {
+			if hasSubject(subjects, to) || hasSubject(replaced, to) {
+				continue
+			}
+			subject = to
+		}
+		replaced = append(replaced, subject)
+	}
+	return replaced
+}
+
+// userOrder returns the column and direction every backend sorts a listing
+// by, defaulting to id DESC. Ties are broken by id in the same direction.
+func userOrder(query UserQuery) (string, string) {
+	orderby, order := query.OrderBy, query.Order
+	validColumns := map[string]bool{"id": true, "name": true, "email": true}
+	if !validColumns[orderby] {
+		orderby = "id"
+	}
+	if order != "ASC" && order != "DESC" {
+		order = "DESC"
+	}
+	return orderby, order
+}
+
+// newID returns the identifier for a new user, audit entry, outbox event,
+// webhook, delivery, subject or API key. Every backend uses time-ordered
+// UUIDv7 strings, so IDs sort by creation and stay compatible when
+// FLAG_VALUE changes.
+func newID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// newAuditEntry describes a change to a user for its audit history. before
+// is nil for a create and after is nil for a purge.
+func newAuditEntry(action string, actor string, before *model.User, after *model.User) model.UserAuditEntry {
+	entry := model.UserAuditEntry{
+		Id:        newID(),
+		Action:    action,
+		Actor:     actor,
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now().UTC(),
+	}
+	if after != nil {
+		entry.UserId = after.Id
+	} else if before != nil {
+		entry.UserId = before.Id
+	}
+	return entry
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// encodeSnapshot turns an audit snapshot into the JSON text the SQL backends
+// store. A nil snapshot stays NULL.
+func encodeSnapshot(user *model.User) (any, error) {
+	if user == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %v", err)
+	}
+	return string(encoded), nil
+}
+
+func decodeSnapshot(encoded []byte) (*model.User, error) {
+	if encoded == nil {
+		return nil, nil
+	}
+	var user model.User
+	if err := json.Unmarshal(encoded, &user); err != nil {
+		return nil, fmt.Errorf("failed to decode audit snapshot: %v", err)
+	}
+	return &user, nil
+}
+
+// scanAuditEntry reads the columns listed in auditColumns.
+func scanAuditEntry(row rowScanner) (model.UserAuditEntry, error) {
+	var entry model.UserAuditEntry
+	var before, after []byte
+	if err := row.Scan(&entry.Id, &entry.UserId, &entry.Action, &entry.Actor, &before, &after, &entry.CreatedAt); err != nil {
+		return model.UserAuditEntry{}, err
+	}
+
+	var err error
+	if entry.Before, err = decodeSnapshot(before); err != nil {
+		return model.UserAuditEntry{}, err
+	}
+	if entry.After, err = decodeSnapshot(after); err != nil {
+		return model.UserAuditEntry{}, err
+	}
+	return entry, nil
+}
+
+const auditColumns = `id, user_id, action, actor, before_snapshot, after_snapshot, created_at`
+
+// scanUserEvent reads an outbox row of id, event_type, user_id, payload and
+// occurred_at.
+func scanUserEvent(row rowScanner) (model.UserEvent, error) {
+	var event model.UserEvent
+	var payload []byte
+	if err := row.Scan(&event.Id, &event.Type, &event.UserId, &payload, &event.OccurredAt); err != nil {
+		return model.UserEvent{}, fmt.Errorf("failed to scan outbox event: %v", err)
+	}
+	if err := json.Unmarshal(payload, &event.User); err != nil {
+		return model.UserEvent{}, fmt.Errorf("failed to decode outbox event %s: %v", event.Id, err)
+	}
+	return event, nil
+}
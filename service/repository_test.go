@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fitness-api/model"
+	"reflect"
+	"testing"
+)
+
+func TestKeysetDirection(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      string
+		cursor     *UserCursor
+		comparison string
+		direction  string
+	}{
+		{name: "first page ascending", order: "ASC", cursor: nil, comparison: ">", direction: "ASC"},
+		{name: "first page descending", order: "DESC", cursor: nil, comparison: "<", direction: "DESC"},
+		{name: "next page ascending", order: "ASC", cursor: &UserCursor{Key: "b", Id: "2"}, comparison: ">", direction: "ASC"},
+		{name: "next page descending", order: "DESC", cursor: &UserCursor{Key: "b", Id: "2"}, comparison: "<", direction: "DESC"},
+		{name: "previous page ascending", order: "ASC", cursor: &UserCursor{Key: "b", Id: "2", Backward: true}, comparison: "<", direction: "DESC"},
+		{name: "previous page descending", order: "DESC", cursor: &UserCursor{Key: "b", Id: "2", Backward: true}, comparison: ">", direction: "ASC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison, direction := keysetDirection(tt.order, tt.cursor)
+			if comparison != tt.comparison || direction != tt.direction {
+				t.Errorf("keysetDirection(%s, %+v) = %s %s, want %s %s", tt.order, tt.cursor, comparison, direction, tt.comparison, tt.direction)
+			}
+		})
+	}
+}
+
+func TestKeysetPage(t *testing.T) {
+	users := func(ids ...string) []model.User {
+		list := make([]model.User, 0, len(ids))
+		for _, id := range ids {
+			list = append(list, model.User{Id: id})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		fetched  []model.User
+		pageSize int
+		cursor   *UserCursor
+		want     []model.User
+		hasMore  bool
+	}{
+		{name: "empty", fetched: users(), pageSize: 2, want: users()},
+		{name: "short page", fetched: users("1"), pageSize: 2, want: users("1")},
+		{name: "exact page", fetched: users("1", "2"), pageSize: 2, want: users("1", "2")},
+		{name: "extra row trimmed", fetched: users("1", "2", "3"), pageSize: 2, want: users("1", "2"), hasMore: true},
+		{name: "forward cursor keeps order", fetched: users("3", "4", "5"), pageSize: 2, cursor: &UserCursor{Id: "2"}, want: users("3", "4"), hasMore: true},
+		{
+			name:     "backward page reversed after trimming",
+			fetched:  users("4", "3", "2"),
+			pageSize: 2,
+			cursor:   &UserCursor{Id: "5", Backward: true},
+			want:     users("3", "4"),
+			hasMore:  true,
+		},
+		{
+			name:     "backward short page reversed",
+			fetched:  users("2", "1"),
+			pageSize: 3,
+			cursor:   &UserCursor{Id: "3", Backward: true},
+			want:     users("1", "2"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hasMore := keysetPage(tt.fetched, tt.pageSize, tt.cursor)
+			if !reflect.DeepEqual(got, tt.want) || hasMore != tt.hasMore {
+				t.Errorf("keysetPage = %v, %v; want %v, %v", got, hasMore, tt.want, tt.hasMore)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fitness-api/model"
+	"fmt"
+	"time"
+)
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+// SQLAPIKeyRepository stores API keys for both PostgreSQL and SQLite, the
+// same way SQLWebhookRepository does for webhooks.
+type SQLAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSQLAPIKeyRepository(db *sql.DB) *SQLAPIKeyRepository {
+	return &SQLAPIKeyRepository{db: db}
+}
+
+func (r *SQLAPIKeyRepository) CreateAPIKey(key model.APIKey) (model.APIKey, error) {
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to encode scopes: %v", err)
+	}
+
+	key.Id = newID()
+	_, err = r.db.Exec(
+		`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		key.Id, key.Name, key.Prefix, key.KeyHash, string(scopes), key.CreatedBy, key.CreatedAt, key.ExpiresAt, key.LastUsedAt, key.RevokedAt,
+	)
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to create API key: %v", err)
+	}
+	return key, nil
+}
+
+func (r *SQLAPIKeyRepository) GetAPIKey(id string) (model.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return model.APIKey{}, fmt.Errorf("no API key found with id %s", id)
+	}
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to fetch API key: %v", err)
+	}
+	return key, nil
+}
+
+func (r *SQLAPIKeyRepository) GetAPIKeyByHash(keyHash string) (model.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash))
+	if err == sql.ErrNoRows {
+		return model.APIKey{}, fmt.Errorf("no API key found with the given hash")
+	}
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to fetch API key: %v", err)
+	}
+	return key, nil
+}
+
+func (r *SQLAPIKeyRepository) ListAPIKeys() ([]model.APIKey, error) {
+	rows, err := r.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *SQLAPIKeyRepository) RevokeAPIKey(id string, revokedAt time.Time) (model.APIKey, error) {
+	if _, err := r.db.Exec(`UPDATE api_keys SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, id, revokedAt); err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	return r.GetAPIKey(id)
+}
+
+func (r *SQLAPIKeyRepository) TouchAPIKey(id string, usedAt time.Time) error {
+	result, err := r.db.Exec(`UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("no API key found with id %s", id)
+	}
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (model.APIKey, error) {
+	var key model.APIKey
+	var scopes []byte
+	err := row.Scan(&key.Id, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	if err := json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to decode scopes: %v", err)
+	}
+	return key, nil
+}
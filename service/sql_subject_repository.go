@@ -0,0 +1,110 @@
+package service
+
+import (
+	"database/sql"
+	"fitness-api/model"
+	"fmt"
+)
+
+const subjectColumns = `id, slug, display_name, description, active, created_at, updated_at`
+
+// SQLSubjectRepository stores the subject catalog for both PostgreSQL and
+// SQLite, the same way SQLWebhookRepository does for webhooks.
+type SQLSubjectRepository struct {
+	db *sql.DB
+}
+
+func NewSQLSubjectRepository(db *sql.DB) *SQLSubjectRepository {
+	return &SQLSubjectRepository{db: db}
+}
+
+func (r *SQLSubjectRepository) CreateSubject(subject model.Subject) (model.Subject, error) {
+	if err := r.checkSlug(subject.Slug, ""); err != nil {
+		return model.Subject{}, err
+	}
+
+	subject.Id = newID()
+	_, err := r.db.Exec(
+		`INSERT INTO subjects (`+subjectColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		subject.Id, subject.Slug, subject.DisplayName, subject.Description, subject.Active, subject.CreatedAt, subject.UpdatedAt,
+	)
+	if err != nil {
+		return model.Subject{}, fmt.Errorf("failed to create subject: %v", err)
+	}
+	return subject, nil
+}
+
+func (r *SQLSubjectRepository) UpdateSubject(subject model.Subject) (model.Subject, error) {
+	if err := r.checkSlug(subject.Slug, subject.Id); err != nil {
+		return model.Subject{}, err
+	}
+
+	result, err := r.db.Exec(
+		`UPDATE subjects SET slug = $2, display_name = $3, description = $4, active = $5, updated_at = $6 WHERE id = $1`,
+		subject.Id, subject.Slug, subject.DisplayName, subject.Description, subject.Active, subject.UpdatedAt,
+	)
+	if err != nil {
+		return model.Subject{}, fmt.Errorf("failed to update subject: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return model.Subject{}, fmt.Errorf("no subject found with id %s", subject.Id)
+	}
+	return subject, nil
+}
+
+func (r *SQLSubjectRepository) DeleteSubject(id string) error {
+	result, err := r.db.Exec(`DELETE FROM subjects WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subject: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("no subject found with id %s", id)
+	}
+	return nil
+}
+
+func (r *SQLSubjectRepository) GetSubject(id string) (model.Subject, error) {
+	subject, err := scanSubject(r.db.QueryRow(`SELECT `+subjectColumns+` FROM subjects WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return model.Subject{}, fmt.Errorf("no subject found with id %s", id)
+	}
+	return subject, err
+}
+
+func (r *SQLSubjectRepository) ListSubjects() ([]model.Subject, error) {
+	rows, err := r.db.Query(`SELECT ` + subjectColumns + ` FROM subjects ORDER BY slug`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subjects: %v", err)
+	}
+	defer rows.Close()
+
+	subjects := []model.Subject{}
+	for rows.Next() {
+		subject, err := scanSubject(rows)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects, rows.Err()
+}
+
+// checkSlug fails when a subject other than exceptID holds slug. The unique
+// index still guards against a concurrent insert.
+func (r *SQLSubjectRepository) checkSlug(slug string, exceptID string) error {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM subjects WHERE slug = $1 AND id <> $2)`, slug, exceptID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check subject slug: %v", err)
+	}
+	if exists {
+		return fmt.Errorf("subject %s already exists", slug)
+	}
+	return nil
+}
+
+func scanSubject(row rowScanner) (model.Subject, error) {
+	var subject model.Subject
+	err := row.Scan(&subject.Id, &subject.Slug, &subject.DisplayName, &subject.Description, &subject.Active, &subject.CreatedAt, &subject.UpdatedAt)
+	return subject, err
+}
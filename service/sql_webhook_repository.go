@@ -0,0 +1,269 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fitness-api/model"
+	"fmt"
+	"time"
+)
+
+const (
+	webhookColumns  = `id, url, secret, event_types, active, created_at, updated_at`
+	deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at`
+)
+
+// SQLWebhookRepository stores webhooks for both PostgreSQL and SQLite. The
+// queries stick to syntax the two share ($n placeholders, ON CONFLICT) and
+// list columns are JSON text, so one implementation serves both.
+type SQLWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewSQLWebhookRepository(db *sql.DB) *SQLWebhookRepository {
+	return &SQLWebhookRepository{db: db}
+}
+
+func (r *SQLWebhookRepository) CreateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	webhook.Id = newID()
+	eventTypes, err := json.Marshal(webhook.EventTypes)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to encode event types: %v", err)
+	}
+
+	_, err = r.db.Exec(
+		`INSERT INTO webhooks (`+webhookColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		webhook.Id, webhook.URL, webhook.Secret, string(eventTypes), webhook.Active, webhook.CreatedAt, webhook.UpdatedAt,
+	)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to create webhook: %v", err)
+	}
+	return webhook, nil
+}
+
+func (r *SQLWebhookRepository) UpdateWebhook(webhook model.Webhook) (model.Webhook, error) {
+	eventTypes, err := json.Marshal(webhook.EventTypes)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to encode event types: %v", err)
+	}
+
+	result, err := r.db.Exec(
+		`UPDATE webhooks SET url = $2, secret = $3, event_types = $4, active = $5, updated_at = $6 WHERE id = $1`,
+		webhook.Id, webhook.URL, webhook.Secret, string(eventTypes), webhook.Active, webhook.UpdatedAt,
+	)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to update webhook: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return model.Webhook{}, fmt.Errorf("no webhook found with id %s", webhook.Id)
+	}
+	return webhook, nil
+}
+
+func (r *SQLWebhookRepository) DeleteWebhook(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %v", err)
+	}
+	result, err := tx.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("no webhook found with id %s", id)
+	}
+	return tx.Commit()
+}
+
+func (r *SQLWebhookRepository) GetWebhook(id string) (model.Webhook, error) {
+	webhook, err := scanWebhook(r.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return model.Webhook{}, fmt.Errorf("no webhook found with id %s", id)
+	}
+	return webhook, err
+}
+
+func (r *SQLWebhookRepository) ListWebhooks() ([]model.Webhook, error) {
+	rows, err := r.db.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *SQLWebhookRepository) EnqueueDeliveries(deliveries []model.WebhookDelivery) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue deliveries: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, delivery := range deliveries {
+		attempts, err := encodeAttempts(delivery.Attempts)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			delivery.Id, delivery.WebhookId, delivery.EventId, delivery.EventType, delivery.Payload,
+			delivery.Status, attempts, delivery.NextAttemptAt, delivery.CreatedAt, delivery.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue delivery: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimDueDeliveries leases the due deliveries in one UPDATE. The lease check
+// is repeated outside the subquery so that, on PostgreSQL, an UPDATE that
+// waited on a concurrent claim re-checks the row and skips it.
+func (r *SQLWebhookRepository) ClaimDueDeliveries(now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	return r.queryDeliveries(
+		`UPDATE webhook_deliveries SET locked_until = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $2 AND next_attempt_at <= $3 AND (locked_until IS NULL OR locked_until <= $3)
+			ORDER BY next_attempt_at LIMIT $4
+		) AND (locked_until IS NULL OR locked_until <= $3)
+		RETURNING `+deliveryColumns,
+		leaseUntil.UTC(), model.DeliveryPending, now.UTC(), limit,
+	)
+}
+
+func (r *SQLWebhookRepository) ClaimDeadDelivery(id string, now time.Time, leaseUntil time.Time) (model.WebhookDelivery, bool, error) {
+	claimed, err := r.queryDeliveries(
+		`UPDATE webhook_deliveries SET locked_until = $1
+		WHERE id = $2 AND status = $3 AND (locked_until IS NULL OR locked_until <= $4)
+		RETURNING `+deliveryColumns,
+		leaseUntil.UTC(), id, model.DeliveryDead, now.UTC(),
+	)
+	if err != nil || len(claimed) == 0 {
+		return model.WebhookDelivery{}, false, err
+	}
+	return claimed[0], true, nil
+}
+
+func (r *SQLWebhookRepository) SaveDelivery(delivery model.WebhookDelivery) error {
+	attempts, err := encodeAttempts(delivery.Attempts)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(
+		`UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4, updated_at = $5, locked_until = NULL WHERE id = $1`,
+		delivery.Id, delivery.Status, attempts, delivery.NextAttemptAt, delivery.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save delivery: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("no delivery found with id %s", delivery.Id)
+	}
+	return nil
+}
+
+func (r *SQLWebhookRepository) GetDelivery(id string) (model.WebhookDelivery, error) {
+	delivery, err := scanDelivery(r.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return model.WebhookDelivery{}, fmt.Errorf("no delivery found with id %s", id)
+	}
+	return delivery, err
+}
+
+func (r *SQLWebhookRepository) ListDeliveries(webhookID string, status string, pageSize int, pageNo int) ([]model.WebhookDelivery, int, int, error) {
+	var totalDocuments int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = $1 AND ($2 = '' OR status = $2)`,
+		webhookID, status,
+	).Scan(&totalDocuments)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count deliveries: %v", err)
+	}
+
+	deliveries, err := r.queryDeliveries(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC LIMIT $3 OFFSET $4`,
+		webhookID, status, pageSize, (pageNo-1)*pageSize,
+	)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	lastPage := (totalDocuments + pageSize - 1) / pageSize
+	return deliveries, lastPage, totalDocuments, nil
+}
+
+func (r *SQLWebhookRepository) queryDeliveries(query string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhook(row rowScanner) (model.Webhook, error) {
+	var webhook model.Webhook
+	var eventTypes []byte
+	err := row.Scan(&webhook.Id, &webhook.URL, &webhook.Secret, &eventTypes, &webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	if err := json.Unmarshal(eventTypes, &webhook.EventTypes); err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to decode event types: %v", err)
+	}
+	return webhook, nil
+}
+
+func scanDelivery(row rowScanner) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	var attempts []byte
+	err := row.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventId, &delivery.EventType, &delivery.Payload,
+		&delivery.Status, &attempts, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	if err := json.Unmarshal(attempts, &delivery.Attempts); err != nil {
+		return model.WebhookDelivery{}, fmt.Errorf("failed to decode delivery attempts: %v", err)
+	}
+	return delivery, nil
+}
+
+func encodeAttempts(attempts []model.WebhookAttempt) (string, error) {
+	if attempts == nil {
+		attempts = []model.WebhookAttempt{}
+	}
+	encoded, err := json.Marshal(attempts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode delivery attempts: %v", err)
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,920 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fitness-api/model"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteUserRepository stores users in an embedded SQLite database. Subjects
+// live in a JSON encoded TEXT column and are queried through json_each.
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+// sqliteTimeFunction converts a stored timestamp to Unix nanoseconds. The
+// driver stores time.Time as text in time.Time.String's layout, which does
+// not sort correctly across time zones, so time filters compare through it.
+const sqliteTimeFunction = "unix_nano"
+
+// sqliteTimeLayouts are the layouts timestamps may have been written in: the
+// driver's, SQLite's own CURRENT_TIMESTAMP and RFC 3339.
+var sqliteTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(sqliteTimeFunction, 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var text string
+		switch value := args[0].(type) {
+		case nil:
+			return nil, nil
+		case time.Time:
+			return value.UnixNano(), nil
+		case int64:
+			return value * int64(time.Second), nil
+		case string:
+			text = value
+		case []byte:
+			text = string(value)
+		default:
+			return nil, fmt.Errorf("%s: unsupported value %T", sqliteTimeFunction, value)
+		}
+
+		// Drop the monotonic clock reading time.Time.String appends.
+		if i := strings.Index(text, " m="); i >= 0 {
+			text = text[:i]
+		}
+		for _, layout := range sqliteTimeLayouts {
+			if parsed, err := time.Parse(layout, text); err == nil {
+				return parsed.UnixNano(), nil
+			}
+		}
+		return nil, fmt.Errorf("%s: cannot parse %q", sqliteTimeFunction, text)
+	})
+}
+
+// isSQLiteUniqueViolation reports whether err is a UNIQUE constraint failure.
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// inTx runs fn in a transaction, committing when it succeeds. fn's error is
+// returned unchanged so callers can still test for sql.ErrNoRows.
+func (r *SQLiteUserRepository) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+const sqliteUserColumns = `id, name, email, subjects, created_at, updated_at, deleted_at, version`
+
+func (r *SQLiteUserRepository) CreateUser(user model.User, actor string) (model.User, error) {
+	log.Println("Processing user creation in SQLite")
+
+	var existingID string
+	err := r.db.QueryRow("SELECT id FROM users WHERE email = ? LIMIT 1", user.Email).Scan(&existingID)
+	if err == nil {
+		return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+	}
+	if err != sql.ErrNoRows {
+		return model.User{}, fmt.Errorf("failed to check user existence: %v", err)
+	}
+
+	subjects, err := encodeSubjects(user.Subjects)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	id := newID()
+	var createdUser model.User
+	err = r.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO users (`+sqliteUserColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1)`,
+			id, user.Name, user.Email, subjects, user.CreatedAt, user.UpdatedAt, user.DeletedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if createdUser, err = getSQLiteUser(tx, id, false); err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserCreated, createdUser); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionCreate, actor, nil, &createdUser))
+	})
+	if err != nil {
+		return model.User{}, fmt.Errorf("SQLite insertion error: %v", err)
+	}
+
+	return createdUser, nil
+}
+
+func (r *SQLiteUserRepository) UpdateUser(user model.User, id string, expectedVersion int, actor string) (model.User, error) {
+	log.Printf("Updating user: ID: %s, Name: %s, Email: %s, Subjects: %v", id, user.Name, user.Email, user.Subjects)
+
+	subjects, err := encodeSubjects(user.Subjects)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	var updatedUser model.User
+	err = r.inTx(func(tx *sql.Tx) error {
+		before, err := getSQLiteUser(tx, id, false)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(
+			`UPDATE users SET name = ?, email = ?, subjects = ?, updated_at = ?, version = version + 1
+			WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`,
+			user.Name, user.Email, subjects, user.UpdatedAt, id, expectedVersion, expectedVersion,
+		)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		if updatedUser, err = getSQLiteUser(tx, id, false); err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserUpdated, updatedUser); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionUpdate, actor, &before, &updatedUser))
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if expectedVersion != 0 {
+				if _, err := r.GetUserByID(id, false); err == nil {
+					return model.User{}, fmt.Errorf("version mismatch for user %s", id)
+				}
+			}
+			return model.User{}, fmt.Errorf("no user found with the given ID")
+		}
+		if isSQLiteUniqueViolation(err) {
+			return model.User{}, fmt.Errorf("email %s already exists", user.Email)
+		}
+		log.Printf("SQLite update error: %v\n", err)
+		return model.User{}, fmt.Errorf("failed to update user in SQLite: %v", err)
+	}
+
+	return updatedUser, nil
+}
+
+func (r *SQLiteUserRepository) DeleteUser(id string, actor string) error {
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := getSQLiteUser(tx, id, false)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`UPDATE users SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL`, time.Now(), id)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		deletedUser, err := getSQLiteUser(tx, id, true)
+		if err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserDeleted, deletedUser); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionDelete, actor, &before, &deletedUser))
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no user found with id %s", id)
+		}
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	log.Println("User successfully deleted from SQLite")
+	return nil
+}
+
+func (r *SQLiteUserRepository) RestoreUser(id string, actor string) (model.User, error) {
+	var user model.User
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := getSQLiteUser(tx, id, true)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		if user, err = getSQLiteUser(tx, id, false); err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserRestored, user); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionRestore, actor, &before, &user))
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.User{}, fmt.Errorf("no deleted user found with id %s", id)
+		}
+		return model.User{}, fmt.Errorf("failed to restore user: %v", err)
+	}
+
+	log.Println("User successfully restored in SQLite")
+	return user, nil
+}
+
+func (r *SQLiteUserRepository) PurgeDeletedUsers(deletedBefore time.Time, actor string) (int, error) {
+	purged := 0
+	err := r.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?
+			RETURNING `+sqliteUserColumns, deletedBefore)
+		if err != nil {
+			return err
+		}
+		var users []model.User
+		for rows.Next() {
+			user, err := scanSQLiteUser(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range users {
+			if err := r.writeAudit(tx, newAuditEntry(model.AuditActionPurge, actor, &users[i], nil)); err != nil {
+				return err
+			}
+		}
+		purged = len(users)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge users: %v", err)
+	}
+	return purged, nil
+}
+
+func (r *SQLiteUserRepository) GetAllUsers(query UserQuery) ([]model.User, int, int, error) {
+	pageSize, pageNo := query.PageSize, query.PageNo
+	orderby, order := userOrder(query)
+
+	filter := newSQLiteFilter()
+	where, err := filter.where(query)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	whereArgs := filter.args
+
+	var rows *sql.Rows
+	if pageSize == -1 {
+		rows, err = r.db.Query(fmt.Sprintf(`
+			SELECT %s FROM users
+			WHERE %s
+			ORDER BY %s %s, id %s`, sqliteUserColumns, where, orderby, order, order), whereArgs...)
+	} else {
+		offset := (pageNo - 1) * pageSize
+		rows, err = r.db.Query(fmt.Sprintf(`
+			SELECT %s FROM users
+			WHERE %s
+			ORDER BY %s %s, id %s
+			LIMIT ? OFFSET ?`, sqliteUserColumns, where, orderby, order, order), append(whereArgs, pageSize, offset)...)
+	}
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	var totalDocuments int
+	err = r.db.QueryRow(`SELECT COUNT(*) FROM users WHERE `+where, whereArgs...).Scan(&totalDocuments)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count total users: %v", err)
+	}
+
+	lastPage := 1
+	if pageSize != -1 {
+		lastPage = (totalDocuments + pageSize - 1) / pageSize
+	}
+
+	return users, lastPage, totalDocuments, nil
+}
+
+func (r *SQLiteUserRepository) GetUserByID(id string, includeDeleted bool) (model.User, error) {
+	user, err := getSQLiteUser(r.db, id, includeDeleted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.User{}, fmt.Errorf("user not found")
+		}
+		log.Printf("SQLite query error: %v\n", err)
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// sqliteQuerier is satisfied by *sql.DB and *sql.Tx. The pool holds a single
+// connection, so reads inside a transaction must go through the transaction.
+type sqliteQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getSQLiteUser(q sqliteQuerier, id string, includeDeleted bool) (model.User, error) {
+	row := q.QueryRow(`SELECT `+sqliteUserColumns+` FROM users WHERE id = ? AND (? OR deleted_at IS NULL)`, id, includeDeleted)
+	return scanSQLiteUser(row)
+}
+
+func scanSQLiteUser(row rowScanner) (model.User, error) {
+	var user model.User
+	var subjects string
+	var createdAt, updatedAt, deletedAt *time.Time
+
+	if err := row.Scan(&user.Id, &user.Name, &user.Email, &subjects, &createdAt, &updatedAt, &deletedAt, &user.Version); err != nil {
+		return model.User{}, err
+	}
+	if err := json.Unmarshal([]byte(subjects), &user.Subjects); err != nil {
+		return model.User{}, fmt.Errorf("failed to decode subjects: %v", err)
+	}
+
+	user.CreatedAt = createdAt
+	user.UpdatedAt = updatedAt
+	user.DeletedAt = deletedAt
+	return user, nil
+}
+
+func encodeSubjects(subjects []string) (string, error) {
+	if subjects == nil {
+		subjects = []string{}
+	}
+	encoded, err := json.Marshal(subjects)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode subjects: %v", err)
+	}
+	return string(encoded), nil
+}
+
+func (r *SQLiteUserRepository) RecordUserAudit(entry model.UserAuditEntry) error {
+	if entry.Id == "" {
+		entry.Id = newID()
+	}
+	return r.inTx(func(tx *sql.Tx) error { return r.writeAudit(tx, entry) })
+}
+
+// writeAudit records an audit entry as part of tx.
+func (r *SQLiteUserRepository) writeAudit(tx *sql.Tx, entry model.UserAuditEntry) error {
+	before, err := encodeSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := encodeSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_audit (`+auditColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.Id, entry.UserId, entry.Action, entry.Actor, before, after, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry in SQLite: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) GetUserHistory(userID string, pageSize int, pageNo int) ([]model.UserAuditEntry, int, int, error) {
+	var totalDocuments int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM user_audit WHERE user_id = ?`, userID).Scan(&totalDocuments); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count audit entries: %v", err)
+	}
+
+	rows, err := r.db.Query(
+		`SELECT `+auditColumns+` FROM user_audit WHERE user_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`,
+		userID, pageSize, (pageNo-1)*pageSize,
+	)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to fetch audit entries: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []model.UserAuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, fmt.Errorf("error iterating audit entries: %v", err)
+	}
+
+	lastPage := (totalDocuments + pageSize - 1) / pageSize
+	return entries, lastPage, totalDocuments, nil
+}
+
+// writeEvent records a user event in the outbox as part of tx.
+func (r *SQLiteUserRepository) writeEvent(tx *sql.Tx, eventType string, user model.User) error {
+	event := newUserEvent(eventType, user)
+	payload, err := json.Marshal(event.User)
+	if err != nil {
+		return fmt.Errorf("failed to encode event payload: %v", err)
+	}
+	_, err = tx.Exec(
+		`INSERT INTO user_outbox (id, event_type, user_id, payload, occurred_at) VALUES (?, ?, ?, ?, ?)`,
+		event.Id, event.Type, event.UserId, string(payload), event.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) PendingUserEvents(ctx context.Context, limit int) ([]model.UserEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, event_type, user_id, payload, occurred_at FROM user_outbox
+		WHERE published_at IS NULL ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	defer rows.Close()
+
+	var events []model.UserEvent
+	for rows.Next() {
+		event, err := scanUserEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *SQLiteUserRepository) MarkUserEventPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE user_outbox SET published_at = ? WHERE id = ?`, publishedAt, id); err != nil {
+		return fmt.Errorf("failed to mark event %s published: %v", id, err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) ImportUsers(ctx context.Context, users []model.User, atomic bool, actor string) ([]InsertResult, error) {
+	return runImport(users, atomic, r.inTx, func(tx *sql.Tx, batch []model.User) ([]InsertResult, error) {
+		return r.importBatch(ctx, tx, batch, actor)
+	})
+}
+
+func (r *SQLiteUserRepository) importBatch(ctx context.Context, tx *sql.Tx, users []model.User, actor string) ([]InsertResult, error) {
+	emails := make([]string, len(users))
+	for i, user := range users {
+		emails[i] = user.Email
+	}
+	encodedEmails, err := json.Marshal(emails)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, email FROM users WHERE email IN (SELECT value FROM json_each(?))`, string(encodedEmails))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+	emailOwners := map[string]string{}
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to check user existence: %v", err)
+		}
+		emailOwners[email] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %v", err)
+	}
+
+	results := classifyBatch(users, nil, emailOwners)
+
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO users (`+sqliteUserColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, 1) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return nil, fmt.Errorf("SQLite insertion error: %v", err)
+	}
+	defer insert.Close()
+
+	for i, result := range results {
+		if result.Status != InsertCreated {
+			continue
+		}
+		user := users[i]
+		subjects, err := encodeSubjects(user.Subjects)
+		if err != nil {
+			return nil, err
+		}
+		inserted, err := insert.ExecContext(ctx, user.Id, user.Name, user.Email, subjects, user.CreatedAt, user.UpdatedAt, user.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("SQLite insertion error: %v", err)
+		}
+		if rowsAffected, err := inserted.RowsAffected(); err != nil || rowsAffected == 0 {
+			results[i].Status = InsertDuplicateEmail
+			continue
+		}
+		if err := r.writeEvent(tx, model.UserCreated, user); err != nil {
+			return nil, err
+		}
+		if err := r.writeAudit(tx, newAuditEntry(model.AuditActionCreate, actor, nil, &user)); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// StreamUsers holds the only connection until the rows are drained, so fn
+// must not call back into the repository.
+func (r *SQLiteUserRepository) StreamUsers(ctx context.Context, query UserQuery, fn func(model.User) error) error {
+	orderby, order := userOrder(query)
+	filter := newSQLiteFilter()
+	where, err := filter.where(query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM users
+		WHERE %s
+		ORDER BY %s %s, id %s`, sqliteUserColumns, where, orderby, order, order), filter.args...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan user: %v", err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) GetUsersPage(query UserQuery, cursor *UserCursor) ([]model.User, bool, error) {
+	orderby, order := userOrder(query)
+	comparison, direction := keysetDirection(order, cursor)
+
+	filter := newSQLiteFilter()
+	where, err := filter.where(query)
+	if err != nil {
+		return nil, false, err
+	}
+	args := filter.args
+	if cursor != nil {
+		where += fmt.Sprintf(` AND (%s, id) %s (?, ?)`, orderby, comparison)
+		args = append(args, cursor.Key, cursor.Id)
+	}
+	args = append(args, query.PageSize+1)
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT %s FROM users
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT ?`, sqliteUserColumns, where, orderby, direction, direction), args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	users, hasMore := keysetPage(users, query.PageSize, cursor)
+	return users, hasMore, nil
+}
+
+// SearchUsers picks candidates through the users_fts index and scores them
+// in Go, keeping only the best search.Limit. Full-text searches take the users
+// having every term as a word. Autocomplete runs in the stages of
+// MongoUserRepository.SearchUsers: every term as a word, then as a word
+// prefix, then any word starting like some term, which may be a typo. Each
+// stage fetches at most autocompleteCandidates users not seen yet, and a
+// later stage only runs while fewer than the limit have matched.
+func (r *SQLiteUserRepository) SearchUsers(ctx context.Context, search UserSearch) ([]UserSearchResult, error) {
+	terms := searchTerms(search.Query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	// The terms are letters and digits only, so quoting them is enough to
+	// keep FTS5 from reading them as operators.
+	exact, prefixes, initials := make([]string, len(terms)), make([]string, len(terms)), make([]string, len(terms))
+	for i, term := range terms {
+		exact[i] = `"` + term + `"`
+		prefixes[i] = exact[i] + "*"
+		initials[i] = `"` + string([]rune(term)[0]) + `"*`
+	}
+
+	ranker := newSearchRanker(search)
+	if search.Mode != SearchModeAutocomplete {
+		if err := r.searchCandidates(ctx, strings.Join(exact, " AND "), search.IncludeDeleted, []string{}, -1, ranker.add); err != nil {
+			return nil, err
+		}
+		return ranker.results(), nil
+	}
+
+	seen := []string{}
+	stages := []string{strings.Join(exact, " AND "), strings.Join(prefixes, " AND "), strings.Join(initials, " OR ")}
+	for _, match := range stages {
+		err := r.searchCandidates(ctx, match, search.IncludeDeleted, seen, autocompleteCandidates, func(user model.User) {
+			seen = append(seen, user.Id)
+			ranker.add(user)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ranker.full() {
+			break
+		}
+	}
+	return ranker.results(), nil
+}
+
+// searchCandidates streams to add the users matching the FTS5 query match,
+// newest first, leaving out the ids in skip. A negative limit fetches them
+// all.
+func (r *SQLiteUserRepository) searchCandidates(ctx context.Context, match string, includeDeleted bool, skip []string, limit int, add func(model.User)) error {
+	skipped, err := json.Marshal(skip)
+	if err != nil {
+		return fmt.Errorf("failed to search users: %v", err)
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT `+sqliteUserColumns+` FROM users
+		WHERE rowid IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?)
+		AND (? OR deleted_at IS NULL)
+		AND id NOT IN (SELECT value FROM json_each(?))
+		ORDER BY id DESC LIMIT ?`, match, includeDeleted, string(skipped), limit)
+	if err != nil {
+		return fmt.Errorf("failed to search users: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan user: %v", err)
+		}
+		add(user)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to search users: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) ReplaceSubject(ctx context.Context, from string, to string, updatedAt time.Time) (int, error) {
+	replaced := 0
+	err := r.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT `+sqliteUserColumns+` FROM users
+			WHERE EXISTS (SELECT 1 FROM json_each(users.subjects) AS s WHERE s.value = ?)`, from)
+		if err != nil {
+			return err
+		}
+		var users []model.User
+		for rows.Next() {
+			user, err := scanSQLiteUser(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			user.Subjects = replaceSubject(user.Subjects, from, to)
+			user.UpdatedAt = &updatedAt
+			user.Version++
+			subjects, err := encodeSubjects(user.Subjects)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `UPDATE users SET subjects = ?, updated_at = ?, version = ? WHERE id = ?`,
+				subjects, updatedAt, user.Version, user.Id)
+			if err != nil {
+				return err
+			}
+			if err := r.writeEvent(tx, model.UserUpdated, user); err != nil {
+				return err
+			}
+		}
+		replaced = len(users)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to replace subject in SQLite: %v", err)
+	}
+	return replaced, nil
+}
+
+func (r *SQLiteUserRepository) AddUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, subject, updatedAt, actor,
+		`json_insert(subjects, '$[#]', ?)`,
+		`NOT EXISTS (SELECT 1 FROM json_each(users.subjects) AS s WHERE s.value = ?)`)
+}
+
+func (r *SQLiteUserRepository) RemoveUserSubject(id string, subject string, updatedAt time.Time, actor string) (model.User, bool, error) {
+	return r.editSubjects(id, subject, updatedAt, actor,
+		`(SELECT json_group_array(s.value) FROM json_each(users.subjects) AS s WHERE s.value <> ?)`,
+		`EXISTS (SELECT 1 FROM json_each(users.subjects) AS s WHERE s.value = ?)`)
+}
+
+// editSubjects sets subjects to the expression set when condition holds,
+// each taking the subject as its one placeholder. The condition makes a
+// repeated add or remove a no-op that leaves the version alone.
+func (r *SQLiteUserRepository) editSubjects(id string, subject string, updatedAt time.Time, actor string, set string, condition string) (model.User, bool, error) {
+	var user model.User
+	err := r.inTx(func(tx *sql.Tx) error {
+		before, err := getSQLiteUser(tx, id, false)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(
+			`UPDATE users SET subjects = `+set+`, updated_at = ?, version = version + 1
+			WHERE id = ? AND deleted_at IS NULL AND `+condition,
+			subject, updatedAt, id, subject,
+		)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		if user, err = getSQLiteUser(tx, id, false); err != nil {
+			return err
+		}
+		if err := r.writeEvent(tx, model.UserUpdated, user); err != nil {
+			return err
+		}
+		return r.writeAudit(tx, newAuditEntry(model.AuditActionUpdate, actor, &before, &user))
+	})
+	if err == sql.ErrNoRows {
+		user, err := r.GetUserByID(id, false)
+		if err != nil {
+			return model.User{}, false, fmt.Errorf("no user found with the given ID: %s", id)
+		}
+		return user, false, nil
+	}
+	if err != nil {
+		log.Printf("SQLite subject update error: %v\n", err)
+		return model.User{}, false, fmt.Errorf("failed to update user subjects in SQLite: %v", err)
+	}
+	return user, true, nil
+}
+
+// sqlitePeriodModifiers turn a unixepoch into the start of each stats
+// interval with SQLite's date modifiers.
+var sqlitePeriodModifiers = map[string]string{
+	StatsIntervalDay:   ``,
+	StatsIntervalWeek:  `, 'weekday 0', '-6 days'`,
+	StatsIntervalMonth: `, 'start of month'`,
+}
+
+func (r *SQLiteUserRepository) CountUsersBySubject(ctx context.Context, query UserStatsQuery) ([]SubjectCount, error) {
+	where := newSQLiteFilter()
+	whereClause, err := where.where(query.userQuery(query.IncludeDeleted))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT subject.value, COUNT(DISTINCT users.id)
+		FROM users, json_each(users.subjects) AS subject
+		WHERE `+whereClause+`
+		GROUP BY subject.value
+		ORDER BY 2 DESC, subject.value`, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users by subject: %v", err)
+	}
+	defer rows.Close()
+
+	counts := []SubjectCount{}
+	for rows.Next() {
+		var count SubjectCount
+		if err := rows.Scan(&count.Subject, &count.Users); err != nil {
+			return nil, fmt.Errorf("failed to scan subject count: %v", err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+func (r *SQLiteUserRepository) CountSignups(ctx context.Context, interval string, query UserStatsQuery) ([]SignupBucket, error) {
+	modifiers, ok := sqlitePeriodModifiers[interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interval %q", interval)
+	}
+	where := newSQLiteFilter()
+	whereClause, err := where.where(query.userQuery(true))
+	if err != nil {
+		return nil, err
+	}
+	period := fmt.Sprintf(`date(%s(created_at) / 1000000000, 'unixepoch'%s)`, sqliteTimeFunction, modifiers)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+period+`, COUNT(*)
+		FROM users
+		WHERE `+whereClause+` AND created_at IS NOT NULL
+		GROUP BY 1
+		ORDER BY 1`, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count signups: %v", err)
+	}
+	defer rows.Close()
+
+	buckets := []SignupBucket{}
+	for rows.Next() {
+		var bucket SignupBucket
+		if err := rows.Scan(&bucket.Period, &bucket.Users); err != nil {
+			return nil, fmt.Errorf("failed to scan signup count: %v", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+func (r *SQLiteUserRepository) CountUsers(ctx context.Context, query UserStatsQuery) (UserTotals, error) {
+	where := newSQLiteFilter()
+	whereClause, err := where.where(query.userQuery(true))
+	if err != nil {
+		return UserTotals{}, err
+	}
+
+	var totals UserTotals
+	err = r.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(deleted_at IS NULL), 0),
+			COALESCE(SUM(deleted_at IS NOT NULL), 0),
+			COALESCE(AVG(CASE WHEN deleted_at IS NULL THEN json_array_length(subjects) END), 0)
+		FROM users
+		WHERE `+whereClause, where.args...).Scan(&totals.Active, &totals.Deleted, &totals.AverageSubjects)
+	if err != nil {
+		return UserTotals{}, fmt.Errorf("failed to count users: %v", err)
+	}
+	totals.Total = totals.Active + totals.Deleted
+	return totals, nil
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"fitness-api/model"
+)
+
+// SubjectRepository stores the subject catalog. It lives on the same backend
+// as the users. Slugs are unique: creating or renaming a subject onto a slug
+// another subject holds fails with "subject <slug> already exists".
+type SubjectRepository interface {
+	CreateSubject(subject model.Subject) (model.Subject, error)
+	UpdateSubject(subject model.Subject) (model.Subject, error)
+	DeleteSubject(id string) error
+	GetSubject(id string) (model.Subject, error)
+	// ListSubjects returns the whole catalog ordered by slug.
+	ListSubjects() ([]model.Subject, error)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fitness-api/model"
+)
+
+// InsertStatus describes what happened to one user in a batch insert.
+type InsertStatus string
+
+const (
+	InsertCreated        InsertStatus = "created"
+	InsertExists         InsertStatus = "exists"
+	InsertDuplicateEmail InsertStatus = "duplicate_email"
+	InsertInvalid        InsertStatus = "invalid"
+	// InsertSkipped marks a user that could have been created but was not
+	// because an all-or-nothing import was rejected.
+	InsertSkipped InsertStatus = "skipped"
+)
+
+type InsertResult struct {
+	Id     string       `json:"id"`
+	Email  string       `json:"email"`
+	Status InsertStatus `json:"status"`
+	// ConflictId is the id of the stored user that already owns Email.
+	ConflictId string `json:"conflict_id,omitempty"`
+}
+
+// UserBatchReader streams every user, soft-deleted ones included, in
+// ascending id order so a copy can resume after the last id it handled.
+type UserBatchReader interface {
+	UsersAfter(ctx context.Context, afterID string, limit int) ([]model.User, error)
+}
+
+// UserBatchWriter inserts users exactly as given, keeping their ids and
+// timestamps. Users whose id or email is already stored are reported rather
+// than overwritten. With dryRun set nothing is written but the results
+// describe what would have happened.
+type UserBatchWriter interface {
+	InsertUsers(ctx context.Context, users []model.User, dryRun bool) ([]InsertResult, error)
+}
+
+// UserReplacer writes a user exactly as given, version and deleted_at
+// included, inserting it when its id is not stored yet. A stored copy with the
+// same or a higher version is left alone, so replays that arrive out of order
+// never roll a user back. No event is written: it mirrors a change another
+// backend already announced.
+type UserReplacer interface {
+	ReplaceUser(ctx context.Context, user model.User) error
+}
+
+// classifyBatch decides the outcome of every user in a batch given the ids
+// and emails that are already stored. Emails repeated inside the batch are
+// treated as conflicts with their first occurrence.
+func classifyBatch(users []model.User, existingIDs map[string]bool, emailOwners map[string]string) []InsertResult {
+	results := make([]InsertResult, len(users))
+	seenEmails := map[string]string{}
+
+	for i, user := range users {
+		result := InsertResult{Id: user.Id, Email: user.Email, Status: InsertCreated}
+		switch {
+		case user.Id == "" || user.Email == "":
+			result.Status = InsertInvalid
+		case existingIDs[user.Id]:
+			result.Status = InsertExists
+		case emailOwners[user.Email] != "":
+			result.Status = InsertDuplicateEmail
+			result.ConflictId = emailOwners[user.Email]
+		case seenEmails[user.Email] != "":
+			result.Status = InsertDuplicateEmail
+			result.ConflictId = seenEmails[user.Email]
+		default:
+			seenEmails[user.Email] = user.Id
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// importBatchSize bounds how many users one insert statement carries.
+const importBatchSize = 500
+
+var errImportRejected = errors.New("import rejected")
+
+// UserImporter creates brand new users in bulk. Unlike InsertUsers it issues
+// fresh ids and records every created user in the audit history under actor
+// and with a UserCreated event, written in the same transaction as the user.
+// With atomic set either every user is created or none is, and the
+// would-be-created ones are reported as skipped.
+type UserImporter interface {
+	ImportUsers(ctx context.Context, users []model.User, atomic bool, actor string) ([]InsertResult, error)
+}
+
+// runImport drives ImportUsers for the transactional backends. It assigns
+// ids, then hands users to importBatch in batches of importBatchSize. A
+// best-effort import commits batch by batch; an atomic one runs every batch
+// in a single transaction and rolls it back unless all users were created.
+func runImport[T any](users []model.User, atomic bool, inTx func(func(T) error) error, importBatch func(T, []model.User) ([]InsertResult, error)) ([]InsertResult, error) {
+	users = withNewIDs(users)
+	results := make([]InsertResult, 0, len(users))
+
+	importAll := func(tx T, batches [][]model.User) error {
+		for _, batch := range batches {
+			batchResults, err := importBatch(tx, batch)
+			if err != nil {
+				return err
+			}
+			results = append(results, batchResults...)
+		}
+		return nil
+	}
+
+	batches := splitBatches(users)
+	if !atomic {
+		for _, batch := range batches {
+			if err := inTx(func(tx T) error { return importAll(tx, [][]model.User{batch}) }); err != nil {
+				return nil, err
+			}
+		}
+		return results, nil
+	}
+
+	err := inTx(func(tx T) error {
+		results = results[:0]
+		if err := importAll(tx, batches); err != nil {
+			return err
+		}
+		if !allCreated(results) {
+			return errImportRejected
+		}
+		return nil
+	})
+	if err == errImportRejected {
+		return rejectImport(results), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func withNewIDs(users []model.User) []model.User {
+	prepared := make([]model.User, len(users))
+	for i, user := range users {
+		user.Id = newID()
+		user.Version = 1
+		prepared[i] = user
+	}
+	return prepared
+}
+
+func splitBatches(users []model.User) [][]model.User {
+	var batches [][]model.User
+	for start := 0; start < len(users); start += importBatchSize {
+		batches = append(batches, users[start:min(start+importBatchSize, len(users))])
+	}
+	return batches
+}
+
+func allCreated(results []InsertResult) bool {
+	for _, result := range results {
+		if result.Status != InsertCreated {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectImport reports an atomic import that was rolled back: users that
+// would have been created are skipped and lose the id they were given.
+func rejectImport(results []InsertResult) []InsertResult {
+	for i := range results {
+		if results[i].Status == InsertCreated {
+			results[i].Status = InsertSkipped
+			results[i].Id = ""
+		}
+	}
+	return results
+}
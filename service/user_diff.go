@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fitness-api/model"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// timestampTolerance absorbs precision differences between backends:
+// MongoDB stores milliseconds while PostgreSQL keeps microseconds.
+const timestampTolerance = time.Millisecond
+
+// FieldDiff is one field that differs between two copies of a user.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Left  string `json:"left"`
+	Right string `json:"right"`
+	// Drift is set for timestamp fields and holds right minus left.
+	Drift time.Duration `json:"drift_ns,omitempty"`
+}
+
+// DiffUsers compares the stored fields of two copies of the same user.
+func DiffUsers(left model.User, right model.User) []FieldDiff {
+	var diffs []FieldDiff
+	if left.Name != right.Name {
+		diffs = append(diffs, FieldDiff{Field: "name", Left: left.Name, Right: right.Name})
+	}
+	if left.Email != right.Email {
+		diffs = append(diffs, FieldDiff{Field: "email", Left: left.Email, Right: right.Email})
+	}
+	if !sameSubjects(left.Subjects, right.Subjects) {
+		diffs = append(diffs, FieldDiff{Field: "subjects", Left: fmt.Sprint(left.Subjects), Right: fmt.Sprint(right.Subjects)})
+	}
+	if left.Version != right.Version {
+		diffs = append(diffs, FieldDiff{Field: "version", Left: fmt.Sprint(left.Version), Right: fmt.Sprint(right.Version)})
+	}
+	diffs = appendTimeDiff(diffs, "created_at", left.CreatedAt, right.CreatedAt)
+	diffs = appendTimeDiff(diffs, "updated_at", left.UpdatedAt, right.UpdatedAt)
+	diffs = appendTimeDiff(diffs, "deleted_at", left.DeletedAt, right.DeletedAt)
+	return diffs
+}
+
+// sameSubjects treats nil and empty as equal since backends differ in how
+// they hand back an empty array.
+func sameSubjects(left []string, right []string) bool {
+	if len(left) == 0 && len(right) == 0 {
+		return true
+	}
+	return slices.Equal(left, right)
+}
+
+func appendTimeDiff(diffs []FieldDiff, field string, left *time.Time, right *time.Time) []FieldDiff {
+	switch {
+	case left == nil && right == nil:
+		return diffs
+	case left == nil || right == nil:
+		return append(diffs, FieldDiff{Field: field, Left: formatOptionalTime(left), Right: formatOptionalTime(right)})
+	}
+
+	drift := right.Sub(*left)
+	if drift.Abs() < timestampTolerance {
+		return diffs
+	}
+	return append(diffs, FieldDiff{Field: field, Left: formatOptionalTime(left), Right: formatOptionalTime(right), Drift: drift})
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
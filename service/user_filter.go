@@ -0,0 +1,348 @@
+package service
+
+import (
+	"encoding/json"
+	"fitness-api/filter"
+	"fitness-api/model"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// hidesDeleted reports whether soft-deleted users are left out of a listing.
+// A filter on the deleted field takes over from IncludeDeleted.
+func (q UserQuery) hidesDeleted() bool {
+	return !q.IncludeDeleted && !filter.References(q.Filter, filter.FieldDeleted)
+}
+
+// mongoUserFilter translates the query's subject, deleted state and filter
+// into a MongoDB filter document.
+func mongoUserFilter(query UserQuery) bson.M {
+	conditions := bson.A{}
+	if query.Subject != "" {
+		conditions = append(conditions, bson.M{"subjects": query.Subject})
+	}
+	if query.hidesDeleted() {
+		conditions = append(conditions, bson.M{"deleted_at": nil})
+	}
+	if query.Filter != nil {
+		conditions = append(conditions, mongoFilterExpr(query.Filter))
+	}
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": conditions}
+}
+
+func mongoFilterExpr(expr filter.Expr) bson.M {
+	switch e := expr.(type) {
+	case filter.And:
+		terms := bson.A{}
+		for _, term := range e.Terms {
+			terms = append(terms, mongoFilterExpr(term))
+		}
+		return bson.M{"$and": terms}
+	case filter.Or:
+		terms := bson.A{}
+		for _, term := range e.Terms {
+			terms = append(terms, mongoFilterExpr(term))
+		}
+		return bson.M{"$or": terms}
+	case filter.Not:
+		return bson.M{"$nor": bson.A{mongoFilterExpr(e.Term)}}
+	case filter.Condition:
+		return mongoFilterCondition(e)
+	}
+	return bson.M{}
+}
+
+func mongoFilterCondition(c filter.Condition) bson.M {
+	switch c.Field {
+	case filter.FieldName, filter.FieldEmail:
+		if c.Op == filter.OpEq {
+			return bson.M{c.Field: c.Values[0]}
+		}
+		pattern, options := regexp.QuoteMeta(c.Values[0]), ""
+		switch c.Op {
+		case filter.OpPrefix, filter.OpIPrefix:
+			pattern = "^" + pattern
+		case filter.OpIEq:
+			pattern = "^" + pattern + "$"
+		}
+		if c.Op == filter.OpIEq || c.Op == filter.OpIPrefix || c.Op == filter.OpIContains {
+			options = "i"
+		}
+		return bson.M{c.Field: primitive.Regex{Pattern: pattern, Options: options}}
+	case filter.FieldSubjects:
+		values := bson.A{}
+		for _, value := range c.Values {
+			values = append(values, value)
+		}
+		if c.Op == filter.OpAll {
+			return bson.M{"subjects": bson.M{"$all": values}}
+		}
+		return bson.M{"subjects": bson.M{"$in": values}}
+	case filter.FieldDeleted:
+		if c.Deleted {
+			return bson.M{"deleted_at": bson.M{"$ne": nil}}
+		}
+		return bson.M{"deleted_at": nil}
+	default:
+		operators := map[filter.Op]string{
+			filter.OpBefore:     "$lt",
+			filter.OpAtOrBefore: "$lte",
+			filter.OpAfter:      "$gt",
+			filter.OpAtOrAfter:  "$gte",
+			filter.OpAt:         "$eq",
+		}
+		return bson.M{c.Field: bson.M{operators[c.Op]: c.Time}}
+	}
+}
+
+// sqlFilter builds a parameterised WHERE clause. placeholder returns the
+// marker for the next argument, so the same builder serves PostgreSQL ($N)
+// and SQLite (?).
+type sqlFilter struct {
+	args        []interface{}
+	placeholder func(n int) string
+	// Dialect-specific fragments.
+	subjectsAny func(values string) string
+	subjectsAll func(values string) string
+	subjectsArg func(values []string) (interface{}, error)
+	timeColumn  func(column string) string
+	timeArg     func(t time.Time) interface{}
+	textColumn  func(column string) string
+	// position names the function returning the 1-based index of a
+	// substring, or 0 when it is absent.
+	position string
+}
+
+func (f *sqlFilter) arg(value interface{}) string {
+	f.args = append(f.args, value)
+	return f.placeholder(len(f.args))
+}
+
+// where returns the conditions for the query's subject, deleted state and
+// filter, joined with AND. It never returns an empty string.
+func (f *sqlFilter) where(query UserQuery) (string, error) {
+	conditions := []string{"1 = 1"}
+	if query.Subject != "" {
+		values, err := f.subjectsArg([]string{query.Subject})
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, f.subjectsAny(f.arg(values)))
+	}
+	if query.hidesDeleted() {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if query.Filter != nil {
+		condition, err := f.expr(query.Filter)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, condition)
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+func (f *sqlFilter) expr(expr filter.Expr) (string, error) {
+	switch e := expr.(type) {
+	case filter.And, filter.Or:
+		terms, separator := []filter.Expr(nil), " AND "
+		if and, ok := e.(filter.And); ok {
+			terms = and.Terms
+		} else {
+			terms, separator = e.(filter.Or).Terms, " OR "
+		}
+		parts := make([]string, len(terms))
+		for i, term := range terms {
+			part, err := f.expr(term)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return "(" + strings.Join(parts, separator) + ")", nil
+	case filter.Not:
+		term, err := f.expr(e.Term)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + term, nil
+	case filter.Condition:
+		return f.condition(e)
+	}
+	return "", fmt.Errorf("unsupported filter expression %T", expr)
+}
+
+// condition renders one test. Every test is true or false, never NULL, so
+// NOT behaves the same as it does on MongoDB and in memory.
+func (f *sqlFilter) condition(c filter.Condition) (string, error) {
+	switch c.Field {
+	case filter.FieldName, filter.FieldEmail:
+		column, value := f.textColumn(c.Field), c.Values[0]
+		switch c.Op {
+		case filter.OpIEq, filter.OpIPrefix, filter.OpIContains:
+			column, value = "lower("+column+")", strings.ToLower(value)
+		}
+		switch c.Op {
+		case filter.OpEq, filter.OpIEq:
+			return fmt.Sprintf("(%s = %s)", column, f.arg(value)), nil
+		case filter.OpPrefix, filter.OpIPrefix:
+			return fmt.Sprintf("(substr(%s, 1, %d) = %s)", column, len([]rune(value)), f.arg(value)), nil
+		default:
+			return fmt.Sprintf("(%s(%s, %s) > 0)", f.position, column, f.arg(value)), nil
+		}
+	case filter.FieldSubjects:
+		values, err := f.subjectsArg(c.Values)
+		if err != nil {
+			return "", err
+		}
+		if c.Op == filter.OpAll {
+			return f.subjectsAll(f.arg(values)), nil
+		}
+		return f.subjectsAny(f.arg(values)), nil
+	case filter.FieldDeleted:
+		if c.Deleted {
+			return "(deleted_at IS NOT NULL)", nil
+		}
+		return "(deleted_at IS NULL)", nil
+	default:
+		return fmt.Sprintf("(%s IS NOT NULL AND %s %s %s)", c.Field, f.timeColumn(c.Field), c.Op, f.arg(f.timeArg(c.Time))), nil
+	}
+}
+
+// newPostgresFilter starts a WHERE clause whose placeholders follow the
+// arguments already in args.
+func newPostgresFilter(args ...interface{}) *sqlFilter {
+	return &sqlFilter{
+		args:        args,
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		subjectsAny: func(values string) string { return "(COALESCE(subjects && " + values + "::text[], FALSE))" },
+		subjectsAll: func(values string) string { return "(COALESCE(subjects @> " + values + "::text[], FALSE))" },
+		subjectsArg: func(values []string) (interface{}, error) { return pq.Array(values), nil },
+		timeColumn:  func(column string) string { return column },
+		timeArg:     func(t time.Time) interface{} { return t.UTC() },
+		textColumn:  func(column string) string { return "COALESCE(" + column + ", '')" },
+		position:    "strpos",
+	}
+}
+
+// newSQLiteFilter builds a WHERE clause for SQLite, where subjects is a JSON
+// array and timestamps are stored as text by the driver.
+func newSQLiteFilter() *sqlFilter {
+	return &sqlFilter{
+		placeholder: func(int) string { return "?" },
+		subjectsAny: func(values string) string {
+			return "(EXISTS (SELECT 1 FROM json_each(users.subjects) AS s WHERE s.value IN (SELECT value FROM json_each(" + values + "))))"
+		},
+		subjectsAll: func(values string) string {
+			return "(NOT EXISTS (SELECT 1 FROM json_each(" + values + ") AS wanted WHERE wanted.value NOT IN (SELECT value FROM json_each(users.subjects))))"
+		},
+		subjectsArg: func(values []string) (interface{}, error) {
+			encoded, err := json.Marshal(values)
+			return string(encoded), err
+		},
+		timeColumn: func(column string) string { return sqliteTimeFunction + "(" + column + ")" },
+		timeArg:    func(t time.Time) interface{} { return t.UnixNano() },
+		textColumn: func(column string) string { return column },
+		position:   "instr",
+	}
+}
+
+// matchesUserQuery applies the query's subject, deleted state and filter to
+// a user held in memory.
+func matchesUserQuery(user model.User, query UserQuery) bool {
+	if query.Subject != "" && !hasSubject(user.Subjects, query.Subject) {
+		return false
+	}
+	if user.DeletedAt != nil && query.hidesDeleted() {
+		return false
+	}
+	return query.Filter == nil || matchesFilter(user, query.Filter)
+}
+
+func matchesFilter(user model.User, expr filter.Expr) bool {
+	switch e := expr.(type) {
+	case filter.And:
+		for _, term := range e.Terms {
+			if !matchesFilter(user, term) {
+				return false
+			}
+		}
+		return true
+	case filter.Or:
+		for _, term := range e.Terms {
+			if matchesFilter(user, term) {
+				return true
+			}
+		}
+		return false
+	case filter.Not:
+		return !matchesFilter(user, e.Term)
+	case filter.Condition:
+		return matchesCondition(user, e)
+	}
+	return false
+}
+
+func matchesCondition(user model.User, c filter.Condition) bool {
+	switch c.Field {
+	case filter.FieldName, filter.FieldEmail:
+		text, value := user.Name, c.Values[0]
+		if c.Field == filter.FieldEmail {
+			text = user.Email
+		}
+		switch c.Op {
+		case filter.OpIEq, filter.OpIPrefix, filter.OpIContains:
+			text, value = strings.ToLower(text), strings.ToLower(value)
+		}
+		switch c.Op {
+		case filter.OpEq, filter.OpIEq:
+			return text == value
+		case filter.OpPrefix, filter.OpIPrefix:
+			return strings.HasPrefix(text, value)
+		default:
+			return strings.Contains(text, value)
+		}
+	case filter.FieldSubjects:
+		for _, value := range c.Values {
+			found := hasSubject(user.Subjects, value)
+			if found && c.Op == filter.OpAny {
+				return true
+			}
+			if !found && c.Op == filter.OpAll {
+				return false
+			}
+		}
+		return c.Op == filter.OpAll
+	case filter.FieldDeleted:
+		return (user.DeletedAt != nil) == c.Deleted
+	default:
+		at := user.CreatedAt
+		if c.Field == filter.FieldUpdatedAt {
+			at = user.UpdatedAt
+		}
+		if at == nil {
+			return false
+		}
+		switch c.Op {
+		case filter.OpBefore:
+			return at.Before(c.Time)
+		case filter.OpAtOrBefore:
+			return !at.After(c.Time)
+		case filter.OpAfter:
+			return at.After(c.Time)
+		case filter.OpAtOrAfter:
+			return !at.Before(c.Time)
+		default:
+			return at.Equal(c.Time)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"fitness-api/model"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// SearchModeFullText matches whole words, ranked by relevance.
+	SearchModeFullText = "fulltext"
+	// SearchModeAutocomplete matches words by prefix and tolerates small
+	// typos, for type-ahead pickers.
+	SearchModeAutocomplete = "autocomplete"
+)
+
+// UserSearch is a search over users' names and emails.
+type UserSearch struct {
+	Query          string
+	Mode           string
+	Limit          int
+	IncludeDeleted bool
+}
+
+type UserSearchResult struct {
+	Score float64    `json:"score"`
+	User  model.User `json:"user"`
+}
+
+// UserSearcher returns the users best matching a search, highest score
+// first. Scores are only comparable within one backend.
+type UserSearcher interface {
+	SearchUsers(ctx context.Context, search UserSearch) ([]UserSearchResult, error)
+}
+
+// autocompleteCandidates bounds how many users a backend without a fuzzy
+// index scores in Go per stage of one autocomplete search.
+const autocompleteCandidates = 1000
+
+// searchTerms splits text into lower-case words of letters and digits, so
+// "Ann.Lee@example.com" yields ann, lee, example and com.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchWords is every distinct search term of a user's name and email, the
+// form backends without a word index store to match prefixes against.
+func SearchWords(name string, email string) []string {
+	words := []string{}
+	for _, word := range append(searchTerms(name), searchTerms(email)...) {
+		if !hasSubject(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// scoreUser rates how well user matches the search terms, or returns 0 when
+// some term matches nothing. Every term must match a word of the name or the
+// email; name matches count for more.
+func scoreUser(user model.User, terms []string, mode string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	nameWords, emailWords := searchTerms(user.Name), searchTerms(user.Email)
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, word := range nameWords {
+			best = max(best, scoreWord(term, word, mode))
+		}
+		for _, word := range emailWords {
+			best = max(best, 0.5*scoreWord(term, word, mode))
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
+
+// scoreWord rates one search term against one word: 1 for an exact match,
+// less for a prefix and less again for a prefix with typos. Full-text
+// searches only accept exact matches.
+func scoreWord(term string, word string, mode string) float64 {
+	if term == word {
+		return 1
+	}
+	if mode != SearchModeAutocomplete {
+		return 0
+	}
+
+	termRunes, wordRunes := []rune(term), []rune(word)
+	if strings.HasPrefix(word, term) {
+		return 0.5 + 0.4*float64(len(termRunes))/float64(len(wordRunes))
+	}
+
+	// Compare the term with the start of the word, allowing for the typo
+	// to have added or dropped characters.
+	allowed := typosAllowed(len(termRunes))
+	distance := allowed + 1
+	for length := len(termRunes) - allowed; length <= len(termRunes)+allowed; length++ {
+		if length > 0 && length <= len(wordRunes) {
+			distance = min(distance, editDistance(termRunes, wordRunes[:length]))
+		}
+	}
+	if distance > allowed {
+		return 0
+	}
+	return 0.4 * (1 - float64(distance)/float64(len(termRunes)+1))
+}
+
+// typosAllowed grows with the term so short prefixes stay precise.
+func typosAllowed(length int) int {
+	switch {
+	case length < 3:
+		return 0
+	case length < 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b.
+func editDistance(a []rune, b []rune) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
+
+// rankUsers scores candidates in Go for the backends whose index cannot rank
+// a search itself and keeps the best search.Limit of them.
+func rankUsers(candidates []model.User, search UserSearch) []UserSearchResult {
+	ranker := newSearchRanker(search)
+	for _, user := range candidates {
+		ranker.add(user)
+	}
+	return ranker.results()
+}
+
+// searchRanker scores users one at a time and keeps only the best
+// search.Limit, so a backend can stream every candidate through it without
+// holding them all. The heap keeps the worst kept result on top, to be
+// dropped when a better one comes along.
+type searchRanker struct {
+	terms []string
+	mode  string
+	limit int
+	kept  searchHeap
+}
+
+func newSearchRanker(search UserSearch) *searchRanker {
+	return &searchRanker{terms: searchTerms(search.Query), mode: search.Mode, limit: search.Limit}
+}
+
+func (r *searchRanker) add(user model.User) {
+	score := scoreUser(user, r.terms, r.mode)
+	if score == 0 || r.limit <= 0 {
+		return
+	}
+	result := UserSearchResult{Score: score, User: user}
+	if len(r.kept) < r.limit {
+		heap.Push(&r.kept, result)
+		return
+	}
+	if ranksBefore(result, r.kept[0]) {
+		r.kept[0] = result
+		heap.Fix(&r.kept, 0)
+	}
+}
+
+// full reports whether limit results are kept, so a later candidate can only
+// replace one of them.
+func (r *searchRanker) full() bool {
+	return len(r.kept) >= r.limit
+}
+
+// results returns the kept results, best first.
+func (r *searchRanker) results() []UserSearchResult {
+	results := append([]UserSearchResult(nil), r.kept...)
+	sort.Slice(results, func(i, j int) bool { return ranksBefore(results[i], results[j]) })
+	return results
+}
+
+// ranksBefore orders by score, then by id so equal scores come back in a
+// stable order.
+func ranksBefore(a UserSearchResult, b UserSearchResult) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.User.Id > b.User.Id
+}
+
+// searchHeap is a min-heap of results under ranksBefore.
+type searchHeap []UserSearchResult
+
+func (h searchHeap) Len() int           { return len(h) }
+func (h searchHeap) Less(i, j int) bool { return ranksBefore(h[j], h[i]) }
+func (h searchHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *searchHeap) Push(x any)        { *h = append(*h, x.(UserSearchResult)) }
+func (h *searchHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
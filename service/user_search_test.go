@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"fitness-api/model"
+	"fitness-api/service"
+	"testing"
+	"time"
+)
+
+func TestSearchUsers(t *testing.T) {
+	backends := map[string]func(t *testing.T) service.UserRepository{
+		"memory": func(t *testing.T) service.UserRepository { return service.NewMemoryUserRepository() },
+		"sqlite": func(t *testing.T) service.UserRepository { return openSQLiteRepository(t) },
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			repo := open(t)
+			ctx := context.Background()
+			now := time.Now()
+			create := func(name string, email string) model.User {
+				t.Helper()
+				user, err := repo.CreateUser(model.User{Name: name, Email: email, Subjects: []string{}, CreatedAt: &now, UpdatedAt: &now}, "test")
+				if err != nil {
+					t.Fatalf("CreateUser: %v", err)
+				}
+				return user
+			}
+			search := func(query string, mode string, limit int) []string {
+				t.Helper()
+				results, err := repo.SearchUsers(ctx, service.UserSearch{Query: query, Mode: mode, Limit: limit})
+				if err != nil {
+					t.Fatalf("SearchUsers(%q): %v", query, err)
+				}
+				names := []string{}
+				for _, result := range results {
+					names = append(names, result.User.Name)
+				}
+				return names
+			}
+
+			create("John Smith", "john@example.com")
+			create("Johnny Walker", "jw@example.com")
+			create("Mary Jones", "mary.john@example.com")
+			renamed := create("Old Name", "old@example.com")
+			deleted := create("John Gone", "gone@example.com")
+			if _, err := repo.UpdateUser(model.User{Name: "Jane Doe", Email: "old@example.com", Subjects: []string{}, UpdatedAt: &now}, renamed.Id, 1, "test"); err != nil {
+				t.Fatalf("UpdateUser: %v", err)
+			}
+			if err := repo.DeleteUser(deleted.Id, "test"); err != nil {
+				t.Fatalf("DeleteUser: %v", err)
+			}
+
+			tests := []struct {
+				query string
+				mode  string
+				limit int
+				want  []string
+			}{
+				// A name match outranks the same word in an email.
+				{"john", service.SearchModeFullText, 10, []string{"John Smith", "Mary Jones"}},
+				{"john", service.SearchModeFullText, 1, []string{"John Smith"}},
+				{"john smith", service.SearchModeFullText, 10, []string{"John Smith"}},
+				{"joh", service.SearchModeFullText, 10, []string{}},
+				{"joh", service.SearchModeAutocomplete, 2, []string{"John Smith", "Johnny Walker"}},
+				// One typo away from john and jones alike; equal scores come
+				// back newest first.
+				{"jonh", service.SearchModeAutocomplete, 10, []string{"Mary Jones", "Johnny Walker", "John Smith"}},
+				{"jane", service.SearchModeFullText, 10, []string{"Jane Doe"}},
+				{"old", service.SearchModeFullText, 10, []string{"Jane Doe"}},
+				{"name", service.SearchModeFullText, 10, []string{}},
+				{"gone", service.SearchModeFullText, 10, []string{}},
+			}
+			for _, tt := range tests {
+				got := search(tt.query, tt.mode, tt.limit)
+				if len(got) != len(tt.want) {
+					t.Errorf("%s search %q limit %d = %v, want %v", tt.mode, tt.query, tt.limit, got, tt.want)
+					continue
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("%s search %q limit %d = %v, want %v", tt.mode, tt.query, tt.limit, got, tt.want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fitness-api/filter"
+	"fitness-api/model"
+	"sort"
+	"time"
+)
+
+const (
+	StatsIntervalDay   = "day"
+	StatsIntervalWeek  = "week"
+	StatsIntervalMonth = "month"
+)
+
+// UserStatsQuery limits statistics to users created in [From, To). A nil
+// bound leaves that side open. IncludeDeleted counts soft-deleted users in
+// the per-subject counts.
+type UserStatsQuery struct {
+	From           *time.Time
+	To             *time.Time
+	IncludeDeleted bool
+}
+
+type SubjectCount struct {
+	Subject string `json:"subject"`
+	Users   int    `json:"users"`
+}
+
+// SignupBucket counts the users created in the period starting on Period, a
+// UTC date. Weeks start on Monday and months on the first.
+type SignupBucket struct {
+	Period string `json:"period"`
+	Users  int    `json:"users"`
+}
+
+// UserTotals counts active and soft-deleted users. AverageSubjects is the
+// mean number of subjects of the active users.
+type UserTotals struct {
+	Active          int     `json:"active"`
+	Deleted         int     `json:"deleted"`
+	Total           int     `json:"total"`
+	AverageSubjects float64 `json:"average_subjects"`
+}
+
+// UserStatistics aggregates users in the store itself, as GROUP BY queries
+// or aggregation pipelines, rather than reading every user.
+//
+// CountUsersBySubject returns the number of users having each subject, most
+// common first. CountSignups buckets users by the interval their created_at
+// falls in, oldest first, counting users deleted since; periods without
+// signups are left out.
+type UserStatistics interface {
+	CountUsersBySubject(ctx context.Context, query UserStatsQuery) ([]SubjectCount, error)
+	CountSignups(ctx context.Context, interval string, query UserStatsQuery) ([]SignupBucket, error)
+	CountUsers(ctx context.Context, query UserStatsQuery) (UserTotals, error)
+}
+
+// userQuery expresses the stats range as a listing query, so each backend
+// reuses its listing filter.
+func (q UserStatsQuery) userQuery(includeDeleted bool) UserQuery {
+	var terms []filter.Expr
+	if q.From != nil {
+		terms = append(terms, filter.Condition{Field: filter.FieldCreatedAt, Op: filter.OpAtOrAfter, Time: *q.From})
+	}
+	if q.To != nil {
+		terms = append(terms, filter.Condition{Field: filter.FieldCreatedAt, Op: filter.OpBefore, Time: *q.To})
+	}
+
+	query := UserQuery{PageSize: -1, IncludeDeleted: includeDeleted}
+	switch len(terms) {
+	case 0:
+	case 1:
+		query.Filter = terms[0]
+	default:
+		query.Filter = filter.And{Terms: terms}
+	}
+	return query
+}
+
+// StatsPeriodStart returns the start of the interval t falls in, in UTC.
+func StatsPeriodStart(t time.Time, interval string) time.Time {
+	year, month, day := t.UTC().Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case StatsIntervalWeek:
+		return start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	case StatsIntervalMonth:
+		return start.AddDate(0, 0, 1-day)
+	}
+	return start
+}
+
+// NextStatsPeriod returns the start of the interval after the one starting
+// at start.
+func NextStatsPeriod(start time.Time, interval string) time.Time {
+	switch interval {
+	case StatsIntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case StatsIntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// sortSubjectCounts orders by count, then by subject.
+func sortSubjectCounts(counts []SubjectCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Users != counts[j].Users {
+			return counts[i].Users > counts[j].Users
+		}
+		return counts[i].Subject < counts[j].Subject
+	})
+}
+
+// countUsersBySubject, countSignups and countUserTotals aggregate in Go for
+// the in-memory backend.
+func countUsersBySubject(users []model.User) []SubjectCount {
+	bySubject := map[string]int{}
+	for _, user := range users {
+		seen := map[string]bool{}
+		for _, subject := range user.Subjects {
+			if !seen[subject] {
+				seen[subject] = true
+				bySubject[subject]++
+			}
+		}
+	}
+
+	counts := make([]SubjectCount, 0, len(bySubject))
+	for subject, users := range bySubject {
+		counts = append(counts, SubjectCount{Subject: subject, Users: users})
+	}
+	sortSubjectCounts(counts)
+	return counts
+}
+
+func countSignups(users []model.User, interval string) []SignupBucket {
+	byPeriod := map[string]int{}
+	for _, user := range users {
+		if user.CreatedAt != nil {
+			byPeriod[StatsPeriodStart(*user.CreatedAt, interval).Format(time.DateOnly)]++
+		}
+	}
+
+	buckets := make([]SignupBucket, 0, len(byPeriod))
+	for period, users := range byPeriod {
+		buckets = append(buckets, SignupBucket{Period: period, Users: users})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Period < buckets[j].Period })
+	return buckets
+}
+
+func countUserTotals(users []model.User) UserTotals {
+	var totals UserTotals
+	subjects := 0
+	for _, user := range users {
+		if user.DeletedAt != nil {
+			totals.Deleted++
+			continue
+		}
+		totals.Active++
+		subjects += len(user.Subjects)
+	}
+	totals.Total = totals.Active + totals.Deleted
+	if totals.Active > 0 {
+		totals.AverageSubjects = float64(subjects) / float64(totals.Active)
+	}
+	return totals
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fitness-api/model"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// webhookClaimBatch is how many due deliveries a dispatcher claims at once.
+// DispatchDue keeps claiming batches while they come back full.
+const webhookClaimBatch = 100
+
+// SignWebhookPayload returns the signature header value for a delivery:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the webhook secret. Receivers recompute it to authenticate the
+// request and reject stale timestamps to stop replays.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcherConfig tunes delivery. The n-th retry waits RetryBase
+// times 2^(n-1), capped at RetryMax; after MaxAttempts failed attempts the
+// delivery is dead-lettered.
+type WebhookDispatcherConfig struct {
+	MaxAttempts  int
+	RetryBase    time.Duration
+	RetryMax     time.Duration
+	PollInterval time.Duration
+	Concurrency  int
+}
+
+// WebhookDispatcher fans user events out to the registered webhooks. As a
+// Publisher it turns each event into one stored delivery per subscribed
+// webhook; Run then sends due deliveries and schedules retries. Deliveries
+// are sent concurrently and retried independently, so receivers should order
+// events by the user's version rather than by arrival.
+type WebhookDispatcher struct {
+	store  WebhookRepository
+	client *http.Client
+	config WebhookDispatcherConfig
+	wake   chan struct{}
+	now    func() time.Time
+	lease  time.Duration
+}
+
+func NewWebhookDispatcher(store WebhookRepository, client *http.Client, config WebhookDispatcherConfig) *WebhookDispatcher {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	// A claimed batch is leased for as long as sending all of it can take
+	// when every attempt runs into the client timeout, plus one attempt.
+	timeout := client.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	rounds := (webhookClaimBatch + config.Concurrency - 1) / config.Concurrency
+	return &WebhookDispatcher{
+		store:  store,
+		client: client,
+		config: config,
+		wake:   make(chan struct{}, 1),
+		now:    func() time.Time { return time.Now().UTC() },
+		lease:  time.Duration(rounds+1) * timeout,
+	}
+}
+
+// Publish enqueues a delivery of event for every active webhook subscribed
+// to its type.
+func (d *WebhookDispatcher) Publish(ctx context.Context, event model.UserEvent) error {
+	webhooks, err := d.store.ListWebhooks()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %v", event.Id, err)
+	}
+
+	now := d.now()
+	var deliveries []model.WebhookDelivery
+	for _, webhook := range webhooks {
+		if !webhook.Active || !slices.Contains(webhook.EventTypes, event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, model.WebhookDelivery{
+			Id:            newID(),
+			WebhookId:     webhook.Id,
+			EventId:       event.Id,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			Attempts:      []model.WebhookAttempt{},
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := d.store.EnqueueDeliveries(deliveries); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run sends due deliveries every PollInterval, or sooner when Publish
+// enqueues new ones, until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil {
+			log.Printf("Webhook dispatcher: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DispatchDue attempts every delivery whose next attempt is due, up to
+// Concurrency at a time, and returns how many were attempted. Deliveries are
+// claimed in batches before they are sent, so dispatchers on other instances
+// skip them.
+func (d *WebhookDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		now := d.now()
+		due, err := d.store.ClaimDueDeliveries(now, now.Add(d.lease), webhookClaimBatch)
+		if err != nil {
+			return attempted, err
+		}
+		d.deliver(ctx, due)
+		attempted += len(due)
+		if len(due) < webhookClaimBatch {
+			break
+		}
+	}
+	return attempted, nil
+}
+
+// deliver attempts the claimed deliveries, up to Concurrency at a time, and
+// saves each outcome, which releases its claim.
+func (d *WebhookDispatcher) deliver(ctx context.Context, due []model.WebhookDelivery) {
+	slots := make(chan struct{}, d.config.Concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(delivery model.WebhookDelivery) {
+			defer func() { <-slots; wg.Done() }()
+
+			delivery = d.attempt(ctx, delivery, true)
+			if err := d.store.SaveDelivery(delivery); err != nil {
+				log.Printf("Webhook dispatcher: failed to save delivery %s: %v", delivery.Id, err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// Redeliver makes one immediate attempt at a dead-lettered delivery. It
+// succeeds or goes back to the dead-letter list; no retries are scheduled.
+// The delivery is claimed first, like a scheduled one, so two retries of the
+// same delivery cannot both send it.
+func (d *WebhookDispatcher) Redeliver(ctx context.Context, deliveryID string) (model.WebhookDelivery, error) {
+	delivery, err := d.store.GetDelivery(deliveryID)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	if delivery.Status != model.DeliveryDead {
+		return model.WebhookDelivery{}, fmt.Errorf("delivery %s is %s, only dead deliveries can be retried", deliveryID, delivery.Status)
+	}
+
+	now := d.now()
+	delivery, claimed, err := d.store.ClaimDeadDelivery(deliveryID, now, now.Add(d.lease))
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	if !claimed {
+		return model.WebhookDelivery{}, fmt.Errorf("delivery %s is already being retried", deliveryID)
+	}
+
+	delivery = d.attempt(ctx, delivery, false)
+	if err := d.store.SaveDelivery(delivery); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// attempt POSTs the delivery once and returns it with the attempt recorded
+// and its status and next attempt updated.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery model.WebhookDelivery, retry bool) model.WebhookDelivery {
+	started := d.now()
+	statusCode, err := d.send(ctx, delivery)
+
+	attempt := model.WebhookAttempt{
+		AttemptedAt: started,
+		StatusCode:  statusCode,
+		DurationMs:  d.now().Sub(started).Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.UpdatedAt = d.now()
+
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliverySucceeded
+		delivery.NextAttemptAt = nil
+	case !retry || len(delivery.Attempts) >= d.config.MaxAttempts:
+		delivery.Status = model.DeliveryDead
+		delivery.NextAttemptAt = nil
+		log.Printf("Webhook delivery %s to webhook %s dead-lettered after %d attempt(s): %v", delivery.Id, delivery.WebhookId, len(delivery.Attempts), err)
+	default:
+		next := delivery.UpdatedAt.Add(d.backoff(len(delivery.Attempts)))
+		delivery.NextAttemptAt = &next
+	}
+	return delivery
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, delivery model.WebhookDelivery) (int, error) {
+	webhook, err := d.store.GetWebhook(delivery.WebhookId)
+	if err != nil {
+		return 0, err
+	}
+	if !webhook.Active {
+		return 0, fmt.Errorf("webhook %s is inactive", webhook.Id)
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := d.now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.Id)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the next attempt after the given number of
+// failed attempts.
+func (d *WebhookDispatcher) backoff(failures int) time.Duration {
+	delay := d.config.RetryBase
+	for i := 1; i < failures && delay < d.config.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, d.config.RetryMax)
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"fitness-api/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+// testDispatcher wires a dispatcher to an in-memory store with one webhook
+// pointing at handler, and a clock the test moves by hand.
+type testDispatcher struct {
+	*WebhookDispatcher
+	store   *MemoryWebhookRepository
+	webhook model.Webhook
+	clock   time.Time
+}
+
+func newTestDispatcher(t *testing.T, handler http.HandlerFunc, config WebhookDispatcherConfig, timeout time.Duration) *testDispatcher {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	store := NewMemoryWebhookRepository()
+	webhook, err := store.CreateWebhook(model.Webhook{
+		URL:        server.URL,
+		Secret:     testWebhookSecret,
+		EventTypes: []string{model.UserCreated},
+		Active:     true,
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	td := &testDispatcher{
+		WebhookDispatcher: NewWebhookDispatcher(store, &http.Client{Timeout: timeout}, config),
+		store:             store,
+		webhook:           webhook,
+		clock:             time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	td.now = func() time.Time { return td.clock }
+	return td
+}
+
+// publish enqueues one UserCreated event and returns its delivery.
+func (td *testDispatcher) publish(t *testing.T) model.WebhookDelivery {
+	t.Helper()
+	event := model.UserEvent{Id: "event-1", Type: model.UserCreated, UserId: "user-1", OccurredAt: td.clock}
+	if err := td.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	deliveries, _, _, err := td.store.ListDeliveries(td.webhook.Id, "", 10, 1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ListDeliveries = %d deliveries, %v; want 1", len(deliveries), err)
+	}
+	return deliveries[0]
+}
+
+func (td *testDispatcher) dispatch(t *testing.T) int {
+	t.Helper()
+	attempted, err := td.DispatchDue(context.Background())
+	if err != nil {
+		t.Fatalf("DispatchDue: %v", err)
+	}
+	return attempted
+}
+
+func (td *testDispatcher) delivery(t *testing.T, id string) model.WebhookDelivery {
+	t.Helper()
+	delivery, err := td.store.GetDelivery(id)
+	if err != nil {
+		t.Fatalf("GetDelivery: %v", err)
+	}
+	return delivery
+}
+
+func TestWebhookDispatcherSignsDeliveries(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	td := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}, WebhookDispatcherConfig{MaxAttempts: 3, RetryBase: time.Second, RetryMax: time.Minute}, time.Second)
+
+	delivery := td.publish(t)
+	if got := td.dispatch(t); got != 1 {
+		t.Fatalf("DispatchDue attempted %d deliveries, want 1", got)
+	}
+
+	r, body := <-received, <-bodies
+	if string(body) != delivery.Payload {
+		t.Errorf("body = %s, want the stored payload %s", body, delivery.Payload)
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("%s = %q: %v", WebhookTimestampHeader, r.Header.Get(WebhookTimestampHeader), err)
+	}
+	if timestamp != td.clock.Unix() {
+		t.Errorf("%s = %d, want %d", WebhookTimestampHeader, timestamp, td.clock.Unix())
+	}
+	if got, want := r.Header.Get(WebhookSignatureHeader), SignWebhookPayload(testWebhookSecret, timestamp, body); got != want {
+		t.Errorf("%s = %q, want %q", WebhookSignatureHeader, got, want)
+	}
+	if !strings.HasPrefix(r.Header.Get(WebhookSignatureHeader), "sha256=") {
+		t.Errorf("%s = %q, want a sha256= prefix", WebhookSignatureHeader, r.Header.Get(WebhookSignatureHeader))
+	}
+	if got := r.Header.Get(WebhookEventHeader); got != model.UserCreated {
+		t.Errorf("%s = %q, want %q", WebhookEventHeader, got, model.UserCreated)
+	}
+	if got := r.Header.Get(WebhookDeliveryHeader); got != delivery.Id {
+		t.Errorf("%s = %q, want %q", WebhookDeliveryHeader, got, delivery.Id)
+	}
+
+	saved := td.delivery(t, delivery.Id)
+	if saved.Status != model.DeliverySucceeded || saved.NextAttemptAt != nil {
+		t.Errorf("delivery = %s next %v, want succeeded with nothing scheduled", saved.Status, saved.NextAttemptAt)
+	}
+	if len(saved.Attempts) != 1 || saved.Attempts[0].StatusCode != http.StatusNoContent {
+		t.Errorf("attempts = %+v, want one 204", saved.Attempts)
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	signature := SignWebhookPayload("secret", 1700000000, []byte(`{"id":"1"}`))
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		same      bool
+	}{
+		{name: "same input", secret: "secret", timestamp: 1700000000, body: `{"id":"1"}`, same: true},
+		{name: "other secret", secret: "other", timestamp: 1700000000, body: `{"id":"1"}`},
+		{name: "other timestamp", secret: "secret", timestamp: 1700000001, body: `{"id":"1"}`},
+		{name: "other body", secret: "secret", timestamp: 1700000000, body: `{"id":"2"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body))
+			if (got == signature) != tt.same {
+				t.Errorf("SignWebhookPayload = %s, same as reference = %v, want %v", got, got == signature, tt.same)
+			}
+		})
+	}
+}
+
+func TestWebhookDispatcherRetriesWithBackoffThenDeadLetters(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		statusCode int
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			statusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// Hold the request until the client gives up on it. The server
+				// only notices the client leaving once the body has been read.
+				io.Copy(io.Discard, r.Body)
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			},
+			statusCode: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := newTestDispatcher(t, tt.handler, WebhookDispatcherConfig{
+				MaxAttempts: 4,
+				RetryBase:   10 * time.Second,
+				RetryMax:    30 * time.Second,
+			}, 50*time.Millisecond)
+			delivery := td.publish(t)
+
+			// Each retry waits RetryBase * 2^(n-1), capped at RetryMax.
+			for i, wait := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+				if got := td.dispatch(t); got != 1 {
+					t.Fatalf("attempt %d: DispatchDue attempted %d deliveries, want 1", i+1, got)
+				}
+				saved := td.delivery(t, delivery.Id)
+				if saved.Status != model.DeliveryPending {
+					t.Fatalf("attempt %d: status = %s, want pending", i+1, saved.Status)
+				}
+				if len(saved.Attempts) != i+1 {
+					t.Fatalf("attempt %d: %d attempts recorded", i+1, len(saved.Attempts))
+				}
+				last := saved.Attempts[i]
+				if last.StatusCode != tt.statusCode || last.Error == "" {
+					t.Errorf("attempt %d: recorded %d %q, want %d with an error", i+1, last.StatusCode, last.Error, tt.statusCode)
+				}
+				if want := td.clock.Add(wait); saved.NextAttemptAt == nil || !saved.NextAttemptAt.Equal(want) {
+					t.Fatalf("attempt %d: next attempt at %v, want %v", i+1, saved.NextAttemptAt, want)
+				}
+
+				// Nothing is sent before the backoff has passed.
+				td.clock = td.clock.Add(wait - time.Second)
+				if got := td.dispatch(t); got != 0 {
+					t.Fatalf("attempt %d: DispatchDue attempted %d deliveries before the retry was due", i+1, got)
+				}
+				td.clock = td.clock.Add(time.Second)
+			}
+
+			if got := td.dispatch(t); got != 1 {
+				t.Fatalf("last attempt: DispatchDue attempted %d deliveries, want 1", got)
+			}
+			saved := td.delivery(t, delivery.Id)
+			if saved.Status != model.DeliveryDead || saved.NextAttemptAt != nil || len(saved.Attempts) != 4 {
+				t.Fatalf("after MaxAttempts: status %s, next %v, %d attempts; want dead, nil, 4", saved.Status, saved.NextAttemptAt, len(saved.Attempts))
+			}
+
+			td.clock = td.clock.Add(time.Hour)
+			if got := td.dispatch(t); got != 0 {
+				t.Errorf("DispatchDue attempted %d dead deliveries, want 0", got)
+			}
+		})
+	}
+}
+
+func TestWebhookDispatcherRedeliver(t *testing.T) {
+	var healthy atomic.Bool
+	td := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}, WebhookDispatcherConfig{MaxAttempts: 1, RetryBase: time.Second, RetryMax: time.Minute}, time.Second)
+
+	delivery := td.publish(t)
+	if _, err := td.Redeliver(context.Background(), delivery.Id); err == nil || !strings.Contains(err.Error(), "only dead deliveries") {
+		t.Fatalf("Redeliver of a pending delivery = %v, want an only dead deliveries error", err)
+	}
+
+	td.dispatch(t)
+	if saved := td.delivery(t, delivery.Id); saved.Status != model.DeliveryDead {
+		t.Fatalf("status = %s, want dead after MaxAttempts 1", saved.Status)
+	}
+
+	// A failed manual retry goes straight back to the dead-letter list.
+	retried, err := td.Redeliver(context.Background(), delivery.Id)
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if retried.Status != model.DeliveryDead || retried.NextAttemptAt != nil || len(retried.Attempts) != 2 {
+		t.Fatalf("failed redelivery: status %s, next %v, %d attempts; want dead, nil, 2", retried.Status, retried.NextAttemptAt, len(retried.Attempts))
+	}
+
+	healthy.Store(true)
+	retried, err = td.Redeliver(context.Background(), delivery.Id)
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if retried.Status != model.DeliverySucceeded || len(retried.Attempts) != 3 {
+		t.Fatalf("redelivery: status %s, %d attempts; want succeeded, 3", retried.Status, len(retried.Attempts))
+	}
+	if saved := td.delivery(t, delivery.Id); saved.Status != model.DeliverySucceeded {
+		t.Errorf("stored status = %s, want succeeded", saved.Status)
+	}
+
+	if _, err := td.Redeliver(context.Background(), "missing"); err == nil || !strings.HasPrefix(err.Error(), "no delivery found") {
+		t.Errorf("Redeliver of a missing delivery = %v, want a no delivery found error", err)
+	}
+}
+
+func TestWebhookDispatcherRedeliverSkipsClaimedDeliveries(t *testing.T) {
+	var requests atomic.Int32
+	td := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}, WebhookDispatcherConfig{MaxAttempts: 1, RetryBase: time.Second, RetryMax: time.Minute}, time.Second)
+	delivery := td.publish(t)
+	td.dispatch(t)
+
+	// Another request is already retrying the dead delivery.
+	if _, claimed, err := td.store.ClaimDeadDelivery(delivery.Id, td.clock, td.clock.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("ClaimDeadDelivery = %v, %v; want claimed", claimed, err)
+	}
+	if _, err := td.Redeliver(context.Background(), delivery.Id); err == nil || !strings.Contains(err.Error(), "already being retried") {
+		t.Fatalf("Redeliver of a claimed delivery = %v, want an already being retried error", err)
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("%d requests, want only the scheduled one", requests.Load())
+	}
+
+	// Once the lease runs out the delivery can be retried again.
+	td.clock = td.clock.Add(time.Minute)
+	if _, err := td.Redeliver(context.Background(), delivery.Id); err != nil {
+		t.Fatalf("Redeliver after the lease: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("%d requests, want 2", requests.Load())
+	}
+}
+
+func TestWebhookDispatcherSkipsClaimedDeliveries(t *testing.T) {
+	var requests atomic.Int32
+	td := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}, WebhookDispatcherConfig{MaxAttempts: 3, RetryBase: time.Second, RetryMax: time.Minute}, time.Second)
+	delivery := td.publish(t)
+
+	// Another instance claims the delivery and has not reported back yet.
+	claimed, err := td.store.ClaimDueDeliveries(td.clock, td.clock.Add(time.Minute), webhookClaimBatch)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimDueDeliveries = %d, %v; want 1", len(claimed), err)
+	}
+	if got := td.dispatch(t); got != 0 || requests.Load() != 0 {
+		t.Fatalf("DispatchDue attempted %d leased deliveries (%d requests), want 0", got, requests.Load())
+	}
+
+	// Once the lease runs out the delivery is picked up again.
+	td.clock = td.clock.Add(time.Minute)
+	if got := td.dispatch(t); got != 1 || requests.Load() != 1 {
+		t.Fatalf("DispatchDue after the lease attempted %d (%d requests), want 1", got, requests.Load())
+	}
+	if saved := td.delivery(t, delivery.Id); saved.Status != model.DeliverySucceeded {
+		t.Errorf("status = %s, want succeeded", saved.Status)
+	}
+}
+
+func TestWebhookDispatcherDrainsFullBatches(t *testing.T) {
+	var requests atomic.Int32
+	td := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}, WebhookDispatcherConfig{MaxAttempts: 3, RetryBase: time.Second, RetryMax: time.Minute, Concurrency: 8}, time.Second)
+
+	total := webhookClaimBatch*2 + 5
+	for i := 0; i < total; i++ {
+		event := model.UserEvent{Id: "event-" + strconv.Itoa(i), Type: model.UserCreated, UserId: "user-1", OccurredAt: td.clock}
+		if err := td.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	if got := td.dispatch(t); got != total || int(requests.Load()) != total {
+		t.Fatalf("one DispatchDue attempted %d deliveries (%d requests), want %d", got, requests.Load(), total)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"fitness-api/model"
+	"time"
+)
+
+// WebhookRepository stores webhook registrations and their deliveries. It
+// lives on the same backend as the users.
+//
+// EnqueueDeliveries skips a delivery whose webhook already has one for the
+// same event, so republishing an event never notifies an endpoint twice.
+// Deleting a webhook deletes its deliveries.
+//
+// ClaimDueDeliveries atomically leases up to limit pending deliveries whose
+// next attempt is due and that no one else holds, until leaseUntil, so
+// several dispatchers can share one backend without sending a delivery
+// twice. SaveDelivery releases the lease; a dispatcher that dies mid-send
+// leaves the delivery to be claimed again once the lease runs out.
+//
+// ClaimDeadDelivery leases one dead delivery the same way, for a manual
+// retry. It returns false when the delivery is missing, no longer dead or
+// already held.
+type WebhookRepository interface {
+	CreateWebhook(webhook model.Webhook) (model.Webhook, error)
+	UpdateWebhook(webhook model.Webhook) (model.Webhook, error)
+	DeleteWebhook(id string) error
+	GetWebhook(id string) (model.Webhook, error)
+	ListWebhooks() ([]model.Webhook, error)
+
+	EnqueueDeliveries(deliveries []model.WebhookDelivery) error
+	ClaimDueDeliveries(now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error)
+	ClaimDeadDelivery(id string, now time.Time, leaseUntil time.Time) (model.WebhookDelivery, bool, error)
+	SaveDelivery(delivery model.WebhookDelivery) error
+	GetDelivery(id string) (model.WebhookDelivery, error)
+	ListDeliveries(webhookID string, status string, pageSize int, pageNo int) ([]model.WebhookDelivery, int, int, error)
+}